@@ -2,72 +2,192 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
-	"encoding/gob"
-	"go-blockchain/errors"
+	"encoding/binary"
+	"fmt"
+	"time"
 )
 
-// Block type
+// BlockVersion is the version of the blocks created by the node. The headers of
+// the blocks of version 1, created before the binary encoding, are hashed in
+// their legacy serialization so that their hashes and proofs of work still hold.
+// From version 3 the blocks use the median time past, see medianTimeVersion,
+// their headers commit to their signer, see signerVersion, and they start with a
+// coinbase, see coinbaseVersion
+const BlockVersion = 3
+
+// legacyBlockVersion is the last version of the blocks with a legacy serialization
+const legacyBlockVersion = 1
+
+// coinbaseVersion is the first block version whose first transaction has to be a
+// coinbase. The blocks send mined before it may have none
+const coinbaseVersion = 3
+
+// BlockHeader describes a block and commits to its transactions through their
+// merkle root. The seal of the block only covers the header
+type BlockHeader struct {
+	Version    int32
+	PrevHash   []byte
+	MerkleRoot []byte
+	Timestamp  int64  // unix time at which the block was created
+	Bits       uint32 // compact representation of the target of the proof of work, 0 without proof of work
+	Nonce      int
+	Height     int // number of blocks before this one in the chain
+
+	// on proof-of-authority networks, the public key of the signer sealing the
+	// block. The hash only covers it from signerVersion
+	Signer []byte
+}
+
+// Block is a header followed by its body, the transactions
 type Block struct {
-	Hash         []byte
+	BlockHeader
+	Hash         []byte // hash of the header
 	Transactions []*Transaction
-	PrevHash     []byte
-	Nonce        int
+
+	// on proof-of-authority networks, the signature of the hash by the Signer of the header
+	Signature []byte
 }
 
-// CreateBlock creates a block with a hash derived from the data and the prevHash
-func CreateBlock(txs []*Transaction, prevHash []byte) *Block {
+// CreateBlock creates a block with the transactions on top of the block with
+// prevHash, stored in chain, and seals it with engine, searching the seal with
+// opts. Its timestamp is the current time, or right after the median time past
+// of the previous blocks if they are ahead. It fails with the error of ctx if ctx
+// is done before the block is sealed
+func CreateBlock(ctx context.Context, engine Consensus, chain *BlockChain, txs []*Transaction, prevHash []byte, height int, opts PoWOptions) (*Block, error) {
 	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			PrevHash:  prevHash,
+			Timestamp: time.Now().Unix(),
+			Nonce:     0,
+			Height:    height,
+		},
 		Transactions: txs,
-		PrevHash:     prevHash,
-		Nonce:        0,
+	}
+	block.MerkleRoot = block.HashTransactions()
+
+	if len(prevHash) != 0 {
+		mtp, err := chain.MedianTimePast(prevHash)
+		if err != nil {
+			return nil, err
+		}
+		if block.Timestamp <= mtp {
+			block.Timestamp = mtp + 1
+		}
+	}
+
+	if err := engine.Prepare(chain, block); err != nil {
+		return nil, err
+	}
+	if err := engine.Seal(ctx, block, opts); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// Serialize encodes the header, see EncodingVersion
+func (h *BlockHeader) Serialize() []byte {
+	var e encoder
+	e.WriteByte(EncodingVersion)
+	e.writeHeader(h)
+	if h.Version >= signerVersion {
+		e.writeBytes(h.Signer)
+	}
+
+	return e.Bytes()
+}
+
+// hashData returns what the hash of the header and the proof of work hash: the
+// encoding of the header, or its legacy serialization for the legacy blocks
+func (h *BlockHeader) hashData() []byte {
+	if h.Version <= legacyBlockVersion {
+		return h.legacySerialize()
 	}
 
-	pow := NewProof(block)
-	nonce, hash := pow.Run()
+	return h.Serialize()
+}
+
+// legacySerialize writes the fields of the header in a fixed order
+func (h *BlockHeader) legacySerialize() []byte {
+	var data bytes.Buffer
+
+	version := make([]byte, 4)
+	binary.BigEndian.PutUint32(version, uint32(h.Version))
+	data.Write(version)
+	writeLegacyBytes(&data, h.PrevHash)
+	writeLegacyBytes(&data, h.MerkleRoot)
+	data.Write(toHex(h.Timestamp))
+	data.Write(toHex(int64(h.Bits)))
+	data.Write(toHex(int64(h.Nonce)))
+	data.Write(toHex(int64(h.Height)))
+
+	return data.Bytes()
+}
 
-	block.Hash = hash
-	block.Nonce = nonce
+// Hash returns the hash of the header
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.hashData())
 
-	return block
+	return hash[:]
 }
 
-// Genesis returns a genesis block
-func Genesis(coinbase *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{})
+// Genesis returns a genesis block sealed by engine
+func Genesis(engine Consensus, coinbase *Transaction, opts PoWOptions) (*Block, error) {
+	return CreateBlock(context.Background(), engine, nil, []*Transaction{coinbase}, []byte{}, 0, opts)
 }
 
-// HashTransactions returns the hash of all the transactions in the block
+// HashTransactions returns the merkle root of all the transactions in the block
 func (b *Block) HashTransactions() []byte {
 	var txHashes [][]byte
-	var txHash [32]byte
 
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.ID)
 	}
+	tree := NewMerkleTree(b.Version, txHashes)
 
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
-
-	return txHash[:]
+	return tree.RootNode.Data
 }
 
-// Serialize serializes the block into a byte slice
+// Serialize encodes the block, see EncodingVersion
 func (b *Block) Serialize() []byte {
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
-
-	err := encoder.Encode(b)
-	errors.HandleErr(err)
+	var e encoder
+	e.WriteByte(EncodingVersion)
+	e.writeHeader(&b.BlockHeader)
+	e.writeBytes(b.Signer)
+	e.writeBytes(b.Signature)
+	e.writeUint32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		e.writeBytes(tx.Serialize())
+	}
 
-	return res.Bytes()
+	return e.Bytes()
 }
 
-// Deserialize deserializes the byte slice into a block
-func Deserialize(data []byte) *Block {
-	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(data))
+// Deserialize decodes a block encoded by Serialize and computes its hash and the
+// IDs of its transactions
+func Deserialize(data []byte) (*Block, error) {
+	d := newDecoder(data)
+	block := &Block{BlockHeader: d.readHeader()}
+	block.Signer = d.readBytes()
+	block.Signature = d.readBytes()
+	for i, count := uint32(0), d.readUint32(); i < count && d.err == nil; i++ {
+		encodedTx := d.readBytes()
+		if d.err != nil {
+			break
+		}
+		tx, err := DeserializeTransaction(encodedTx)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		block.Transactions = append(block.Transactions, &tx)
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	block.Hash = block.BlockHeader.Hash()
 
-	err := decoder.Decode(&block)
-	errors.HandleErr(err)
-	return &block
+	return block, nil
 }
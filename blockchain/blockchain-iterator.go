@@ -1,46 +1,39 @@
 package blockchain
 
 import (
-	"go-blockchain/errors"
-
-	"github.com/dgraph-io/badger"
+	"go-blockchain/storage"
 )
 
 // BCIterator is an Iterator for block chain
 // TODO? Use interface
 type BCIterator struct {
 	CurrentHash []byte
-	Database    *badger.DB
+	Database    storage.Store
 }
 
 // Iterator returns a BlockChainIterator for a blockchain
 func (chain *BlockChain) Iterator() *BCIterator {
 	return &BCIterator{
-		CurrentHash: chain.LastHash,
+		CurrentHash: chain.GetLastHash(),
 		Database:    chain.Database,
 	}
 }
 
 // Next will give the next block
-func (iter *BCIterator) Next() *Block {
+func (iter *BCIterator) Next() (*Block, error) {
 	var block *Block
 
-	err := iter.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(iter.CurrentHash)
-		errors.HandleErr(err)
-		var encodedBlock []byte
-		item.Value(func(val []byte) error {
-			encodedBlock = val
-			return nil
-		})
-
-		block = Deserialize(encodedBlock)
+	err := iter.Database.View(func(txn storage.Txn) error {
+		var err error
+		block, err = getBlock(txn, iter.CurrentHash)
 
-		return nil
+		return err
 	})
-	errors.HandleErr(err)
+	if err != nil {
+		return nil, err
+	}
 
 	iter.CurrentHash = block.PrevHash
 
-	return block
+	return block, nil
 }
@@ -2,146 +2,493 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
-	"fmt"
+	"go-blockchain/config"
 	"go-blockchain/errors"
-	"os"
-	"runtime"
+	"sync"
+	"time"
 
-	"github.com/dgraph-io/badger"
+	"go-blockchain/storage"
 )
 
 const (
-	dbPath      = "./tmp/blocks"
-	dbFile      = "./tmp/blocks/MANIFEST"
-	genesisData = "First Transaction from Genesis"
+	// networkKey holds the name of the network of the chain
+	networkKey = "network"
+	// maxFutureBlockTime is how far ahead of our clock the timestamp of a block can be
+	maxFutureBlockTime = 2 * time.Hour
 )
 
 // BlockChain is a list(chain) of blocks
 type BlockChain struct {
 	// Blocks   []*Block
-	LastHash []byte //Last hash of the last block in the chain
-	Database *badger.DB
-}
-
-// DBExists checks if the database exists or not
-func DBExists() bool {
-	// _, err := os.Stat(dbFile)
-	// return !os.IsNotExist(err)
+	LastHash []byte //Last hash of the last block in the chain, read with GetLastHash once blocks are added concurrently
+	Database storage.Store
+	PoW      PoWOptions // how MineBlock searches the proof of work
 
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
-		return false
-	}
+	// Consensus seals and verifies the blocks, the engine of the network by default
+	Consensus Consensus
 
-	return true
+	handlers []func(*TipChange) // called after every change of the tip
+	mu       sync.Mutex         // serializes the changes of the tip and guards LastHash
 }
 
-// InitBlockChain returns a blockchain initialised with the genesis block
-func InitBlockChain(address string) *BlockChain {
+// GetLastHash returns the hash of the tip of the main chain, or nil for a chain
+// without blocks. It waits for the block being added, if any
+func (chain *BlockChain) GetLastHash() []byte {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
 
-	if DBExists() {
-		fmt.Println("Blockchain already exists")
-		runtime.Goexit()
+	return chain.LastHash
+}
+
+// InitBlockChain initialises db with the chain of the network the process runs,
+// starting with the genesis block, sealed by engine with opts.
+// It fails with ErrChainExists if db already holds a chain
+func InitBlockChain(address string, db storage.Store, engine Consensus, opts PoWOptions) (*BlockChain, error) {
+	cbtx, err := CoinBaseTx(address, config.Params().GenesisData, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := Genesis(engine, cbtx, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	// opening the database
-	opts := badger.DefaultOptions(dbPath)
-	opts.Logger = nil
-	db, err := badger.Open(opts)
-	errors.HandleErr(err)
+	err = db.Update(func(txn storage.Txn) error {
+		if _, err := txn.Get([]byte("lh")); err == nil {
+			return errors.NewChainExistsError()
+		} else if err != storage.ErrNotFound {
+			return err
+		}
 
-	var lastHash []byte
-	err = db.Update(func(txn *badger.Txn) error {
-		cbtx := CoinBaseTx(address, genesisData)
-		genesis := Genesis(cbtx)
-		fmt.Println("Genesis Proved")
-		err = txn.Set(genesis.Hash, genesis.Serialize())
-		errors.HandleErr(err)
-		err = txn.Set([]byte("lh"), genesis.Hash)
-
-		lastHash = genesis.Hash
-		return err
+		if err := txn.Put([]byte(networkKey), []byte(config.Params().Name)); err != nil {
+			return err
+		}
+		if err := txn.Put(databaseVersionKey, []byte{DatabaseVersion}); err != nil {
+			return err
+		}
+		if _, err := storeBlock(txn, genesis, engine.Weight(genesis)); err != nil {
+			return err
+		}
+
+		return connectBlock(txn, genesis)
 	})
-	errors.HandleErr(err)
+	if err != nil {
+		return nil, err
+	}
 
 	return &BlockChain{
-		Database: db,
-		LastHash: lastHash,
+		Database:  db,
+		LastHash:  genesis.Hash,
+		PoW:       opts,
+		Consensus: engine,
+	}, nil
+}
+
+// ContinueBlockChain opens the existing blockchain stored in db.
+// It fails with ErrChainNotFound if db holds no blockchain
+func ContinueBlockChain(db storage.Store) (*BlockChain, error) {
+	chain, err := OpenBlockChain(db)
+	if err != nil {
+		return nil, err
 	}
+	if chain.GetLastHash() == nil {
+		return nil, errors.NewChainNotFoundError()
+	}
+
+	return chain, nil
 }
 
-func ContinueBlockChain(address string) *BlockChain {
-	if !DBExists() {
-		fmt.Println("No existing blockchain found, create one!")
-		runtime.Goexit()
+// OpenBlockChain opens the chain stored in db, which can be empty.
+// The returned chain has no LastHash until it receives its genesis block, which
+// lets a new node download the whole chain from its peers.
+// It fails with ErrWrongNetwork if the chain belongs to another network than
+// the one the process runs. Databases with an older layout are migrated, see
+// DatabaseVersion. Closing the Database of the chain closes db
+func OpenBlockChain(db storage.Store) (*BlockChain, error) {
+	engine, err := NewConsensus(nil)
+	if err != nil {
+		return nil, err
 	}
 
 	var lastHash []byte
+	err = db.Update(func(txn storage.Txn) error {
+		if err := checkNetwork(txn); err != nil {
+			return err
+		}
 
-	// opening the database
-	opts := badger.DefaultOptions(dbPath)
-	opts.Logger = nil
-	db, err := badger.Open(opts)
-	errors.HandleErr(err)
-
-	err = db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		errors.HandleErr(err)
-		item.Value(func(val []byte) error {
-			lastHash = val
+		lastHash, err = txn.Get([]byte("lh"))
+		if err == storage.ErrNotFound {
 			return nil
-		})
+		}
 
 		return err
 	})
-	errors.HandleErr(err)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
 
-	return &BlockChain{lastHash, db}
+	return &BlockChain{LastHash: lastHash, Database: db, Consensus: engine}, nil
 }
 
-//AddBlock adds a block to the blockchain
-func (chain *BlockChain) AddBlock(transactions []*Transaction) {
-	// prevBlock := chain.Blocks[len(chain.Blocks)-1]
-	// newBlock := CreateBlock(data, prevBlock.Hash)
-	// chain.Blocks = append(chain.Blocks, newBlock)
-	var lastHash []byte
+// checkNetwork checks that the chain belongs to the network the process runs.
+// Chains without a network, like new ones, are given it
+func checkNetwork(txn storage.Txn) error {
+	network := config.Params().Name
+
+	found, err := txn.Get([]byte(networkKey))
+	if err == storage.ErrNotFound {
+		return txn.Put([]byte(networkKey), []byte(network))
+	}
+	if err != nil {
+		return err
+	}
+	if string(found) != network {
+		return errors.NewWrongNetworkChainError(string(found), network)
+	}
+
+	return nil
+}
+
+// MineBlock mines a block with the given transactions on top of the chain and adds
+// it to the chain. It fails with the error of ctx if ctx is done before the block is mined
+func (chain *BlockChain) MineBlock(ctx context.Context, transactions []*Transaction) (*Block, error) {
+	return chain.mineBlock(ctx, transactions, chain.PoW)
+}
+
+// MineTransactions mines a block like MineBlock with a coinbase paying the subsidy
+// and the fees of the transactions to minerAddress, followed by the transactions
+func (chain *BlockChain) MineTransactions(ctx context.Context, minerAddress string, transactions []*Transaction) (*Block, error) {
+	fees := 0
+	for _, tx := range transactions {
+		fee, err := chain.TransactionFee(tx)
+		if err != nil {
+			return nil, err
+		}
+		fees += fee
+	}
+
+	bestHeight, err := chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	cbTx, err := CoinBaseTx(minerAddress, "", bestHeight+1, fees)
+	if err != nil {
+		return nil, err
+	}
+
+	return chain.MineBlock(ctx, append([]*Transaction{cbTx}, transactions...))
+}
+
+// mineBlock mines a block like MineBlock, searching the proof of work with opts
+func (chain *BlockChain) mineBlock(ctx context.Context, transactions []*Transaction, opts PoWOptions) (*Block, error) {
+	var lastBlock *Block
+
+	fees := 0
+	for _, tx := range transactions {
+		fee, err := chain.verifyTransaction(tx)
+		if err != nil {
+			return nil, err
+		}
+		fees += fee
+	}
+
+	// Getting the last block and creating a new block on top of it
+	err := chain.Database.View(func(txn storage.Txn) error {
+		lastHash, err := txn.Get([]byte("lh"))
+		if err != nil {
+			return err
+		}
+
+		if lastBlock, err = getBlock(txn, lastHash); err != nil {
+			return err
+		}
+
+		// a locked transaction would only fail once the block is mined
+		for _, tx := range transactions {
+			if err := checkNextBlockLocks(txn, tx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transactions) > 0 && transactions[0].IsCoinbase() {
+		reward, err := transactions[0].outputValue()
+		if err != nil {
+			return nil, err
+		}
+		if reward > Subsidy(lastBlock.Height+1)+fees {
+			return nil, errors.NewInvalidTransactionError(transactions[0].ID)
+		}
+	}
+
+	newBlock, err := CreateBlock(ctx, chain.Consensus, chain, transactions, lastBlock.Hash, lastBlock.Height+1, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chain.AddBlock(newBlock); err != nil {
+		return nil, err
+	}
+
+	return newBlock, nil
+}
+
+// AddBlock adds a block to the chain. The block is stored if it is valid, even if
+// it does not extend the main chain, and the chain reorganizes to its branch if the
+// branch has more chainwork than the main chain. Its handlers are then told how the
+// tip changed
+func (chain *BlockChain) AddBlock(block *Block) error {
+	if chain.HasBlock(block.Hash) {
+		return nil
+	}
+
+	if err := chain.validateBlock(block); err != nil {
+		return err
+	}
+
+	chain.mu.Lock()
+	change, err := chain.acceptBlock(block)
+	chain.mu.Unlock()
+	if err != nil || change == nil {
+		return err
+	}
+
+	chain.notify(change)
+
+	return nil
+}
+
+// acceptBlock stores the block and reorganizes to its branch if it has the most
+// chainwork, in a single database transaction so that the stored block and the tip
+// never disagree. It returns how the tip changed, or nil if it did not. The caller holds mu
+func (chain *BlockChain) acceptBlock(block *Block) (*TipChange, error) {
+	var change *TipChange
+	var invalid [][]byte
+
+	err := chain.Database.Update(func(txn storage.Txn) error {
+		work, err := storeBlock(txn, block, chain.Consensus.Weight(block))
+		if err != nil {
+			return err
+		}
+		if chain.LastHash != nil {
+			tipWork, err := getWork(txn, chain.LastHash)
+			if err != nil {
+				return err
+			}
+			if work.Cmp(tipWork) <= 0 {
+				// the block is on a branch with less work, it is kept without touching the tip
+				return nil
+			}
+		}
+
+		change, invalid, err = reorganize(txn, block, chain.LastHash)
+
+		return err
+	})
+	if invalid != nil {
+		// the block is discarded with the transaction, the invalid blocks stored
+		// before it are dropped so that their branch is not tried again
+		dropErr := chain.Database.Update(func(txn storage.Txn) error {
+			for _, hash := range invalid {
+				if err := txn.Delete(blockKey(hash)); err != nil {
+					return err
+				}
+				if err := txn.Delete(workKey(hash)); err != nil {
+					return err
+				}
+			}
 
-	// Getting the last hash and creating a new block
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		errors.HandleErr(err)
-		err = item.Value(func(val []byte) error {
-			lastHash = val
 			return nil
 		})
+		if dropErr != nil {
+			return nil, dropErr
+		}
+	}
+	if err != nil || change == nil {
+		return nil, err
+	}
+	chain.LastHash = block.Hash
+
+	return change, nil
+}
+
+// validateBlock checks the block without looking at the outputs its transactions
+// spend: its previous block must be known, its height must follow it, its timestamp
+// must be after the median time past of the previous blocks and its seal, merkle
+// root, timestamp and coinbase must be valid. The
+// transactions are checked when the block is connected to the main chain
+func (chain *BlockChain) validateBlock(block *Block) error {
+	if len(block.PrevHash) == 0 {
+		if chain.GetLastHash() != nil || block.Height != 0 {
+			return errors.NewInvalidBlockError(block.Hash, "the chain already has a genesis block")
+		}
+	} else {
+		parent, err := chain.GetBlock(block.PrevHash)
+		if err != nil {
+			return errors.NewInvalidBlockError(block.Hash, "its previous block is unknown")
+		}
+		if block.Height != parent.Height+1 {
+			return errors.NewInvalidBlockError(block.Hash, "the height does not follow the previous block")
+		}
+
+		if block.Version >= medianTimeVersion {
+			mtp, err := chain.MedianTimePast(block.PrevHash)
+			if err != nil {
+				return err
+			}
+			if block.Timestamp <= mtp {
+				return errors.NewInvalidBlockError(block.Hash, "its timestamp is not after the median time past of the previous blocks")
+			}
+		}
+	}
+
+	if err := chain.Consensus.VerifyHeader(chain, block); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return errors.NewInvalidBlockError(block.Hash, "its merkle root does not match its transactions")
+	}
+
+	if block.Timestamp > time.Now().Add(maxFutureBlockTime).Unix() {
+		return errors.NewInvalidBlockError(block.Hash, "its timestamp is too far in the future")
+	}
+
+	if len(block.Transactions) == 0 {
+		return errors.NewInvalidBlockError(block.Hash, "it has no transactions")
+	}
+
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() && i != 0 {
+			return errors.NewInvalidBlockError(block.Hash, "only its first transaction can be a coinbase")
+		}
+	}
+	if block.Version >= coinbaseVersion && !block.Transactions[0].IsCoinbase() {
+		return errors.NewInvalidBlockError(block.Hash, "its first transaction is not a coinbase")
+	}
+
+	return nil
+}
+
+// HasBlock checks if a block with the given hash is stored in the database
+func (chain *BlockChain) HasBlock(hash []byte) bool {
+	err := chain.Database.View(func(txn storage.Txn) error {
+		_, err := txn.Get(blockKey(hash))
 		return err
 	})
-	errors.HandleErr(err)
-	newBlock := CreateBlock(transactions, lastHash)
-
-	// Updating the last hash key
-	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, newBlock.Serialize())
-		errors.HandleErr(err)
-		err = txn.Set([]byte("lh"), newBlock.Hash)
-		chain.LastHash = newBlock.Hash
+
+	return err == nil
+}
+
+// GetBlock returns the block with the given hash
+func (chain *BlockChain) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		var err error
+		block, err = getBlock(txn, hash)
+
 		return err
 	})
+
+	return block, err
+}
+
+// GetBestHeight returns the height of the last block, or -1 for a chain without blocks
+func (chain *BlockChain) GetBestHeight() (int, error) {
+	lastHash := chain.GetLastHash()
+	if lastHash == nil {
+		return -1, nil
+	}
+
+	block, err := chain.GetBlock(lastHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return block.Height, nil
+}
+
+// GetBlockHashes returns the hashes of the blocks that come after the block with
+// hash from, ordered from the oldest to the newest. If from is not part of the
+// chain the hashes of all the blocks are returned
+func (chain *BlockChain) GetBlockHashes(from []byte) ([][]byte, error) {
+	var hashes [][]byte
+
+	if chain.GetLastHash() == nil {
+		return hashes, nil
+	}
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		start := 0
+		if fromBlock, err := getBlock(txn, from); err == nil {
+			// from may be a block of a side branch, which is not indexed
+			hash, err := getHashByHeight(txn, fromBlock.Height)
+			if err == nil && bytes.Equal(hash, from) {
+				start = fromBlock.Height + 1
+			}
+		}
+
+		for height := start; ; height++ {
+			hash, err := getHashByHeight(txn, height)
+			if errors.Is(err, errors.ErrBlockNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			hashes = append(hashes, hash)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
 }
 
-// FindUnspentTransactions finds all the unspent transactions for the given hashed public key
-func (chain *BlockChain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
-	var unspentTxs []Transaction
+// getBlock reads the block with the given hash, failing with ErrBlockNotFound if there is none
+func getBlock(txn storage.Txn, hash []byte) (*Block, error) {
+	encodedBlock, err := txn.Get(blockKey(hash))
+	if err == storage.ErrNotFound {
+		return nil, errors.NewBlockNotFoundError(hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return Deserialize(encodedBlock)
+}
 
+// FindUTXO walks the whole chain and returns all the unspent transaction outputs
+// keyed by the ID of the transaction they belong to. It is used to build the UTXOSet
+func (chain *BlockChain) FindUTXO() (map[string]TxOutputs, error) {
+	UTXO := make(map[string]TxOutputs)
 	spentTXOs := make(map[string][]int)
 
 	iter := chain.Iterator()
 
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
 
-		for _, tx := range block.Transactions {
+		// the blocks are walked from the tip, so the transactions of a block are
+		// walked backwards too, seeing the spends of an output before the output
+		for i := len(block.Transactions) - 1; i >= 0; i-- {
+			tx := block.Transactions[i]
 			txID := hex.EncodeToString(tx.ID)
 
 		Outputs:
@@ -153,17 +500,19 @@ func (chain *BlockChain) FindUnspentTransactions(pubKeyHash []byte) []Transactio
 						}
 					}
 				}
-				if out.IsLockedWithKey(pubKeyHash) {
-					unspentTxs = append(unspentTxs, *tx)
+
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = TxOutputs{Outputs: make(map[int]TxOutput), Height: block.Height}
+					UTXO[txID] = outs
 				}
+				outs.Outputs[outIdx] = out
 			}
 
-			if !tx.isCoinbase() {
+			if !tx.IsCoinbase() {
 				for _, in := range tx.Inputs {
-					if in.UsesKey(pubKeyHash) {
-						inTxID := hex.EncodeToString(in.ID)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
-					}
+					inTxID := hex.EncodeToString(in.ID)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
 				}
 			}
 		}
@@ -172,54 +521,61 @@ func (chain *BlockChain) FindUnspentTransactions(pubKeyHash []byte) []Transactio
 			break
 		}
 	}
-	return unspentTxs
+	return UTXO, nil
 }
 
-// FindUTXO finds all the unspent transaction outputs for a given address
-func (chain *BlockChain) FindUTXO(pubKeyHash []byte) (UTXOs []TxOutput) {
-	unspentTransactions := chain.FindUnspentTransactions(pubKeyHash)
+// FindUsedPubKeyHashes returns the hex encoded public key hashes that received an output in the chain
+func (chain *BlockChain) FindUsedPubKeyHashes() (map[string]bool, error) {
+	used := make(map[string]bool)
 
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) {
-				UTXOs = append(UTXOs, out)
-			}
+	iter := chain.Iterator()
+	for {
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	return UTXOs
-}
-
-// FindSpendableOutputs finds the spendable outputs for the given address
-func (chain *BlockChain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOuts := make(map[string][]int)
-	unspentTxs := chain.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
-
-Work:
-	for _, tx := range unspentTxs {
-		txID := hex.EncodeToString(tx.ID)
 
-		for outIdx, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
-
-				if accumulated >= amount {
-					break Work
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				if pubKeyHash, ok := out.PubKeyHash(); ok {
+					used[hex.EncodeToString(pubKeyHash)] = true
 				}
 			}
 		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
 	}
 
-	return accumulated, unspentOuts
+	return used, nil
 }
 
-// FindTransaction tries to finds the transaction with the passed in ID
+// FindTransaction tries to finds the transaction with the passed in ID.
+// It looks it up in the transaction index if it is enabled, and walks the chain otherwise
 func (chain *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
+	var tx Transaction
+	indexed := false
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		var err error
+		if indexed, err = txIndexEnabled(txn); err != nil || !indexed {
+			return err
+		}
+		tx, err = findIndexedTransaction(txn, ID)
+
+		return err
+	})
+	if indexed || err != nil {
+		return tx, err
+	}
+
 	iter := chain.Iterator()
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			return Transaction{}, err
+		}
 
 		for _, tx := range block.Transactions {
 			if bytes.Compare(tx.ID, ID) == 0 {
@@ -235,27 +591,69 @@ func (chain *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
 }
 
 // SignTransaction signs the passed in transaction with the passed in private key
-func (chain *BlockChain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
-	prevTXs := make(map[string]Transaction)
+func (chain *BlockChain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
+	prevTXs, err := chain.findPrevTransactions(tx)
+	if err != nil {
+		return err
+	}
 
-	for _, in := range tx.Inputs {
-		prevTX, err := chain.FindTransaction(in.ID)
-		errors.HandleErr(err)
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	return tx.Sign(privKey, prevTXs)
+}
+
+// VerifyTransaction verifies the validity of the passed in transaction. It fails
+// with ErrTransactionNotFound if the transaction spends outputs of unknown
+// transactions, with ErrInvalidTransaction if it creates more value than it
+// spends and with ErrInvalidSignature if it is not correctly signed
+func (chain *BlockChain) VerifyTransaction(tx *Transaction) error {
+	_, err := chain.verifyTransaction(tx)
+
+	return err
+}
+
+// TransactionFee returns the fee of the transaction, see Transaction.Fee
+func (chain *BlockChain) TransactionFee(tx *Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	prevTXs, err := chain.findPrevTransactions(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return tx.Fee(prevTXs)
+}
+
+// verifyTransaction verifies the transaction like VerifyTransaction and returns its fee
+func (chain *BlockChain) verifyTransaction(tx *Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	prevTXs, err := chain.findPrevTransactions(tx)
+	if err != nil {
+		return 0, err
 	}
 
-	tx.Sign(privKey, prevTXs)
+	fee, err := tx.Fee(prevTXs)
+	if err != nil {
+		return 0, err
+	}
+
+	return fee, tx.Verify(prevTXs)
 }
 
-// VerifyTransaction verifies the validity of the passed in transaction
-func (chain *BlockChain) VerifyTransaction(tx *Transaction) bool {
+// findPrevTransactions returns the transactions whose outputs are spent by tx, keyed by their ID
+func (chain *BlockChain) findPrevTransactions(tx *Transaction) (map[string]Transaction, error) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
 		prevTX, err := chain.FindTransaction(in.ID)
-		errors.HandleErr(err)
+		if err != nil {
+			return nil, err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	return tx.Verify(prevTXs)
+	return prevTXs, nil
 }
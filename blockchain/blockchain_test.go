@@ -0,0 +1,173 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/hex"
+	"go-blockchain/config"
+	"go-blockchain/storage"
+	"go-blockchain/wallet"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// blocks are sealed instantly on regtest
+	if err := config.SelectNetwork(config.Regtest.Name); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// newWallet returns a wallet holding a new key
+func newWallet(t testing.TB) *wallet.Wallet {
+	t.Helper()
+
+	w, err := wallet.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+// newTestChain returns a chain in memory whose genesis block pays w
+func newTestChain(t testing.TB, w *wallet.Wallet) *BlockChain {
+	t.Helper()
+
+	engine, err := NewConsensus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := InitBlockChain(string(w.Address()), storage.NewMemory(), engine, PoWOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chain
+}
+
+// tip returns the last block of the main chain
+func tip(t testing.TB, chain *BlockChain) *Block {
+	t.Helper()
+
+	block, err := chain.GetBlock(chain.GetLastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// newBlock seals a block on top of parent with a coinbase paying miner followed
+// by the transactions, without adding it to the chain
+func newBlock(t *testing.T, chain *BlockChain, parent *Block, miner *wallet.Wallet, txs ...*Transaction) *Block {
+	t.Helper()
+
+	coinbase, err := CoinBaseTx(string(miner.Address()), "", parent.Height+1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := CreateBlock(context.Background(), chain.Consensus, chain, append([]*Transaction{coinbase}, txs...), parent.Hash, parent.Height+1, PoWOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// addBlock adds a new block on top of parent to the chain, see newBlock
+func addBlock(t *testing.T, chain *BlockChain, parent *Block, miner *wallet.Wallet, txs ...*Transaction) *Block {
+	t.Helper()
+
+	block := newBlock(t, chain, parent, miner, txs...)
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// send returns a transaction of w paying amount to the address of to, spending
+// the outputs of w in the UTXO set of the chain
+func send(t *testing.T, chain *BlockChain, w, to *wallet.Wallet, amount int) *Transaction {
+	t.Helper()
+
+	UTXOSet := UTXOSet{Blockchain: chain}
+	tx, err := NewTransaction(w, string(to.Address()), amount, 0, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// balance returns the value of the unspent outputs of w
+func balance(t *testing.T, chain *BlockChain, w *wallet.Wallet) int {
+	t.Helper()
+
+	lockingScript, err := wallet.AddressToScript(string(w.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	UTXOSet := UTXOSet{Blockchain: chain}
+	outputs, err := UTXOSet.FindUTXO(lockingScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, out := range outputs {
+		total += out.Value
+	}
+
+	return total
+}
+
+// checkUTXOSet checks that the UTXO set is the one built from the blocks of the main chain
+func checkUTXOSet(t *testing.T, chain *BlockChain) {
+	t.Helper()
+
+	want, err := chain.FindUTXO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]TxOutputs)
+	err = UTXOSet{Blockchain: chain}.forEach(func(txID string, outs TxOutputs) bool {
+		got[txID] = outs
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("the UTXO set has %d transactions, the main chain has %d", len(got), len(want))
+	}
+}
+
+// hasUndo tells if the undo data of the block is stored
+func hasUndo(t *testing.T, chain *BlockChain, block *Block) bool {
+	t.Helper()
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		_, err := txn.Get(undoKey(block.Hash))
+		return err
+	})
+	if err != nil && err != storage.ErrNotFound {
+		t.Fatal(err)
+	}
+
+	return err == nil
+}
+
+// hashes returns the hex encoded hashes of the blocks
+func hashes(blocks []*Block) []string {
+	var hashes []string
+	for _, block := range blocks {
+		hashes = append(hashes, hex.EncodeToString(block.Hash))
+	}
+
+	return hashes
+}
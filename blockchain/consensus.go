@@ -0,0 +1,296 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"go-blockchain/config"
+	"go-blockchain/errors"
+	"go-blockchain/wallet"
+	"math/big"
+	"sync/atomic"
+)
+
+// Consensus is the engine deciding how the blocks of a chain are sealed and which
+// branch is the main chain. Each network runs the engine named by its Consensus
+type Consensus interface {
+	// Prepare sets the fields of the header of a new block that the engine rules,
+	// like its target. The previous block of the block is stored in chain, unless
+	// it is the genesis block
+	Prepare(chain *BlockChain, block *Block) error
+	// Seal seals the prepared block and sets its hash. Engines searching a seal do
+	// it with opts and fail with the error of ctx if ctx is done first
+	Seal(ctx context.Context, block *Block, opts PoWOptions) error
+	// VerifyHeader checks the fields ruled by the engine and the seal of the block,
+	// whose previous block is stored in chain. It fails with ErrInvalidBlock
+	VerifyHeader(chain *BlockChain, block *Block) error
+	// VerifySeal checks the seal of the block alone, which only needs its header,
+	// its hash and its signature. It fails with ErrInvalidBlock
+	VerifySeal(block *Block) error
+	// Weight returns what the block adds to the chainwork of its branch, the main
+	// chain being the branch with the most chainwork
+	Weight(block *Block) *big.Int
+}
+
+// NewConsensus returns the engine of the network the process runs. On a
+// proof-of-authority network, the blocks are sealed with the key of signer,
+// which can be nil if the node does not seal blocks
+func NewConsensus(signer *wallet.Wallet) (Consensus, error) {
+	switch params := config.Params(); params.Consensus {
+	case config.ProofOfWork:
+		return PoW{}, nil
+	case config.InstantSeal:
+		return InstantSeal{}, nil
+	case config.ProofOfAuthority:
+		if len(params.Signers) == 0 {
+			return nil, fmt.Errorf("the %s network has no signers", params.Name)
+		}
+
+		var signers [][]byte
+		for _, hexKey := range params.Signers {
+			pubKey, err := hex.DecodeString(hexKey)
+			if err != nil {
+				return nil, fmt.Errorf("signer %s of the %s network: %w", hexKey, params.Name, err)
+			}
+			signers = append(signers, pubKey)
+		}
+
+		return NewPoA(signers, signer), nil
+	default:
+		return nil, fmt.Errorf("unknown consensus %q of the %s network", params.Consensus, params.Name)
+	}
+}
+
+// PoW is the proof-of-work engine: a block is sealed by a nonce making the hash of
+// its header meet the target of its bits, which follow the retarget rule. The main
+// chain is the branch with the most work
+type PoW struct{}
+
+// Prepare sets the bits of the block
+func (PoW) Prepare(chain *BlockChain, block *Block) error {
+	if len(block.PrevHash) == 0 {
+		block.Bits = InitialBits()
+		return nil
+	}
+
+	bits, err := chain.ExpectedBits(block)
+	if err != nil {
+		return err
+	}
+	block.Bits = bits
+
+	return nil
+}
+
+// Seal searches the nonce of the block
+func (PoW) Seal(ctx context.Context, block *Block, opts PoWOptions) error {
+	nonce, hash, err := NewProof(block).Run(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	block.Nonce = nonce
+	block.Hash = hash
+
+	return nil
+}
+
+// VerifyHeader checks the bits and the proof of work of the block
+func (pow PoW) VerifyHeader(chain *BlockChain, block *Block) error {
+	expectedBits, err := chain.ExpectedBits(block)
+	if err != nil {
+		return err
+	}
+	if block.Bits != expectedBits {
+		return errors.NewInvalidBlockError(block.Hash, fmt.Sprintf("its bits are %08x, expected %08x", block.Bits, expectedBits))
+	}
+
+	return pow.VerifySeal(block)
+}
+
+// VerifySeal checks that the hash of the block meets the target of its bits
+func (PoW) VerifySeal(block *Block) error {
+	if !validTarget(block.Bits) || !bytes.Equal(NewProof(block).Hash(), block.Hash) || !meetsTarget(block.Hash, CompactToBig(block.Bits)) {
+		return errors.NewInvalidBlockError(block.Hash, fmt.Sprintf("the proof of work is not valid for the bits %08x", block.Bits))
+	}
+
+	return nil
+}
+
+// Weight returns the work of the block, see BlockWork
+func (PoW) Weight(block *Block) *big.Int {
+	return BlockWork(block.Bits)
+}
+
+// InstantSeal is the engine of the test networks: blocks are sealed right away,
+// by hashing their header, and the main chain is the longest branch
+type InstantSeal struct{}
+
+// Prepare sets nothing, the blocks have no target
+func (InstantSeal) Prepare(*BlockChain, *Block) error {
+	return nil
+}
+
+// Seal hashes the header of the block
+func (InstantSeal) Seal(_ context.Context, block *Block, opts PoWOptions) error {
+	block.Hash = block.BlockHeader.Hash()
+	if opts.Hashes != nil {
+		atomic.AddUint64(opts.Hashes, 1)
+	}
+
+	return nil
+}
+
+// VerifyHeader checks the hash of the block
+func (seal InstantSeal) VerifyHeader(_ *BlockChain, block *Block) error {
+	return seal.VerifySeal(block)
+}
+
+// VerifySeal checks the hash of the block
+func (InstantSeal) VerifySeal(block *Block) error {
+	if !bytes.Equal(block.Hash, block.BlockHeader.Hash()) {
+		return errors.NewInvalidBlockError(block.Hash, "its hash is not the hash of its header")
+	}
+
+	return nil
+}
+
+// Weight counts the blocks
+func (InstantSeal) Weight(*Block) *big.Int {
+	return big.NewInt(1)
+}
+
+// signerVersion is the first block version whose header commits to its signer,
+// and whose signer cannot have sealed one of the blocks just before it
+const signerVersion = 3
+
+// PoA is the proof-of-authority engine: a block is sealed by the signature of its
+// hash by one of the signers of the network. Like in clique, the signer whose turn
+// it is at the height of a block gives it twice the weight of the other signers,
+// so that the main chain is the branch with the most blocks sealed in turn, and a
+// signer cannot seal one of floor(N/2) blocks in a row, N being the number of
+// signers, so that the signers have to take turns
+type PoA struct {
+	// Signers are the public keys of the authorities
+	Signers [][]byte
+	// Key seals the blocks of the node, nil if the node does not seal blocks
+	Key *wallet.Wallet
+}
+
+// NewPoA returns a proof-of-authority engine with the signers, sealing with key
+func NewPoA(signers [][]byte, key *wallet.Wallet) *PoA {
+	return &PoA{Signers: signers, Key: key}
+}
+
+// Prepare checks that the key of the engine can seal the block, failing with
+// ErrSignedRecently if it sealed one of the last blocks. The blocks have no target
+func (poa *PoA) Prepare(chain *BlockChain, block *Block) error {
+	if poa.Key == nil || block.Version < signerVersion {
+		return nil
+	}
+
+	last, err := poa.lastSealed(chain, block.PrevHash, poa.Key.PublicKey)
+	if err != nil {
+		return err
+	}
+	if last >= 0 {
+		return errors.NewSignedRecentlyError(last, last+len(poa.Signers)/2+1)
+	}
+
+	return nil
+}
+
+// Seal signs the hash of the header of the block with the key of the engine. It
+// fails with ErrNotSigner if the key is not one of the signers
+func (poa *PoA) Seal(_ context.Context, block *Block, _ PoWOptions) error {
+	if poa.Key == nil {
+		return errors.NewNotSignerError("there is no key to seal blocks with")
+	}
+	if !poa.isSigner(poa.Key.PublicKey) {
+		return errors.NewNotSignerError("the key of %s is not one of the %d signers", poa.Key.Address(), len(poa.Signers))
+	}
+
+	block.Signer = poa.Key.PublicKey
+	hash := block.BlockHeader.Hash()
+	signature, err := signHash(poa.Key.PrivateKey, hash)
+	if err != nil {
+		return err
+	}
+
+	block.Hash = hash
+	block.Signature = signature
+
+	return nil
+}
+
+// VerifyHeader checks that the block is signed by one of the signers, which did
+// not seal one of the last blocks
+func (poa *PoA) VerifyHeader(chain *BlockChain, block *Block) error {
+	if err := poa.VerifySeal(block); err != nil {
+		return err
+	}
+
+	if block.Version >= signerVersion {
+		last, err := poa.lastSealed(chain, block.PrevHash, block.Signer)
+		if err != nil {
+			return err
+		}
+		if last >= 0 {
+			return errors.NewInvalidBlockError(block.Hash, fmt.Sprintf("its signer sealed block %d already", last))
+		}
+	}
+
+	return nil
+}
+
+// VerifySeal checks that the block is signed by one of the signers
+func (poa *PoA) VerifySeal(block *Block) error {
+	if !bytes.Equal(block.Hash, block.BlockHeader.Hash()) {
+		return errors.NewInvalidBlockError(block.Hash, "its hash is not the hash of its header")
+	}
+	if !poa.isSigner(block.Signer) {
+		return errors.NewInvalidBlockError(block.Hash, fmt.Sprintf("it is sealed by %x, which is not a signer", block.Signer))
+	}
+	if !verifySignature(block.Hash, block.Signature, block.Signer) {
+		return errors.NewInvalidBlockError(block.Hash, "its seal is not a valid signature")
+	}
+
+	return nil
+}
+
+// lastSealed returns the height of the last of the floor(N/2) blocks up to the
+// block with prevHash sealed by signer, or -1 if signer sealed none of them
+func (poa *PoA) lastSealed(chain *BlockChain, prevHash, signer []byte) (int, error) {
+	for i := 0; i < len(poa.Signers)/2 && len(prevHash) != 0; i++ {
+		block, err := chain.GetBlock(prevHash)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(block.Signer, signer) {
+			return block.Height, nil
+		}
+		prevHash = block.PrevHash
+	}
+
+	return -1, nil
+}
+
+// Weight is 2 for the blocks sealed in turn and 1 for the others
+func (poa *PoA) Weight(block *Block) *big.Int {
+	if len(poa.Signers) > 0 && bytes.Equal(block.Signer, poa.Signers[block.Height%len(poa.Signers)]) {
+		return big.NewInt(2)
+	}
+
+	return big.NewInt(1)
+}
+
+func (poa *PoA) isSigner(pubKey []byte) bool {
+	for _, signer := range poa.Signers {
+		if bytes.Equal(signer, pubKey) {
+			return true
+		}
+	}
+
+	return false
+}
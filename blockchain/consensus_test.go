@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"go-blockchain/errors"
+	"go-blockchain/storage"
+	"go-blockchain/wallet"
+	"testing"
+	"time"
+)
+
+// newPoAChain returns a chain in memory sealed by the first of the three signers,
+// and the engines sealing with the key of every signer
+func newPoAChain(t *testing.T) (*BlockChain, []*PoA) {
+	t.Helper()
+
+	keys := []*wallet.Wallet{newWallet(t), newWallet(t), newWallet(t)}
+	var signers [][]byte
+	for _, key := range keys {
+		signers = append(signers, key.PublicKey)
+	}
+	var engines []*PoA
+	for _, key := range keys {
+		engines = append(engines, NewPoA(signers, key))
+	}
+
+	chain, err := InitBlockChain(string(keys[0].Address()), storage.NewMemory(), engines[0], PoWOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chain, engines
+}
+
+// sealBlock creates a block with only a coinbase on top of parent sealed by engine
+func sealBlock(t *testing.T, chain *BlockChain, engine *PoA, parent *Block) (*Block, error) {
+	t.Helper()
+
+	coinbase, err := CoinBaseTx(string(engine.Key.Address()), "", parent.Height+1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return CreateBlock(context.Background(), engine, chain, []*Transaction{coinbase}, parent.Hash, parent.Height+1, PoWOptions{})
+}
+
+func TestPoASignersTakeTurns(t *testing.T) {
+	chain, engines := newPoAChain(t)
+	genesis := tip(t, chain)
+
+	// the signer of the genesis block has to wait for another signer
+	if _, err := sealBlock(t, chain, engines[0], genesis); !errors.Is(err, errors.ErrSignedRecently) {
+		t.Fatalf("sealing after the last block returned %v, expected ErrSignedRecently", err)
+	}
+
+	b1, err := sealBlock(t, chain, engines[1], genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+
+	// a block sealed without Prepare by the signer of the last block is rejected
+	coinbase, err := CoinBaseTx(string(engines[1].Key.Address()), "", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := &Block{
+		BlockHeader:  BlockHeader{Version: BlockVersion, PrevHash: b1.Hash, Timestamp: b1.Timestamp + 1, Height: 2},
+		Transactions: []*Transaction{coinbase},
+	}
+	again.MerkleRoot = again.HashTransactions()
+	if err := engines[1].Seal(context.Background(), again, PoWOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(again); !errors.Is(err, errors.ErrInvalidBlock) {
+		t.Fatalf("adding a block sealed twice in a row returned %v, expected ErrInvalidBlock", err)
+	}
+
+	// the first signer can seal again once another signer did
+	b2, err := sealBlock(t, chain, engines[0], b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(b2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chain.Verify(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoAHeaderCommitsToTheSigner(t *testing.T) {
+	chain, engines := newPoAChain(t)
+
+	block, err := sealBlock(t, chain, engines[1], tip(t, chain))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another signer cannot claim the block by signing its hash
+	block.Signer = engines[2].Key.PublicKey
+	if bytes.Equal(block.BlockHeader.Hash(), block.Hash) {
+		t.Fatal("the hash of the header does not cover its signer")
+	}
+	if block.Signature, err = signHash(engines[2].Key.PrivateKey, block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(block); !errors.Is(err, errors.ErrInvalidBlock) {
+		t.Fatalf("adding the block with another signer returned %v, expected ErrInvalidBlock", err)
+	}
+}
+
+func TestPoAMinerWaitsForTheOtherSigners(t *testing.T) {
+	chain, engines := newPoAChain(t)
+	chain.Consensus = engines[0]
+	genesis := tip(t, chain)
+
+	mempool := NewMempool(chain)
+	tx := send(t, chain, engines[0].Key, newWallet(t), 10)
+	if err := mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	miner := NewMiner(chain, string(engines[0].Key.Address()), mempool)
+	if _, err := miner.Mine(context.Background(), 1); !errors.Is(err, errors.ErrSignedRecently) {
+		t.Fatalf("mining after the last block returned %v, expected ErrSignedRecently", err)
+	}
+
+	// the waiting miner seals the transaction once another signer sealed a block
+	miner.WaitForTransactions = true
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := miner.Mine(ctx, 1)
+		done <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if height, err := chain.GetBestHeight(); err != nil || height != 0 {
+		t.Fatalf("the waiting miner reached height %d (%v)", height, err)
+	}
+	b1, err := sealBlock(t, chain, engines[1], genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	b2 := tip(t, chain)
+	if b2.Height != 2 || !bytes.Equal(b2.Signer, engines[0].Key.PublicKey) || len(b2.Transactions) != 2 {
+		t.Fatalf("the miner sealed block %d with %d transactions", b2.Height, len(b2.Transactions))
+	}
+}
@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"go-blockchain/config"
+	"math/big"
+)
+
+// Difficulty retargeting
+
+// Every RetargetInterval blocks the target is adjusted so that blocks keep being
+// found every TargetSpacing seconds on average. The new target is the old one
+// scaled by the time the last interval actually took over the time it should
+// have taken. Like in bitcoin, the adjustment is limited to a factor of 4 in
+// either direction and the target can never be easier than the proof-of-work limit.
+// The proof-of-work limit is the target of the genesis block, set by the
+// InitialDifficulty of the network. Networks with NoRetargeting keep it forever
+
+const (
+	// RetargetInterval is the number of blocks between two retargets
+	RetargetInterval = 10
+	// TargetSpacing is the number of seconds wanted between two blocks
+	TargetSpacing = 10
+	// maxAdjustment bounds how much the target can change in a single retarget
+	maxAdjustment = 4
+)
+
+// powLimit returns the highest (easiest) target allowed on the network the process runs
+func powLimit() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), 256-config.Params().InitialDifficulty)
+}
+
+// InitialBits returns the compact representation of the target of the genesis block
+func InitialBits() uint32 {
+	return BigToCompact(powLimit())
+}
+
+// ExpectedBits returns the bits the block must have to follow the retarget rule
+func (chain *BlockChain) ExpectedBits(block *Block) (uint32, error) {
+	if len(block.PrevHash) == 0 {
+		return InitialBits(), nil
+	}
+
+	parent, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return chain.NextBits(parent)
+}
+
+// NextBits returns the bits of the block coming after parent.
+// They are the bits of the parent unless the new block starts a new retarget interval
+func (chain *BlockChain) NextBits(parent *Block) (uint32, error) {
+	height := parent.Height + 1
+	if config.Params().NoRetargeting || height%RetargetInterval != 0 {
+		return parent.Bits, nil
+	}
+
+	// walking back to the first block of the interval that just ended
+	first := parent
+	for i := 0; i < RetargetInterval-1; i++ {
+		var err error
+		first, err = chain.GetBlock(first.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	expectedTimespan := int64((RetargetInterval - 1) * TargetSpacing)
+	actualTimespan := parent.Timestamp - first.Timestamp
+	if actualTimespan < expectedTimespan/maxAdjustment {
+		actualTimespan = expectedTimespan / maxAdjustment
+	}
+	if actualTimespan > expectedTimespan*maxAdjustment {
+		actualTimespan = expectedTimespan * maxAdjustment
+	}
+
+	newTarget := CompactToBig(parent.Bits)
+	newTarget.Mul(newTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(expectedTimespan))
+
+	if limit := powLimit(); newTarget.Cmp(limit) > 0 {
+		newTarget.Set(limit)
+	}
+
+	return BigToCompact(newTarget), nil
+}
+
+// ====================== COMPACT TARGETS ======================
+
+// The target is stored in blocks in the compact format of bitcoin: the most
+// significant byte is the length in bytes of the target (the exponent) and the
+// three other bytes are its most significant bytes (the mantissa). The 0x00800000
+// bit of the mantissa is the sign, which is never set for a valid target
+
+// CompactToBig converts compact bits into the target they represent
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var target *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		target = big.NewInt(int64(mantissa))
+	} else {
+		target = big.NewInt(int64(mantissa))
+		target.Lsh(target, 8*(exponent-3))
+	}
+
+	if isNegative {
+		target = target.Neg(target)
+	}
+
+	return target
+}
+
+// BigToCompact converts a target into its compact representation
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(target.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tmp := new(big.Int).Set(target)
+		mantissa = uint32(tmp.Rsh(tmp, 8*(exponent-3)).Bits()[0])
+	}
+
+	// the sign bit is set, so the mantissa is shifted to make room for it
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if target.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
+}
+
+// validTarget checks that the bits describe a positive target no easier than the limit
+func validTarget(bits uint32) bool {
+	target := CompactToBig(bits)
+
+	return target.Sign() > 0 && target.Cmp(powLimit()) <= 0
+}
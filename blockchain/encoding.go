@@ -0,0 +1,332 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"go-blockchain/errors"
+	"go-blockchain/storage"
+)
+
+// Binary encoding
+
+// Blocks and transactions are stored and sent to the peers in a deterministic
+// binary encoding, which is also what the IDs of the transactions and the proof of
+// work hash, see TxVersion and BlockVersion. The entries of the UTXO set and the
+// undo data of the blocks are stored in it too. Every encoding starts
+// with EncodingVersion as a byte, and every value has a single encoding:
+//
+//   - integers are big-endian, the signed ones in two's complement: int32 and
+//     uint32 on 4 bytes, int64 on 8 bytes. The int fields are encoded as int64
+//   - byte strings are their length as a uint32 followed by their bytes. Empty
+//     strings decode as nil
+//   - lists are their number of items as a uint32 followed by the items
+//
+// The fields are encoded in this order:
+//
+//	TxInput:     ID bytes, Out int64, ScriptSig bytes, Sequence uint32
+//	TxOutput:    Value int64, ScriptPubKey bytes
+//	Transaction: Version int32, Inputs list, Outputs list, LockTime int64
+//	BlockHeader: Version int32, PrevHash bytes, MerkleRoot bytes, Timestamp int64,
+//	             Bits uint32, Nonce int64, Height int64, followed from version 3
+//	             by Signer bytes
+//	Block:       BlockHeader without its Signer, Signer bytes, Signature bytes,
+//	             Transactions list of byte strings holding the encodings of the
+//	             transactions
+//	TxOutputs:   Height int64, Outputs list of their index as an int64 followed by
+//	             the TxOutput, by increasing index
+//	SpentOutput: TxID bytes, Out int64, Output TxOutput, Height int64
+//	undo data:   list of the lists of the SpentOutputs of every transaction
+//
+// Only the outermost value has a version byte, so the inputs of a transaction or
+// the header of a block have none, unlike the transactions of a block which are
+// whole encodings. The ID of a transaction and the hash of a block are not encoded,
+// they are computed from the rest when decoding
+
+// EncodingVersion is the first byte of the encodings
+const EncodingVersion = 1
+
+// encoder writes the binary encoding
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) writeUint32(n uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], n)
+	e.Write(buf[:])
+}
+
+func (e *encoder) writeInt64(n int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	e.Write(buf[:])
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.writeUint32(uint32(len(b)))
+	e.Write(b)
+}
+
+func (e *encoder) writeInput(in TxInput) {
+	e.writeBytes(in.ID)
+	e.writeInt64(int64(in.Out))
+	e.writeBytes(in.ScriptSig)
+	e.writeUint32(in.Sequence)
+}
+
+func (e *encoder) writeOutput(out TxOutput) {
+	e.writeInt64(int64(out.Value))
+	e.writeBytes(out.ScriptPubKey)
+}
+
+func (e *encoder) writeTransaction(tx *Transaction) {
+	e.writeUint32(uint32(tx.Version))
+	e.writeUint32(uint32(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		e.writeInput(in)
+	}
+	e.writeUint32(uint32(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		e.writeOutput(out)
+	}
+	e.writeInt64(tx.LockTime)
+}
+
+func (e *encoder) writeOutputs(outs TxOutputs) {
+	e.writeInt64(int64(outs.Height))
+
+	indexes := outs.sortedIndexes()
+	e.writeUint32(uint32(len(indexes)))
+	for _, outIdx := range indexes {
+		e.writeInt64(int64(outIdx))
+		e.writeOutput(outs.Outputs[outIdx])
+	}
+}
+
+func (e *encoder) writeSpentOutput(spent SpentOutput) {
+	e.writeBytes(spent.TxID)
+	e.writeInt64(int64(spent.Out))
+	e.writeOutput(spent.Output)
+	e.writeInt64(int64(spent.Height))
+}
+
+func (e *encoder) writeHeader(h *BlockHeader) {
+	e.writeUint32(uint32(h.Version))
+	e.writeBytes(h.PrevHash)
+	e.writeBytes(h.MerkleRoot)
+	e.writeInt64(h.Timestamp)
+	e.writeUint32(h.Bits)
+	e.writeInt64(int64(h.Nonce))
+	e.writeInt64(int64(h.Height))
+}
+
+// decoder reads the binary encoding. Once it fails it reads zero values and
+// keeps the first error
+type decoder struct {
+	data []byte
+	err  error
+}
+
+// newDecoder returns a decoder of data, failing if data does not start with EncodingVersion
+func newDecoder(data []byte) *decoder {
+	d := &decoder{data: data}
+	if version := d.next(1); d.err == nil && version[0] != EncodingVersion {
+		d.err = fmt.Errorf("unknown encoding version %d", version[0])
+	}
+
+	return d
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data) {
+		d.err = errors.New("the encoding is truncated")
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+
+	return b
+}
+
+func (d *decoder) readUint32() uint32 {
+	b := d.next(4)
+	if d.err != nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) readInt64() int64 {
+	b := d.next(8)
+	if d.err != nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) readBytes() []byte {
+	n := d.readUint32()
+	if d.err != nil || n == 0 {
+		return nil
+	}
+	if uint64(n) > uint64(len(d.data)) {
+		d.err = errors.New("the encoding is truncated")
+		return nil
+	}
+
+	return append([]byte{}, d.next(int(n))...)
+}
+
+func (d *decoder) readInput() TxInput {
+	return TxInput{
+		ID:        d.readBytes(),
+		Out:       int(d.readInt64()),
+		ScriptSig: d.readBytes(),
+		Sequence:  d.readUint32(),
+	}
+}
+
+func (d *decoder) readOutput() TxOutput {
+	return TxOutput{
+		Value:        int(d.readInt64()),
+		ScriptPubKey: d.readBytes(),
+	}
+}
+
+// readTransaction reads a transaction, without computing its ID
+func (d *decoder) readTransaction() Transaction {
+	tx := Transaction{Version: int32(d.readUint32())}
+
+	// the counts are not trusted to allocate, every item is read before it is appended
+	for i, inputs := uint32(0), d.readUint32(); i < inputs && d.err == nil; i++ {
+		tx.Inputs = append(tx.Inputs, d.readInput())
+	}
+	for i, outputs := uint32(0), d.readUint32(); i < outputs && d.err == nil; i++ {
+		tx.Outputs = append(tx.Outputs, d.readOutput())
+	}
+	tx.LockTime = d.readInt64()
+
+	return tx
+}
+
+// readOutputs reads outputs, failing if their indexes do not increase
+func (d *decoder) readOutputs() TxOutputs {
+	outs := TxOutputs{Height: int(d.readInt64()), Outputs: make(map[int]TxOutput)}
+
+	prev := int64(-1)
+	for i, count := uint32(0), d.readUint32(); i < count && d.err == nil; i++ {
+		outIdx := d.readInt64()
+		out := d.readOutput()
+		if d.err == nil && outIdx <= prev {
+			d.err = fmt.Errorf("output %d follows output %d", outIdx, prev)
+		}
+		outs.Outputs[int(outIdx)] = out
+		prev = outIdx
+	}
+
+	return outs
+}
+
+func (d *decoder) readSpentOutput() SpentOutput {
+	return SpentOutput{
+		TxID:   d.readBytes(),
+		Out:    int(d.readInt64()),
+		Output: d.readOutput(),
+		Height: int(d.readInt64()),
+	}
+}
+
+func (d *decoder) readHeader() BlockHeader {
+	return BlockHeader{
+		Version:    int32(d.readUint32()),
+		PrevHash:   d.readBytes(),
+		MerkleRoot: d.readBytes(),
+		Timestamp:  d.readInt64(),
+		Bits:       d.readUint32(),
+		Nonce:      int(d.readInt64()),
+		Height:     int(d.readInt64()),
+	}
+}
+
+// finish fails if there is data left after the decoded value
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.err = fmt.Errorf("%d bytes are left after the encoding", len(d.data))
+	}
+
+	return d.err
+}
+
+// migrateEncoding re-encodes the blocks stored with gob, before the binary
+// encoding. The blocks keep their hashes and the IDs of their transactions, see
+// TxVersion and BlockVersion
+func migrateEncoding(db storage.Store) error {
+	hashes, err := storedBlockHashes(db)
+	if err != nil {
+		return err
+	}
+
+	batch := db.NewBatch()
+	for _, hash := range hashes {
+		if err := migrateBlock(db, batch, hash); err != nil {
+			batch.Cancel()
+			return err
+		}
+	}
+
+	return batch.Flush()
+}
+
+// gobBlock is the layout of the blocks encoded with gob, whose signer was not
+// part of the header
+type gobBlock struct {
+	BlockHeader
+	Hash         []byte
+	Transactions []*Transaction
+	Signer       []byte
+	Signature    []byte
+}
+
+// migrateBlock writes the block with the given hash to batch in the binary
+// encoding, unless an interrupted migration already did it
+func migrateBlock(db storage.Store, batch storage.Batch, hash []byte) error {
+	var encoded []byte
+	err := db.View(func(txn storage.Txn) error {
+		var err error
+		encoded, err = txn.Get(hash)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := Deserialize(encoded); err == nil {
+		return nil
+	}
+
+	var legacy gobBlock
+	if err := gob.NewDecoder(bytes.NewReader(encoded)).Decode(&legacy); err != nil {
+		return fmt.Errorf("block %x cannot be decoded: %w", hash, err)
+	}
+	block := Block{BlockHeader: legacy.BlockHeader, Transactions: legacy.Transactions, Signature: legacy.Signature}
+	block.Signer = legacy.Signer
+
+	// the hashes computed when decoding have to be the stored ones
+	migrated, err := Deserialize(block.Serialize())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(migrated.Hash, hash) || !bytes.Equal(migrated.HashTransactions(), block.MerkleRoot) {
+		return fmt.Errorf("block %x changes once encoded, it cannot be migrated", hash)
+	}
+
+	return batch.Put(hash, block.Serialize())
+}
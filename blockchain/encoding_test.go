@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encodingSeeds adds the encodings of a chain with a transfer to the corpus
+func encodingSeeds(f *testing.F, encode func(block *Block) [][]byte) {
+	w, to := newWallet(f), newWallet(f)
+	chain := newTestChain(f, w)
+	genesis := tip(f, chain)
+
+	UTXOSet := UTXOSet{Blockchain: chain}
+	tx, err := NewTransaction(w, string(to.Address()), 30, 1, 0, &UTXOSet)
+	if err != nil {
+		f.Fatal(err)
+	}
+	block := &Block{
+		BlockHeader:  BlockHeader{Version: BlockVersion, PrevHash: genesis.Hash, Height: 1},
+		Transactions: append(genesis.Transactions, tx),
+	}
+
+	for _, b := range []*Block{genesis, block} {
+		for _, seed := range encode(b) {
+			f.Add(seed)
+		}
+	}
+	f.Add([]byte{})
+	f.Add([]byte{EncodingVersion})
+}
+
+func FuzzDeserializeTransaction(f *testing.F) {
+	encodingSeeds(f, func(block *Block) [][]byte {
+		var seeds [][]byte
+		for _, tx := range block.Transactions {
+			seeds = append(seeds, tx.Serialize())
+		}
+		return seeds
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tx, err := DeserializeTransaction(data)
+		if err != nil {
+			return
+		}
+		if encoded := tx.Serialize(); !bytes.Equal(encoded, data) {
+			t.Fatalf("%x is encoded again as %x", data, encoded)
+		}
+		if decoded, err := DeserializeTransaction(tx.Serialize()); err != nil || !bytes.Equal(decoded.ID, tx.ID) {
+			t.Fatalf("the ID changes from %x to %x (%v) once encoded again", tx.ID, decoded.ID, err)
+		}
+	})
+}
+
+func FuzzDeserializeBlock(f *testing.F) {
+	encodingSeeds(f, func(block *Block) [][]byte {
+		return [][]byte{block.Serialize()}
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		block, err := Deserialize(data)
+		if err != nil {
+			return
+		}
+		if encoded := block.Serialize(); !bytes.Equal(encoded, data) {
+			t.Fatalf("%x is encoded again as %x", data, encoded)
+		}
+		if decoded, err := Deserialize(block.Serialize()); err != nil || !bytes.Equal(decoded.Hash, block.Hash) {
+			t.Fatalf("the hash changes from %x to %x (%v) once encoded again", block.Hash, decoded.Hash, err)
+		}
+	})
+}
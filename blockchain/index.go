@@ -0,0 +1,84 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"go-blockchain/errors"
+
+	"go-blockchain/storage"
+)
+
+// Height index
+
+// Every block of the main chain is indexed by its height, so that blocks can be
+// looked up by height without walking the chain from its tip. The key of a block
+// is heightPrefix followed by its height as 8 big-endian bytes and its value is
+// the hash of the block
+
+// heightPrefix is prepended to the height of every entry of the height index
+var heightPrefix = []byte("h-")
+
+func heightKey(height int) []byte {
+	key := make([]byte, len(heightPrefix)+8)
+	copy(key, heightPrefix)
+	binary.BigEndian.PutUint64(key[len(heightPrefix):], uint64(height))
+
+	return key
+}
+
+// getHashByHeight reads the hash of the block of the main chain at the height,
+// failing with ErrBlockNotFound if there is none
+func getHashByHeight(txn storage.Txn, height int) ([]byte, error) {
+	if height < 0 {
+		return nil, errors.NewBlockHeightNotFoundError(height)
+	}
+
+	hash, err := txn.Get(heightKey(height))
+	if err == storage.ErrNotFound {
+		return nil, errors.NewBlockHeightNotFoundError(height)
+	}
+
+	return hash, err
+}
+
+// GetBlockByHeight returns the block of the main chain at the height.
+// It fails with ErrBlockNotFound if the chain is not that long
+func (chain *BlockChain) GetBlockByHeight(height int) (*Block, error) {
+	var block *Block
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		hash, err := getHashByHeight(txn, height)
+		if err != nil {
+			return err
+		}
+		block, err = getBlock(txn, hash)
+
+		return err
+	})
+
+	return block, err
+}
+
+// GetBlockHashByHeight returns the hash of the block of the main chain at the height.
+// It fails with ErrBlockNotFound if the chain is not that long
+func (chain *BlockChain) GetBlockHashByHeight(height int) ([]byte, error) {
+	var hash []byte
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		var err error
+		hash, err = getHashByHeight(txn, height)
+
+		return err
+	})
+
+	return hash, err
+}
+
+// GetBlockCount returns the number of blocks of the main chain, genesis block included
+func (chain *BlockChain) GetBlockCount() (int, error) {
+	height, err := chain.GetBestHeight()
+	if err != nil {
+		return 0, err
+	}
+
+	return height + 1, nil
+}
@@ -0,0 +1,257 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"go-blockchain/errors"
+	"sort"
+	"sync"
+)
+
+// Mempool holds the valid transactions that are waiting to be mined.
+// It indexes the outputs spent by the pending transactions so that two
+// transactions spending the same output can never be pending at the same time
+type Mempool struct {
+	chain  *BlockChain
+	txs    map[string]*Transaction
+	fees   map[string]int    // ID -> fee of the pending transaction
+	order  []string          // IDs of the transactions in arrival order
+	spends map[string]string // spent output -> ID of the pending transaction spending it
+	mu     sync.Mutex
+}
+
+// NewMempool creates an empty pool for transactions spending outputs of chain
+func NewMempool(chain *BlockChain) *Mempool {
+	return &Mempool{
+		chain:  chain,
+		txs:    make(map[string]*Transaction),
+		fees:   make(map[string]int),
+		spends: make(map[string]string),
+	}
+}
+
+// outpoint identifies an output by the ID of its transaction and its index
+func outpoint(txID []byte, out int) string {
+	return fmt.Sprintf("%x:%d", txID, out)
+}
+
+// Add validates the transaction and adds it to the pool.
+// The transaction must be valid, spend only unspent outputs of the chain
+// and not spend an output already spent by a pending transaction. It may still
+// be locked, Batch holds it back until its lock times are reached
+func (mp *Mempool) Add(tx *Transaction) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	txID := hex.EncodeToString(tx.ID)
+	if _, ok := mp.txs[txID]; ok {
+		return nil
+	}
+
+	fee, err := mp.validate(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, in := range tx.Inputs {
+		mp.spends[outpoint(in.ID, in.Out)] = txID
+	}
+	mp.txs[txID] = tx
+	mp.fees[txID] = fee
+	mp.order = append(mp.order, txID)
+
+	return nil
+}
+
+// validate validates the transaction and returns its fee
+func (mp *Mempool) validate(tx *Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, errors.NewInvalidTransactionError(tx.ID)
+	}
+
+	for _, in := range tx.Inputs {
+		if spender, ok := mp.spends[outpoint(in.ID, in.Out)]; ok {
+			return 0, errors.NewDoubleSpendError(tx.ID, in.ID, in.Out, spender)
+		}
+	}
+
+	return mp.validateAgainstChain(tx)
+}
+
+// validateAgainstChain checks that the transaction only spends unspent outputs of the chain
+// and that it is valid. It returns the fee of the transaction
+func (mp *Mempool) validateAgainstChain(tx *Transaction) (int, error) {
+	UTXOSet := UTXOSet{Blockchain: mp.chain}
+	for _, in := range tx.Inputs {
+		_, ok, err := UTXOSet.FindOutput(in.ID, in.Out)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errors.NewDoubleSpendError(tx.ID, in.ID, in.Out, "the chain")
+		}
+	}
+
+	return mp.chain.verifyTransaction(tx)
+}
+
+// Has checks if the transaction with the given ID is pending
+func (mp *Mempool) Has(ID []byte) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	_, ok := mp.txs[hex.EncodeToString(ID)]
+	return ok
+}
+
+// Get returns the pending transaction with the given ID
+func (mp *Mempool) Get(ID []byte) (*Transaction, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	tx, ok := mp.txs[hex.EncodeToString(ID)]
+	return tx, ok
+}
+
+// Count returns the number of pending transactions
+func (mp *Mempool) Count() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return len(mp.txs)
+}
+
+// IsSpent checks if the output is spent by a pending transaction
+func (mp *Mempool) IsSpent(txID []byte, out int) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	_, ok := mp.spends[outpoint(txID, out)]
+	return ok
+}
+
+// Batch returns the pending transactions with the highest fee per byte whose
+// sizes add up to at most maxSize bytes, along with the sum of their fees.
+// Transactions with the same fee rate are taken oldest first. Transactions that
+// are no longer valid against the chain are dropped from the pool, and the ones
+// whose lock times do not allow them in the next block stay in it
+func (mp *Mempool) Batch(maxSize int) ([]*Transaction, int) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	ids := append([]string{}, mp.order...)
+	sizes := make(map[string]int)
+	for _, txID := range ids {
+		sizes[txID] = mp.txs[txID].Size()
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		// fee_i / size_i > fee_j / size_j without dividing
+		return mp.fees[ids[i]]*sizes[ids[j]] > mp.fees[ids[j]]*sizes[ids[i]]
+	})
+
+	var txs []*Transaction
+	size, fees := 0, 0
+	for _, txID := range ids {
+		if size+sizes[txID] > maxSize {
+			// a smaller transaction with a lower fee rate may still fit
+			continue
+		}
+
+		tx := mp.txs[txID]
+		fee, err := mp.validateAgainstChain(tx)
+		if err != nil {
+			mp.remove(txID)
+			continue
+		}
+		if err := mp.chain.CheckLocks(tx); err != nil {
+			if !errors.Is(err, errors.ErrLockedTransaction) {
+				mp.remove(txID)
+			}
+			continue
+		}
+
+		txs = append(txs, tx)
+		size += sizes[txID]
+		fees += fee
+	}
+
+	return txs, fees
+}
+
+// BlockTransactions returns the transactions of the next block: a coinbase paying
+// the subsidy and the fees to minerAddress followed by a batch of pending
+// transactions of at most maxSize bytes
+func (mp *Mempool) BlockTransactions(minerAddress string, maxSize int) ([]*Transaction, error) {
+	bestHeight, err := mp.chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	txs, fees := mp.Batch(maxSize)
+
+	cbTx, err := CoinBaseTx(minerAddress, "", bestHeight+1, fees)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*Transaction{cbTx}, txs...), nil
+}
+
+// RemoveBlock removes the transactions of block from the pool, along with the
+// pending transactions spending the same outputs as the block
+func (mp *Mempool) RemoveBlock(block *Block) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		mp.remove(hex.EncodeToString(tx.ID))
+
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if spender, ok := mp.spends[outpoint(in.ID, in.Out)]; ok {
+				mp.remove(spender)
+			}
+		}
+	}
+}
+
+// UpdateTip updates the pool after a change of the tip of the chain: the
+// transactions of the connected blocks leave the pool and the transactions of the
+// disconnected blocks that are still valid come back to it
+func (mp *Mempool) UpdateTip(change *TipChange) {
+	for _, block := range change.Connected {
+		mp.RemoveBlock(block)
+	}
+
+	// from the oldest disconnected block, so that the transactions come back in order
+	for i := len(change.Disconnected) - 1; i >= 0; i-- {
+		for _, tx := range change.Disconnected[i].Transactions {
+			if !tx.IsCoinbase() {
+				// transactions conflicting with the new main chain are dropped
+				_ = mp.Add(tx)
+			}
+		}
+	}
+}
+
+// remove drops the transaction and its spends from the pool
+func (mp *Mempool) remove(txID string) {
+	tx, ok := mp.txs[txID]
+	if !ok {
+		return
+	}
+
+	for _, in := range tx.Inputs {
+		delete(mp.spends, outpoint(in.ID, in.Out))
+	}
+	delete(mp.txs, txID)
+	delete(mp.fees, txID)
+
+	for i, id := range mp.order {
+		if id == txID {
+			mp.order = append(mp.order[:i], mp.order[i+1:]...)
+			break
+		}
+	}
+}
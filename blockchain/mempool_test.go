@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"go-blockchain/errors"
+	"go-blockchain/wallet"
+	"reflect"
+	"testing"
+)
+
+// pay returns a transaction of w paying amount to the address of to with a fee,
+// locked until lockTime if it is not 0
+func pay(t *testing.T, chain *BlockChain, w, to *wallet.Wallet, amount, fee int, lockTime int64) *Transaction {
+	t.Helper()
+
+	UTXOSet := UTXOSet{Blockchain: chain}
+	tx, err := NewTransaction(w, string(to.Address()), amount, fee, lockTime, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// ids returns the IDs of the transactions
+func ids(txs []*Transaction) [][]byte {
+	var ids [][]byte
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+	}
+
+	return ids
+}
+
+func TestMempoolRejectsDoubleSpendsAndMissingInputs(t *testing.T) {
+	w, to := newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	mempool := NewMempool(chain)
+
+	tx := send(t, chain, w, to, 30)
+	if err := mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := mempool.Add(tx); err != nil || mempool.Count() != 1 {
+		t.Fatalf("adding the transaction again returned %v and left %d transactions", err, mempool.Count())
+	}
+	if !mempool.IsSpent(tx.Inputs[0].ID, tx.Inputs[0].Out) {
+		t.Fatal("the output spent by the pending transaction is not marked as spent")
+	}
+
+	// the same output paid to someone else
+	conflict := send(t, chain, w, newWallet(t), 20)
+	if err := mempool.Add(conflict); !errors.Is(err, errors.ErrDoubleSpend) {
+		t.Fatalf("adding a double spend returned %v, expected ErrDoubleSpend", err)
+	}
+
+	// an output the chain does not have
+	missing := &Transaction{
+		Version: TxVersion,
+		Inputs:  []TxInput{{ID: make([]byte, 32), Out: 0, Sequence: SequenceFinal}},
+		Outputs: tx.Outputs,
+	}
+	if _, err := rand.Read(missing.Inputs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	missing.SetID()
+	if err := mempool.Add(missing); !errors.Is(err, errors.ErrDoubleSpend) {
+		t.Fatalf("adding a transaction spending a missing output returned %v, expected ErrDoubleSpend", err)
+	}
+
+	coinbase, err := CoinBaseTx(string(w.Address()), "", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mempool.Add(coinbase); !errors.Is(err, errors.ErrInvalidTransaction) {
+		t.Fatalf("adding a coinbase returned %v, expected ErrInvalidTransaction", err)
+	}
+
+	for _, rejected := range []*Transaction{conflict, missing, coinbase} {
+		if mempool.Has(rejected.ID) {
+			t.Fatalf("the rejected transaction %x is pending", rejected.ID)
+		}
+	}
+	if mempool.Count() != 1 {
+		t.Fatalf("the pool has %d transactions, expected 1", mempool.Count())
+	}
+}
+
+func TestMempoolBatch(t *testing.T) {
+	a, b, c, d, to := newWallet(t), newWallet(t), newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, a)
+	parent := tip(t, chain)
+	for _, miner := range []*wallet.Wallet{b, c, d} {
+		parent = addBlock(t, chain, parent, miner)
+	}
+	mempool := NewMempool(chain)
+
+	low := pay(t, chain, a, to, 10, 1, 0)
+	high := pay(t, chain, b, to, 10, 10, 0)
+	middle := pay(t, chain, c, to, 10, 5, 0)
+	locked := pay(t, chain, d, to, 10, 20, int64(parent.Height+10))
+	for _, tx := range []*Transaction{low, high, middle, locked} {
+		if err := mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the highest fee rates first, without the locked transaction
+	txs, fees := mempool.Batch(MaxBlockSize)
+	if got, want := ids(txs), ids([]*Transaction{high, middle, low}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("the batch is %x, expected %x", got, want)
+	}
+	if fees != 16 {
+		t.Fatalf("the batch pays %d of fees, expected 16", fees)
+	}
+	if !mempool.Has(locked.ID) {
+		t.Fatal("the locked transaction left the pool")
+	}
+
+	// the size of the batch is capped
+	txs, fees = mempool.Batch(high.Size() + middle.Size())
+	if len(txs) != 2 || !bytes.Equal(txs[0].ID, high.ID) || !bytes.Equal(txs[1].ID, middle.ID) || fees != 15 {
+		t.Fatalf("the capped batch is %x with %d of fees, expected the 2 transactions with the highest fee rates", ids(txs), fees)
+	}
+	if txs, _ := mempool.Batch(high.Size() - 1); len(txs) != 0 {
+		t.Fatalf("the batch of %d bytes holds %d transactions", high.Size()-1, len(txs))
+	}
+
+	block, err := mempool.BlockTransactions(string(to.Address()), MaxBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block[0].IsCoinbase() || len(block) != 4 {
+		t.Fatalf("the block has %d transactions, expected a coinbase and the 3 unlocked transactions", len(block))
+	}
+	if reward, err := block[0].outputValue(); err != nil || reward != Subsidy(parent.Height+1)+16 {
+		t.Fatalf("the coinbase claims %d (%v), expected the subsidy and 16 of fees", reward, err)
+	}
+}
+
+func TestMempoolUpdateTip(t *testing.T) {
+	w, other, to, miner := newWallet(t), newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	genesis := tip(t, chain)
+	funded := addBlock(t, chain, genesis, other)
+
+	mempool := NewMempool(chain)
+	chain.Subscribe(mempool.UpdateTip)
+
+	// a mined transaction leaves the pool, and so does a pending one spending the
+	// same output as a mined transaction
+	mined := send(t, chain, w, to, 30)
+	evicted := send(t, chain, other, to, 30)
+	for _, tx := range []*Transaction{mined, evicted} {
+		if err := mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conflict := send(t, chain, other, to, 20)
+	a2 := addBlock(t, chain, funded, miner, mined, conflict)
+	if mempool.Has(mined.ID) || mempool.Has(evicted.ID) || mempool.Count() != 0 {
+		t.Fatalf("the pool still has %d transactions once they are mined", mempool.Count())
+	}
+
+	// a branch from the genesis block takes over: the transactions of the old main
+	// chain that are still valid come back to the pool, the ones spending the
+	// outputs of the disconnected blocks do not
+	b1 := addBlock(t, chain, genesis, miner)
+	b2 := addBlock(t, chain, b1, miner)
+	addBlock(t, chain, b2, miner)
+	if bytes.Equal(chain.GetLastHash(), a2.Hash) {
+		t.Fatal("the chain did not reorganize")
+	}
+	if !mempool.Has(mined.ID) {
+		t.Fatal("the transaction of the disconnected block did not come back to the pool")
+	}
+	if mempool.Has(conflict.ID) || mempool.Count() != 1 {
+		t.Fatalf("the pool has %d transactions, expected the transaction spending the genesis block", mempool.Count())
+	}
+}
@@ -0,0 +1,206 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"go-blockchain/errors"
+)
+
+const (
+	// merkleTagVersion is the first block version whose merkle tree prefixes what
+	// it hashes with merkleLeafTag or merkleInnerTag, so that an inner node cannot
+	// pass for a leaf, nor a leaf for an inner node
+	merkleTagVersion = 3
+	merkleLeafTag    = 0x00
+	merkleInnerTag   = 0x01
+
+	// maxMerkleDepth is the number of levels of hashes a proof can climb
+	maxMerkleDepth = 32
+)
+
+// MerkleTree is a binary tree of hashes built over the transactions of a block.
+// Every leaf is the hash of a transaction ID and every other node is the hash of
+// its two children, so the root commits to every transaction in the block
+type MerkleTree struct {
+	RootNode *MerkleNode
+	levels   [][]*MerkleNode // levels[0] are the leaves, the last level is the root
+}
+
+// MerkleNode is a node of a MerkleTree
+type MerkleNode struct {
+	Left  *MerkleNode
+	Right *MerkleNode
+	Data  []byte
+}
+
+// MerkleProof proves that a transaction is included in a block.
+// It carries the sibling hashes on the path from the leaf to the root, the header
+// needed to recompute the block hash from the merkle root and the signature
+// sealing it on proof-of-authority networks
+type MerkleProof struct {
+	TxID      []byte
+	Index     int      // position of the transaction in the block
+	Hashes    [][]byte // sibling hashes ordered from the leaf level up
+	Header    BlockHeader
+	Signature []byte
+}
+
+// NewMerkleNode creates a leaf node hashing data when left and right are nil,
+// otherwise an inner node hashing the data of its children, for a block of the version
+func NewMerkleNode(version int32, left, right *MerkleNode, data []byte) *MerkleNode {
+	node := MerkleNode{Left: left, Right: right}
+
+	if left == nil && right == nil {
+		node.Data = hashLeaf(version, data)
+	} else {
+		node.Data = hashPair(version, left.Data, right.Data)
+	}
+
+	return &node
+}
+
+// NewMerkleTree builds a merkle tree over data for a block of the version.
+// Like in bitcoin, the last node of a level with an odd number of nodes is paired with itself
+func NewMerkleTree(version int32, data [][]byte) *MerkleTree {
+	var nodes []*MerkleNode
+
+	for _, datum := range data {
+		nodes = append(nodes, NewMerkleNode(version, nil, nil, datum))
+	}
+
+	if len(nodes) == 0 {
+		nodes = append(nodes, NewMerkleNode(version, nil, nil, []byte{}))
+	}
+
+	levels := [][]*MerkleNode{nodes}
+
+	for len(nodes) > 1 {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
+		var level []*MerkleNode
+		for i := 0; i < len(nodes); i += 2 {
+			level = append(level, NewMerkleNode(version, nodes[i], nodes[i+1], nil))
+		}
+
+		levels = append(levels, level)
+		nodes = level
+	}
+
+	return &MerkleTree{RootNode: nodes[0], levels: levels}
+}
+
+// Proof returns the sibling hashes needed to get from the leaf at index to the root
+func (t *MerkleTree) Proof(index int) [][]byte {
+	var hashes [][]byte
+
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		hashes = append(hashes, level[sibling].Data)
+		index /= 2
+	}
+
+	return hashes
+}
+
+// MerkleProof builds an inclusion proof for the transaction with the given ID
+func (b *Block) MerkleProof(txID []byte) (*MerkleProof, error) {
+	var txIDs [][]byte
+	index := -1
+
+	for i, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			index = i
+		}
+		txIDs = append(txIDs, tx.ID)
+	}
+
+	if index == -1 {
+		return nil, errors.NewTransactionNotFoundError(txID)
+	}
+
+	tree := NewMerkleTree(b.Version, txIDs)
+
+	return &MerkleProof{
+		TxID:      txID,
+		Index:     index,
+		Hashes:    tree.Proof(index),
+		Header:    b.BlockHeader,
+		Signature: b.Signature,
+	}, nil
+}
+
+// MerkleRoot recomputes the merkle root from the transaction ID and the sibling hashes
+func (p *MerkleProof) MerkleRoot() []byte {
+	version := p.Header.Version
+	hash := NewMerkleNode(version, nil, nil, p.TxID).Data
+	index := p.Index
+
+	for _, sibling := range p.Hashes {
+		if index%2 == 0 {
+			hash = hashPair(version, hash, sibling)
+		} else {
+			hash = hashPair(version, sibling, hash)
+		}
+		index /= 2
+	}
+
+	return hash
+}
+
+// VerifyMerkleProof checks that the proof of a transaction ID, at an index its
+// path can reach, leads to the merkle root of the header of a block with the
+// given hash, whose seal is valid for the consensus of the network, i.e. that the
+// transaction is in that block
+func VerifyMerkleProof(proof *MerkleProof, blockHash []byte) bool {
+	if len(proof.TxID) != sha256.Size || len(proof.Hashes) > maxMerkleDepth {
+		return false
+	}
+	if proof.Index < 0 || uint64(proof.Index) >= 1<<uint(len(proof.Hashes)) {
+		return false
+	}
+	for _, sibling := range proof.Hashes {
+		if len(sibling) != sha256.Size {
+			return false
+		}
+	}
+	if !bytes.Equal(proof.MerkleRoot(), proof.Header.MerkleRoot) {
+		return false
+	}
+
+	engine, err := NewConsensus(nil)
+	if err != nil {
+		return false
+	}
+	block := &Block{BlockHeader: proof.Header, Hash: blockHash, Signature: proof.Signature}
+
+	return engine.VerifySeal(block) == nil
+}
+
+// hashLeaf hashes a leaf of the merkle tree of a block of the version
+func hashLeaf(version int32, data []byte) []byte {
+	if version < merkleTagVersion {
+		hash := sha256.Sum256(data)
+		return hash[:]
+	}
+
+	hash := sha256.Sum256(append([]byte{merkleLeafTag}, data...))
+
+	return hash[:]
+}
+
+// hashPair hashes an inner node of the merkle tree of a block of the version
+func hashPair(version int32, left, right []byte) []byte {
+	var data []byte
+	if version >= merkleTagVersion {
+		data = append(data, merkleInnerTag)
+	}
+	data = append(append(data, left...), right...)
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
@@ -0,0 +1,70 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVerifyMerkleProof(t *testing.T) {
+	w := newWallet(t)
+	chain := newTestChain(t, w)
+	genesis := tip(t, chain)
+
+	// three transactions, the last one being paired with itself. The block is
+	// not added to the chain, so the transactions can spend the same outputs
+	txs := []*Transaction{send(t, chain, w, newWallet(t), 10), send(t, chain, w, newWallet(t), 20)}
+	block := newBlock(t, chain, genesis, w, txs...)
+	for _, tx := range block.Transactions {
+		proof, err := block.MerkleProof(tx.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyMerkleProof(proof, block.Hash) {
+			t.Fatalf("the proof of %x is not valid", tx.ID)
+		}
+	}
+
+	proof, err := block.MerkleProof(txs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyMerkleProof(proof, genesis.Hash) {
+		t.Fatal("the proof is valid for another block")
+	}
+
+	// the index selects the side of every sibling, and cannot go beyond the levels
+	for _, index := range []int{proof.Index ^ 2, proof.Index + 1<<len(proof.Hashes), -1} {
+		forged := *proof
+		forged.Index = index
+		if VerifyMerkleProof(&forged, block.Hash) {
+			t.Fatalf("the proof is valid at index %d", index)
+		}
+	}
+
+	forged := *proof
+	forged.TxID = append(append([]byte{}, proof.TxID...), 0)
+	if VerifyMerkleProof(&forged, block.Hash) {
+		t.Fatal("the proof is valid for an ID that is not a hash")
+	}
+
+	forged = *proof
+	forged.Header.Nonce++
+	if VerifyMerkleProof(&forged, block.Hash) {
+		t.Fatal("the proof is valid for another header")
+	}
+}
+
+func TestMerkleLeavesAndInnerNodesDiffer(t *testing.T) {
+	left, right := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+
+	for _, version := range []int32{legacyBlockVersion, merkleTagVersion} {
+		leaves := NewMerkleTree(version, [][]byte{left, right}).levels[0]
+		inner := NewMerkleNode(version, leaves[0], leaves[1], nil)
+
+		// the concatenation of the leaves hashed as a leaf
+		forged := NewMerkleNode(version, nil, nil, append(append([]byte{}, leaves[0].Data...), leaves[1].Data...))
+		if tagged := version >= merkleTagVersion; bytes.Equal(inner.Data, forged.Data) == tagged {
+			t.Fatalf("version %d: the inner node and the leaf of its children hash alike: %t", version, !tagged)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+
+	"go-blockchain/storage"
+)
+
+// Database migrations
+
+// The layout of the database changed over time. databaseVersionKey holds the
+// version of the layout of a database, which is 0 if the key is missing:
+//
+//	0: the blocks are encoded with gob and stored under their hash
+//	1: the blocks are in the binary encoding, see EncodingVersion
+//	2: the blocks are stored under blockPrefix
+//	3: the UTXO set and the undo data are in the binary encoding
+//
+// OpenBlockChain migrates older databases up to DatabaseVersion, one version at
+// a time. A migration may be interrupted, it is run again the next time the chain
+// is opened and skips what it already did
+
+// DatabaseVersion is the version of the layout of the databases created by the node
+const DatabaseVersion = 3
+
+// databaseVersionKey holds the version of the layout of the database. It is named
+// after the first migration, which changed the encoding of the blocks
+var databaseVersionKey = []byte("encoding")
+
+// migrations[v] migrates a database from version v to version v+1
+var migrations = []func(db storage.Store) error{
+	migrateEncoding,
+	migrateBlockKeys,
+	migrateRecords,
+}
+
+// migrate runs the migrations the database needs to reach DatabaseVersion
+func migrate(db storage.Store) error {
+	version := 0
+	err := db.View(func(txn storage.Txn) error {
+		value, err := txn.Get(databaseVersionKey)
+		if err == storage.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(value) != 1 {
+			return fmt.Errorf("the database version %x is invalid", value)
+		}
+		version = int(value[0])
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if version > DatabaseVersion {
+		return fmt.Errorf("the database has version %d, the node only knows up to version %d", version, DatabaseVersion)
+	}
+
+	for ; version < DatabaseVersion; version++ {
+		if err := migrations[version](db); err != nil {
+			return fmt.Errorf("the database cannot be migrated to version %d: %w", version+1, err)
+		}
+
+		// the version is only written once the writes of the migration are flushed
+		err := db.Update(func(txn storage.Txn) error {
+			return txn.Put(databaseVersionKey, []byte{byte(version + 1)})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storedBlockHashes returns the hashes of the stored blocks, every one of which
+// has a chainwork. Before version 2 the blocks are stored under their bare hash,
+// so the keys of the blocks whose hash starts with workPrefix are skipped
+func storedBlockHashes(db storage.Store) ([][]byte, error) {
+	var hashes [][]byte
+
+	err := db.View(func(txn storage.Txn) error {
+		return txn.Iterate(workPrefix, func(key, _ []byte) error {
+			if len(key) == len(workPrefix)+sha256.Size {
+				hashes = append(hashes, bytes.TrimPrefix(key, workPrefix))
+			}
+			return nil
+		})
+	})
+
+	return hashes, err
+}
+
+// migrateBlockKeys moves the blocks from their bare hash to blockPrefix, so that
+// the hashes of the blocks cannot collide with the other prefixes
+func migrateBlockKeys(db storage.Store) error {
+	hashes, err := storedBlockHashes(db)
+	if err != nil {
+		return err
+	}
+
+	batch := db.NewBatch()
+	for _, hash := range hashes {
+		var encoded []byte
+		err := db.View(func(txn storage.Txn) error {
+			var err error
+			encoded, err = txn.Get(hash)
+
+			return err
+		})
+		if err == storage.ErrNotFound {
+			// an interrupted migration already moved it
+			continue
+		}
+		if err != nil {
+			batch.Cancel()
+			return err
+		}
+
+		if err := batch.Put(blockKey(hash), encoded); err != nil {
+			batch.Cancel()
+			return err
+		}
+		if err := batch.Delete(hash); err != nil {
+			batch.Cancel()
+			return err
+		}
+	}
+
+	return batch.Flush()
+}
+
+// migrateRecords re-encodes the entries of the UTXO set and the undo data of the
+// blocks, which were encoded with gob, in the binary encoding
+func migrateRecords(db storage.Store) error {
+	decoders := map[string]func(value []byte) ([]byte, error){
+		string(utxoPrefix): func(value []byte) ([]byte, error) {
+			if _, err := DeserializeOutputs(value); err == nil {
+				return nil, nil
+			}
+			var outs TxOutputs
+			if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&outs); err != nil {
+				return nil, err
+			}
+			if outs.Outputs == nil {
+				outs.Outputs = make(map[int]TxOutput)
+			}
+
+			return outs.Serialize(), nil
+		},
+		string(undoPrefix): func(value []byte) ([]byte, error) {
+			if _, err := deserializeUndo(value); err == nil {
+				return nil, nil
+			}
+			var undo [][]SpentOutput
+			if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&undo); err != nil {
+				return nil, err
+			}
+
+			return serializeUndo(undo), nil
+		},
+	}
+
+	for prefix, reencode := range decoders {
+		// the records are read before writing them, the batch may not write while
+		// the database is being read
+		records := make(map[string][]byte)
+		err := db.View(func(txn storage.Txn) error {
+			return txn.Iterate([]byte(prefix), func(key, value []byte) error {
+				migrated, err := reencode(value)
+				if err != nil {
+					return fmt.Errorf("record %q cannot be decoded: %w", key, err)
+				}
+				if migrated != nil {
+					records[string(key)] = migrated
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		batch := db.NewBatch()
+		for key, value := range records {
+			if err := batch.Put([]byte(key), value); err != nil {
+				batch.Cancel()
+				return err
+			}
+		}
+		if err := batch.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
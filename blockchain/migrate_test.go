@@ -0,0 +1,68 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"go-blockchain/storage"
+	"testing"
+)
+
+func TestMigrateRecordsFromGob(t *testing.T) {
+	w, to, miner := newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	genesis := tip(t, chain)
+	a1 := addBlock(t, chain, genesis, miner, send(t, chain, w, to, 30))
+
+	// the records as a database of version 2 stores them
+	err := chain.Database.Update(func(txn storage.Txn) error {
+		records := make(map[string]interface{})
+		err := txn.Iterate(utxoPrefix, func(key, value []byte) error {
+			outs, err := DeserializeOutputs(value)
+			records[string(key)] = outs
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		err = txn.Iterate(undoPrefix, func(key, value []byte) error {
+			undo, err := deserializeUndo(value)
+			records[string(key)] = undo
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for key, record := range records {
+			var encoded bytes.Buffer
+			if err := gob.NewEncoder(&encoded).Encode(record); err != nil {
+				return err
+			}
+			if err := txn.Put([]byte(key), encoded.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		return txn.Put(databaseVersionKey, []byte{2})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err = OpenBlockChain(chain.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := balance(t, chain, to); got != 30 {
+		t.Fatalf("the balance is %d after the migration, expected 30", got)
+	}
+	checkUTXOSet(t, chain)
+
+	// disconnecting the block reads its migrated undo data
+	b1 := addBlock(t, chain, genesis, miner)
+	addBlock(t, chain, b1, miner)
+	if got := balance(t, chain, to); got != 0 {
+		t.Fatalf("the balance is %d once %x is disconnected, expected 0", got, a1.Hash)
+	}
+	checkUTXOSet(t, chain)
+}
@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"context"
+	"go-blockchain/errors"
+	"sync"
+	"time"
+)
+
+// MaxBlockSize is the number of bytes of pending transactions mined in a single block
+const MaxBlockSize = 100000
+
+// MinerStats sums up the work of a miner
+type MinerStats struct {
+	Blocks    int           // blocks mined and added to the chain
+	Abandoned int           // blocks abandoned because the tip changed while they were mined
+	Hashes    uint64        // hashes computed
+	Elapsed   time.Duration // time spent searching proofs of work
+}
+
+// HashRate returns the average number of hashes per second
+func (s MinerStats) HashRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Hashes) / s.Elapsed.Seconds()
+}
+
+// Miner keeps mining blocks on top of the chain. Every block has a coinbase paying
+// the subsidy and the fees to Address, followed by the transactions of Mempool.
+// The block being mined is abandoned as soon as the tip of the chain changes,
+// and the next one is mined on the new tip
+type Miner struct {
+	Address string
+	// Mempool holds the transactions to mine, blocks only have a coinbase if it is nil
+	Mempool *Mempool
+	// WaitForTransactions makes the miner wait for pending transactions, see Wake,
+	// instead of mining blocks with only a coinbase. On proof-of-authority networks
+	// it also waits for the other signers to seal blocks when it sealed the last
+	// ones, instead of failing with ErrSignedRecently
+	WaitForTransactions bool
+	// HashRate, if set, receives the number of hashes per second while a block is mined
+	HashRate func(hashesPerSecond float64)
+	// Found, if set, is called with every block mined once it is added to the chain
+	Found func(*Block)
+
+	chain  *BlockChain
+	wake   chan struct{}
+	mu     sync.Mutex
+	cancel context.CancelFunc // abandons the block being mined
+}
+
+// NewMiner creates a miner of blocks on top of chain paying the rewards to address
+func NewMiner(chain *BlockChain, address string, mempool *Mempool) *Miner {
+	m := &Miner{
+		Address: address,
+		Mempool: mempool,
+		chain:   chain,
+		wake:    make(chan struct{}, 1),
+	}
+	chain.Subscribe(m.handleTipChange)
+
+	return m
+}
+
+// Wake tells a miner waiting for transactions that some may be pending
+func (m *Miner) Wake() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Mine mines blocks until ctx is done or, if blocks is not 0, until blocks blocks
+// are added to the chain. Being stopped by ctx is not an error
+func (m *Miner) Mine(ctx context.Context, blocks int) (MinerStats, error) {
+	var stats MinerStats
+
+	for blocks == 0 || stats.Blocks < blocks {
+		block, err := m.mineBlock(ctx, &stats)
+		if ctx.Err() != nil {
+			return stats, nil
+		}
+		if err == context.Canceled {
+			stats.Abandoned++
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		if block == nil {
+			select {
+			case <-ctx.Done():
+				return stats, nil
+			case <-m.wake:
+			}
+			continue
+		}
+
+		stats.Blocks++
+		if m.Found != nil {
+			m.Found(block)
+		}
+	}
+
+	return stats, nil
+}
+
+// mineBlock mines the next block and adds it to the chain. It returns a nil block
+// if the miner waits for transactions and none can be mined, or for the other
+// signers to seal blocks
+func (m *Miner) mineBlock(ctx context.Context, stats *MinerStats) (*Block, error) {
+	// cancelled from now on, so that a tip change while the block is built abandons it
+	blockCtx, cancel := context.WithCancel(ctx)
+	m.mu.Lock()
+	m.cancel = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.cancel = nil
+		m.mu.Unlock()
+		cancel()
+	}()
+
+	txs, err := m.blockTransactions()
+	if err != nil {
+		return nil, err
+	}
+	if m.WaitForTransactions && len(txs) == 1 {
+		// nothing to mine but the coinbase
+		return nil, nil
+	}
+
+	opts := m.chain.PoW
+	opts.HashRate = m.HashRate
+	opts.Hashes = &stats.Hashes
+
+	start := time.Now()
+	block, err := m.chain.mineBlock(blockCtx, txs, opts)
+	stats.Elapsed += time.Since(start)
+	if err != nil && blockCtx.Err() != nil {
+		// the transactions may have been checked against the new tip already
+		return nil, context.Canceled
+	}
+	if m.WaitForTransactions && errors.Is(err, errors.ErrSignedRecently) {
+		return nil, nil
+	}
+
+	return block, err
+}
+
+// blockTransactions returns the coinbase and the pending transactions of the next block
+func (m *Miner) blockTransactions() ([]*Transaction, error) {
+	if m.Mempool != nil {
+		return m.Mempool.BlockTransactions(m.Address, MaxBlockSize)
+	}
+
+	bestHeight, err := m.chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	cbTx, err := CoinBaseTx(m.Address, "", bestHeight+1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Transaction{cbTx}, nil
+}
+
+// handleTipChange abandons the block being mined, which no longer builds on the
+// tip, and wakes the miner waiting for the other signers
+func (m *Miner) handleTipChange(*TipChange) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.Wake()
+}
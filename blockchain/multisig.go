@@ -0,0 +1,174 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"go-blockchain/errors"
+	"go-blockchain/script"
+	"go-blockchain/wallet"
+)
+
+// Outputs sent to a multisig address pay to the hash of its redeem script, a
+// MultiSig script requiring M signatures of N public keys. Before it is
+// finalized, the unlocking script of an input spending such an output has a
+// signature slot per public key, empty until signed, followed by the redeem
+// script. Signers fill the slots of their keys, and finalizeMultiSig then keeps
+// M signatures and the redeem script, which is the unlocking script Verify
+// accepts. See PartialTransaction for the whole workflow
+
+// partialMultiSig is the unlocking script of an input spending a multisig output
+// before it is finalized
+type partialMultiSig struct {
+	required     int
+	pubKeys      [][]byte
+	signatures   [][]byte // a slot per public key, empty until signed
+	redeemScript script.Script
+}
+
+// parsePartialMultiSig parses the unlocking script of an input spending a multisig output
+func parsePartialMultiSig(unlocking script.Script) (*partialMultiSig, bool) {
+	items, err := unlocking.PushedData()
+	if err != nil || len(items) == 0 {
+		return nil, false
+	}
+
+	redeemScript := script.Script(items[len(items)-1])
+	required, pubKeys, ok := script.ExtractMultiSig(redeemScript)
+	if !ok || len(items) != len(pubKeys)+1 {
+		return nil, false
+	}
+
+	return &partialMultiSig{
+		required:     required,
+		pubKeys:      pubKeys,
+		signatures:   items[:len(pubKeys)],
+		redeemScript: redeemScript,
+	}, true
+}
+
+// count returns the number of signatures
+func (p *partialMultiSig) count() int {
+	count := 0
+	for _, signature := range p.signatures {
+		if len(signature) > 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (p *partialMultiSig) script() script.Script {
+	b := script.NewBuilder()
+	for _, signature := range p.signatures {
+		b.AddData(signature)
+	}
+
+	return b.AddData(p.redeemScript).Script()
+}
+
+// NewMultiSigTransaction creates a transaction spending the outputs of the
+// multisig address of the redeem script to send the amount to the address,
+// leaving the fee to the miner, with the lock time. Its inputs have empty signature slots.
+// It fails with an *errors.InsufficientFundsError if the address cannot pay the amount and the fee
+func NewMultiSigTransaction(redeemScript script.Script, to string, amount, fee int, lockTime int64, UTXO *UTXOSet) (*Transaction, error) {
+	required, pubKeys, ok := script.ExtractMultiSig(redeemScript)
+	if !ok {
+		return nil, errors.NewInvalidMultiSigError("%s is not a multisig redeem script", redeemScript)
+	}
+
+	tx, err := NewUnsignedTransaction(wallet.MultiSigAddress(redeemScript), to, amount, fee, lockTime, UTXO)
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned := &partialMultiSig{
+		required:     required,
+		pubKeys:      pubKeys,
+		signatures:   make([][]byte, len(pubKeys)),
+		redeemScript: redeemScript,
+	}
+	for i := range tx.Inputs {
+		tx.Inputs[i].ScriptSig = unsigned.script()
+	}
+
+	return tx, nil
+}
+
+// signMultiSig fills the signature slots of the key in the unlocking script of
+// the input at index, which spends an output locked by prevScript. It returns
+// the number of signatures added
+func (tx *Transaction) signMultiSig(index int, privKey ecdsa.PrivateKey, prevScript script.Script) (int, error) {
+	partial, ok := parsePartialMultiSig(tx.Inputs[index].ScriptSig)
+	if !ok {
+		return 0, nil
+	}
+	if !bytes.Equal(prevScript, script.PayToScriptHash(script.Hash160(partial.redeemScript))) {
+		return 0, errors.NewInvalidTransactionError(tx.ID)
+	}
+
+	pubKey := publicKey(privKey)
+	signed := 0
+	for i, key := range partial.pubKeys {
+		if !bytes.Equal(key, pubKey) || len(partial.signatures[i]) > 0 {
+			continue
+		}
+
+		signature, err := signHash(privKey, tx.SignatureHash(index, partial.redeemScript))
+		if err != nil {
+			return 0, err
+		}
+		partial.signatures[i] = signature
+		signed++
+	}
+	tx.Inputs[index].ScriptSig = partial.script()
+
+	return signed, nil
+}
+
+// combineMultiSig adds the signatures of another copy of the unlocking script of a
+// multisig input to the empty signature slots of the input at index
+func (tx *Transaction) combineMultiSig(index int, other script.Script) error {
+	partial, ok := parsePartialMultiSig(tx.Inputs[index].ScriptSig)
+	if !ok {
+		return nil
+	}
+	otherPartial, ok := parsePartialMultiSig(other)
+	if !ok || !bytes.Equal(otherPartial.redeemScript, partial.redeemScript) {
+		return errors.NewInvalidTransactionError(tx.ID)
+	}
+
+	for i, signature := range otherPartial.signatures {
+		if len(partial.signatures[i]) == 0 {
+			partial.signatures[i] = signature
+		}
+	}
+	tx.Inputs[index].ScriptSig = partial.script()
+
+	return nil
+}
+
+// finalizeMultiSig replaces the unlocking script of the multisig input at index by
+// its required number of signatures, in the order of their keys, followed by the
+// redeem script. It fails with ErrInvalidSignature if the input misses signatures
+func (tx *Transaction) finalizeMultiSig(index int) error {
+	partial, ok := parsePartialMultiSig(tx.Inputs[index].ScriptSig)
+	if !ok {
+		return nil
+	}
+	if partial.count() < partial.required {
+		return errors.NewMissingSignaturesError(tx.ID, index, partial.count(), partial.required)
+	}
+
+	b := script.NewBuilder()
+	added := 0
+	for _, signature := range partial.signatures {
+		if len(signature) > 0 && added < partial.required {
+			b.AddData(signature)
+			added++
+		}
+	}
+	tx.Inputs[index].ScriptSig = b.AddData(partial.redeemScript).Script()
+
+	return nil
+}
@@ -1,28 +1,30 @@
 package blockchain
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
-	"fmt"
-	"log"
-	"math"
+	"go-blockchain/errors"
 	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Proof Of Work Algorithm
 
-// 1. Take data from the block
+// 1. Take the serialized header of the block
 // 2. Create a counter (nonce) starting at 0
-// 3. Create a hash of the data plus the nonce
+// 3. Create a hash of the header with the nonce
 // 4. Check the hash to see if it meets the requirements
 
 // Requirements:
-// i) First few bytes must contain 0s
+// i) The hash must be below the target of the block
 
-// Difficulty affects the requirements
+// The target is read from the Bits of the block and is retargeted every
+// RetargetInterval blocks (see difficulty.go)
 // Hence affecting the time taken to do the proofofwork work
-const Difficulty = 18
 
 // ProofOfWork structure
 type ProofOfWork struct {
@@ -32,74 +34,154 @@ type ProofOfWork struct {
 
 // NewProof does the proof-of-work work
 func NewProof(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-Difficulty))
-
-	return &ProofOfWork{b, target}
+	return &ProofOfWork{b, CompactToBig(b.Bits)}
 }
 
-// InitData initialises the data
+// InitData returns what the proof of work hashes, the header of the block with the nonce
 func (pow ProofOfWork) InitData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			toHex(int64(nonce)),
-			toHex(int64(Difficulty)),
-		},
-		[]byte{},
-	)
-
-	return data
+	header := pow.Block.BlockHeader
+	header.Nonce = nonce
+
+	return header.hashData()
 }
 
-// Run does the actual work for the proof
-func (pow *ProofOfWork) Run() (int, []byte) {
-	nonce := 0
+// HashRateInterval is how often the hash rate of a running proof of work is reported
+const HashRateInterval = time.Second
 
-	var hash [32]byte
-	var intHash big.Int
+// hashBatch is the number of nonces a worker tries between two looks at its context
+const hashBatch = 1024
 
-	for nonce < math.MaxInt64 {
-		data := pow.InitData(nonce)
-		hash = sha256.Sum256(data)
+// PoWOptions configure the search of the proof of work
+type PoWOptions struct {
+	// Workers is the number of goroutines splitting the nonces, the number of CPUs if 0
+	Workers int
+	// HashRate, if set, receives the number of hashes per second every HashRateInterval
+	HashRate func(hashesPerSecond float64)
+	// Hashes, if set, is atomically added the number of hashes computed
+	Hashes *uint64
+}
 
-		fmt.Printf("\r%x", hash)
-		intHash.SetBytes(hash[:])
+// workers returns the number of goroutines searching the nonces
+func (opts PoWOptions) workers() int {
+	if opts.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+
+	return opts.Workers
+}
+
+// powResult is a nonce meeting the target and the hash it gives
+type powResult struct {
+	nonce int
+	hash  []byte
+}
+
+// Run searches a nonce whose hash meets the target and returns it with the hash.
+// The nonces are split between the workers of opts: worker i tries i, i+workers,
+// i+2*workers... It stops with the error of ctx when ctx is done, for instance
+// when a competing block makes the block useless
+func (pow *ProofOfWork) Run(ctx context.Context, opts PoWOptions) (int, []byte, error) {
+	workers := opts.workers()
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	hashes := opts.Hashes
+	if hashes == nil {
+		hashes = new(uint64)
+	}
+	found := make(chan powResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			pow.search(searchCtx, first, workers, hashes, found)
+		}(i)
+	}
 
-		if intHash.Cmp(pow.Target) == -1 {
-			break
-		} else {
-			nonce++
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	ticker := time.NewTicker(HashRateInterval)
+	defer ticker.Stop()
+	lastHashes, lastTime := atomic.LoadUint64(hashes), time.Now()
+
+	for {
+		select {
+		case result := <-found:
+			cancel()
+			<-stopped
+			return result.nonce, result.hash, nil
+		case <-stopped:
+			// a worker may have found a nonce right before the context was done
+			select {
+			case result := <-found:
+				return result.nonce, result.hash, nil
+			default:
+			}
+			if err := ctx.Err(); err != nil {
+				return 0, nil, err
+			}
+			return 0, nil, errors.New("no nonce meets the target of the block")
+		case now := <-ticker.C:
+			if opts.HashRate != nil {
+				count := atomic.LoadUint64(hashes)
+				opts.HashRate(float64(count-lastHashes) / now.Sub(lastTime).Seconds())
+				lastHashes, lastTime = count, now
+			}
 		}
 	}
+}
 
-	fmt.Println()
+// search tries the nonces first, first+step, first+2*step... until one meets the
+// target, which it sends to found, or until ctx is done. The hashes it computes
+// are added to hashes
+func (pow *ProofOfWork) search(ctx context.Context, first, step int, hashes *uint64, found chan<- powResult) {
+	for nonce := first; nonce >= 0; {
+		for i := 0; i < hashBatch && nonce >= 0; i++ {
+			hash := sha256.Sum256(pow.InitData(nonce))
+			if meetsTarget(hash[:], pow.Target) {
+				atomic.AddUint64(hashes, uint64(i+1))
+				found <- powResult{nonce: nonce, hash: hash[:]}
+				return
+			}
+			// the nonce becomes negative past math.MaxInt64, which ends the search
+			nonce += step
+		}
+		atomic.AddUint64(hashes, hashBatch)
 
-	return nonce, hash[:]
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
 }
 
-// Validate validates the calculated hash
-// computationally easier than the actual proof done in Run function
-func (pow *ProofOfWork) Validate() bool {
-	var intHash big.Int
-
-	data := pow.InitData(pow.Block.Nonce) //TODO: Law of demeter?
+// Hash returns the hash of the block with its nonce
+func (pow *ProofOfWork) Hash() []byte {
+	hash := sha256.Sum256(pow.InitData(pow.Block.Nonce))
 
-	hash := sha256.Sum256(data)
-	intHash.SetBytes(hash[:])
-	return intHash.Cmp(pow.Target) == -1
+	return hash[:]
 }
 
 // ====================== UTILITIES ======================
 
-func toHex(no int64) []byte {
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.BigEndian, no)
-	if err != nil {
-		log.Panic(err)
+// meetsTarget checks if the hash is below the target
+func meetsTarget(hash []byte, target *big.Int) bool {
+	var intHash big.Int
+	intHash.SetBytes(hash)
 
-	}
+	return intHash.Cmp(target) == -1
+}
+
+func toHex(no int64) []byte {
+	buff := make([]byte, 8)
+	binary.BigEndian.PutUint64(buff, uint64(no))
 
-	return buff.Bytes()
+	return buff
 }
@@ -0,0 +1,291 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-blockchain/config"
+	"go-blockchain/errors"
+	"go-blockchain/script"
+	"go-blockchain/wallet"
+)
+
+// PartialTransactionVersion is the version of the format of the partial transaction
+// files. From version 2 they hold the whole transactions spent by the inputs
+const PartialTransactionVersion = 2
+
+// PartialTransaction is a transaction being signed, along with the transactions
+// its inputs spend. It holds everything needed to sign the transaction, so that the
+// keys can stay on a machine without the chain. The spent outputs are read from
+// the whole transactions, whose IDs commit to them, so that the signer can trust
+// the values it signs:
+//
+//  1. a node with the chain creates the unsigned transaction and its partial
+//     transaction with NewPartialTransaction
+//  2. every signer adds the signatures of its keys with Sign
+//  3. copies signed separately are merged with Combine
+//  4. Finalize puts the unlocking scripts in their final form, and the
+//     transaction is verified against the chain before it is sent
+//
+// It is written to a file with Encode, like the PSBTs of bitcoin
+type PartialTransaction struct {
+	Tx      *Transaction
+	PrevTXs map[string]Transaction // the transactions spent by the inputs by hex encoded ID
+}
+
+// NewPartialTransaction returns the partial transaction of tx, with the transactions
+// it spends looked up in the chain
+func (chain *BlockChain) NewPartialTransaction(tx *Transaction) (*PartialTransaction, error) {
+	if tx.IsCoinbase() {
+		return nil, errors.NewInvalidTransactionError(tx.ID)
+	}
+
+	prevTXs, err := chain.findPrevTransactions(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.checkPrevTransactions(prevTXs); err != nil {
+		return nil, err
+	}
+
+	return &PartialTransaction{Tx: tx, PrevTXs: prevTXs}, nil
+}
+
+// Spent returns the output spent by the input
+func (p *PartialTransaction) Spent(inputID int) TxOutput {
+	in := p.Tx.Inputs[inputID]
+
+	return p.PrevTXs[hex.EncodeToString(in.ID)].Outputs[in.Out]
+}
+
+// Sign signs the inputs the key can sign: the inputs spending outputs sent to
+// the address of the key and the multisig inputs the key is one of the keys of.
+// It returns the number of signatures added
+func (p *PartialTransaction) Sign(privKey ecdsa.PrivateKey) (int, error) {
+	pubKey := publicKey(privKey)
+	pubKeyHash := wallet.PublicKeyHash(pubKey)
+
+	signed := 0
+	for inputID, input := range p.Tx.Inputs {
+		spent := p.Spent(inputID)
+		prevScript := spent.ScriptPubKey
+
+		if script.IsPayToScriptHash(prevScript) {
+			count, err := p.Tx.signMultiSig(inputID, privKey, prevScript)
+			if err != nil {
+				return 0, err
+			}
+			signed += count
+			continue
+		}
+
+		if len(input.ScriptSig) > 0 || !spent.IsLockedWithKey(pubKeyHash) {
+			continue
+		}
+		signature, err := signHash(privKey, p.Tx.SignatureHash(inputID, prevScript))
+		if err != nil {
+			return 0, err
+		}
+		p.Tx.Inputs[inputID].ScriptSig = script.PayToPubKeyHashUnlock(signature, pubKey)
+		signed++
+	}
+
+	return signed, nil
+}
+
+// Combine adds the signatures of other copies of the partial transaction to the
+// inputs missing them. It fails with ErrInvalidTransaction if a copy is not the
+// same transaction
+func (p *PartialTransaction) Combine(others ...*PartialTransaction) error {
+	for _, other := range others {
+		if !bytes.Equal(other.Tx.UnsignedHash(), p.Tx.UnsignedHash()) {
+			return errors.NewInvalidTransactionError(other.Tx.ID)
+		}
+
+		for inputID, input := range p.Tx.Inputs {
+			otherScript := other.Tx.Inputs[inputID].ScriptSig
+
+			if script.IsPayToScriptHash(p.Spent(inputID).ScriptPubKey) {
+				if err := p.Tx.combineMultiSig(inputID, otherScript); err != nil {
+					return err
+				}
+			} else if len(input.ScriptSig) == 0 {
+				p.Tx.Inputs[inputID].ScriptSig = otherScript
+			}
+		}
+	}
+
+	return nil
+}
+
+// InputStatus tells how many signatures an input has and how many it needs
+type InputStatus struct {
+	Signatures int
+	Required   int
+}
+
+// Status returns the status of every input of the transaction
+func (p *PartialTransaction) Status() []InputStatus {
+	var status []InputStatus
+	for _, input := range p.Tx.Inputs {
+		if partial, ok := parsePartialMultiSig(input.ScriptSig); ok {
+			status = append(status, InputStatus{Signatures: partial.count(), Required: partial.required})
+			continue
+		}
+
+		signatures := 0
+		if len(input.ScriptSig) > 0 {
+			signatures = 1
+		}
+		status = append(status, InputStatus{Signatures: signatures, Required: 1})
+	}
+
+	return status
+}
+
+// Finalize puts the unlocking scripts of the inputs in their final form. It fails
+// with ErrInvalidSignature if an input misses signatures
+func (p *PartialTransaction) Finalize() error {
+	for inputID := range p.Tx.Inputs {
+		if err := p.Tx.finalizeMultiSig(inputID); err != nil {
+			return err
+		}
+		if len(p.Tx.Inputs[inputID].ScriptSig) == 0 {
+			return errors.NewMissingSignaturesError(p.Tx.ID, inputID, 0, 1)
+		}
+	}
+
+	return nil
+}
+
+// Fee returns the fee of the transaction, computed from the transactions of the
+// partial transaction it spends, see Transaction.Fee. Whether their outputs are
+// still unspent is only checked against the chain when the transaction is verified
+func (p *PartialTransaction) Fee() (int, error) {
+	return p.Tx.Fee(p.PrevTXs)
+}
+
+// ====================== FILE FORMAT ======================
+
+// hexBytes are written in hex in the files
+type hexBytes []byte
+
+func (b hexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+func (b *hexBytes) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(string(text))
+	*b = decoded
+
+	return err
+}
+
+type partialTransactionFile struct {
+	Version   int                `json:"version"`
+	Network   string             `json:"network"`
+	ID        hexBytes           `json:"id"`
+	TxVersion int32              `json:"txversion"`
+	Inputs    []partialInputFile `json:"inputs"`
+	Outputs   []outputFile       `json:"outputs"`
+	LockTime  int64              `json:"locktime"`
+	// the binary encodings of the transactions spent by the inputs
+	PrevTXs []hexBytes `json:"prevtxs"`
+}
+
+type partialInputFile struct {
+	TxID      hexBytes `json:"txid"`
+	Out       int      `json:"out"`
+	ScriptSig hexBytes `json:"scriptsig"`
+	Sequence  uint32   `json:"sequence"`
+}
+
+type outputFile struct {
+	Value        int      `json:"value"`
+	ScriptPubKey hexBytes `json:"scriptpubkey"`
+}
+
+// Encode writes the partial transaction in JSON, along with the network it belongs
+// to. The spent transactions are written in the order of the inputs spending them
+func (p *PartialTransaction) Encode() ([]byte, error) {
+	file := partialTransactionFile{
+		Version:   PartialTransactionVersion,
+		Network:   config.Params().Name,
+		ID:        p.Tx.ID,
+		TxVersion: p.Tx.Version,
+		LockTime:  p.Tx.LockTime,
+	}
+
+	written := make(map[string]bool)
+	for _, in := range p.Tx.Inputs {
+		file.Inputs = append(file.Inputs, partialInputFile{
+			TxID:      in.ID,
+			Out:       in.Out,
+			ScriptSig: hexBytes(in.ScriptSig),
+			Sequence:  in.Sequence,
+		})
+
+		txID := hex.EncodeToString(in.ID)
+		if prevTx, ok := p.PrevTXs[txID]; ok && !written[txID] {
+			file.PrevTXs = append(file.PrevTXs, prevTx.Serialize())
+			written[txID] = true
+		}
+	}
+	for _, out := range p.Tx.Outputs {
+		file.Outputs = append(file.Outputs, outputFile{Value: out.Value, ScriptPubKey: hexBytes(out.ScriptPubKey)})
+	}
+
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// DecodePartialTransaction reads a partial transaction written by Encode. It fails
+// with ErrInvalidTransaction if the file is not a partial transaction, or if its
+// spent transactions are not the ones of its inputs, and with ErrWrongNetwork if
+// it belongs to another network
+func DecodePartialTransaction(data []byte) (*PartialTransaction, error) {
+	var file partialTransactionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.NewInvalidPartialTransactionError("it cannot be read"), err)
+	}
+
+	if file.Version != PartialTransactionVersion {
+		return nil, errors.NewInvalidPartialTransactionError(fmt.Sprintf("version %d is not supported", file.Version))
+	}
+	if file.Network != config.Params().Name {
+		return nil, errors.NewWrongNetworkTransactionError(file.Network, config.Params().Name)
+	}
+
+	partial := &PartialTransaction{
+		Tx:      &Transaction{ID: file.ID, Version: file.TxVersion, LockTime: file.LockTime},
+		PrevTXs: make(map[string]Transaction),
+	}
+	for _, in := range file.Inputs {
+		partial.Tx.Inputs = append(partial.Tx.Inputs, TxInput{ID: in.TxID, Out: in.Out, ScriptSig: script.Script(in.ScriptSig), Sequence: in.Sequence})
+	}
+	// the IDs are computed from the encodings, so a spent transaction is only
+	// found by the inputs if it is the one they spend
+	for i, encoded := range file.PrevTXs {
+		prevTx, err := DeserializeTransaction(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errors.NewInvalidPartialTransactionError(fmt.Sprintf("spent transaction %d cannot be read", i)), err)
+		}
+		partial.PrevTXs[hex.EncodeToString(prevTx.ID)] = prevTx
+	}
+	for _, out := range file.Outputs {
+		partial.Tx.Outputs = append(partial.Tx.Outputs, TxOutput{Value: out.Value, ScriptPubKey: script.Script(out.ScriptPubKey)})
+	}
+
+	if len(partial.Tx.Inputs) == 0 || partial.Tx.IsCoinbase() {
+		return nil, errors.NewInvalidPartialTransactionError("it has no inputs to sign")
+	}
+	if !bytes.Equal(partial.Tx.ID, partial.Tx.UnsignedHash()) {
+		return nil, errors.NewInvalidPartialTransactionError("its ID does not match its content")
+	}
+	if err := partial.Tx.checkPrevTransactions(partial.PrevTXs); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.NewInvalidPartialTransactionError("it misses the transactions spent by its inputs"), err)
+	}
+
+	return partial, nil
+}
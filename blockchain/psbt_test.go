@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-blockchain/errors"
+	"testing"
+)
+
+func TestPartialTransactionCarriesTheSpentTransactions(t *testing.T) {
+	w, to := newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+
+	UTXOSet := UTXOSet{Blockchain: chain}
+	tx, err := NewUnsignedTransaction(string(w.Address()), string(to.Address()), 30, 2, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := chain.NewPartialTransaction(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := partial.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodePartialTransaction(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee, err := decoded.Fee(); err != nil || fee != 2 {
+		t.Fatalf("the fee is %d (%v), expected 2", fee, err)
+	}
+	if count, err := decoded.Sign(w.PrivateKey); err != nil || count != 1 {
+		t.Fatalf("signed %d inputs (%v), expected 1", count, err)
+	}
+	if err := decoded.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.VerifyTransaction(decoded.Tx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a spent transaction claiming more value is not the one of the input
+	var file partialTransactionFile
+	if err := json.Unmarshal(encoded, &file); err != nil {
+		t.Fatal(err)
+	}
+	prevTx, err := DeserializeTransaction(file.PrevTXs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevTx.Outputs[0].Value += 1000
+	file.PrevTXs[0] = prevTx.Serialize()
+	tampered, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(tampered, encoded) {
+		t.Fatal("the file is not tampered")
+	}
+	if _, err := DecodePartialTransaction(tampered); !errors.Is(err, errors.ErrInvalidTransaction) {
+		t.Fatalf("decoding the tampered file returned %v, expected ErrInvalidTransaction", err)
+	}
+
+	file.PrevTXs = nil
+	missing, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodePartialTransaction(missing); !errors.Is(err, errors.ErrInvalidTransaction) {
+		t.Fatalf("decoding the file without spent transactions returned %v, expected ErrInvalidTransaction", err)
+	}
+}
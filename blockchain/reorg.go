@@ -0,0 +1,480 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"go-blockchain/errors"
+	"math/big"
+	"sort"
+
+	"go-blockchain/storage"
+)
+
+// Forks and reorganizations
+
+// Every valid block is stored, even when it does not extend the main chain, along
+// with the chainwork of its branch: the total weight of the blocks from the genesis
+// block to it, see Consensus.Weight. The main chain is the branch with the most chainwork. When a block
+// gives another branch more chainwork than the main chain, the node reorganizes to
+// it: the blocks of the main chain after the fork are disconnected from the tip
+// down to the fork and the blocks of the branch are connected from the fork up. A
+// connected block keeps its undo data, the outputs spent by its transactions, so
+// that it can be disconnected from the UTXO set later. A block is stored and the
+// reorganization it triggers runs in the same database transaction, so the tip is
+// always the stored block with the most chainwork and a branch with an invalid
+// block is never half connected. Its invalid block and the blocks built on it are
+// dropped instead
+
+var (
+	// blockPrefix is prepended to the hash of a block to store the block
+	blockPrefix = []byte("b-")
+	// workPrefix is prepended to the hash of a block to store its chainwork
+	workPrefix = []byte("w-")
+	// undoPrefix is prepended to the hash of a connected block to store its undo data
+	undoPrefix = []byte("u-")
+)
+
+// TipChange describes a change of the tip of the main chain. When a block
+// extends the tip, Disconnected is empty and Connected only holds that block
+type TipChange struct {
+	// Fork is the hash of the last block shared by the old and the new main chain
+	Fork []byte
+	// Disconnected holds the blocks of the old main chain, from its tip down to the fork
+	Disconnected []*Block
+	// Connected holds the blocks of the new main chain, from the fork up to its tip
+	Connected []*Block
+}
+
+// IsReorg tells if blocks of the main chain were disconnected
+func (c *TipChange) IsReorg() bool {
+	return len(c.Disconnected) > 0
+}
+
+// Tip returns the new tip of the main chain
+func (c *TipChange) Tip() *Block {
+	return c.Connected[len(c.Connected)-1]
+}
+
+// Subscribe registers a handler called after every change of the tip of the main chain
+func (chain *BlockChain) Subscribe(handler func(*TipChange)) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	chain.handlers = append(chain.handlers, handler)
+}
+
+func (chain *BlockChain) notify(change *TipChange) {
+	chain.mu.Lock()
+	handlers := append([]func(*TipChange){}, chain.handlers...)
+	chain.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(change)
+	}
+}
+
+// BlockWork returns the expected number of hashes needed to find a block with
+// the bits, 2^256 / (target+1) like in bitcoin
+func BlockWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+func blockKey(hash []byte) []byte {
+	return append(append([]byte{}, blockPrefix...), hash...)
+}
+
+func workKey(hash []byte) []byte {
+	return append(append([]byte{}, workPrefix...), hash...)
+}
+
+func undoKey(hash []byte) []byte {
+	return append(append([]byte{}, undoPrefix...), hash...)
+}
+
+// getWork reads the chainwork of the block with the given hash
+func getWork(txn storage.Txn, hash []byte) (*big.Int, error) {
+	value, err := txn.Get(workKey(hash))
+	if err == storage.ErrNotFound {
+		return nil, errors.NewBlockNotFoundError(hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(value), nil
+}
+
+// GetChainWork returns the chainwork of the branch ending with the block with the given hash
+func (chain *BlockChain) GetChainWork(hash []byte) (*big.Int, error) {
+	var work *big.Int
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		var err error
+		work, err = getWork(txn, hash)
+
+		return err
+	})
+
+	return work, err
+}
+
+// storeBlock stores the block along with its chainwork, the weight of the block
+// added to the chainwork of its parent, and returns the chainwork
+func storeBlock(txn storage.Txn, block *Block, weight *big.Int) (*big.Int, error) {
+	work := new(big.Int).Set(weight)
+	if len(block.PrevHash) != 0 {
+		parentWork, err := getWork(txn, block.PrevHash)
+		if err != nil {
+			return nil, err
+		}
+		work.Add(work, parentWork)
+	}
+
+	if err := txn.Put(blockKey(block.Hash), block.Serialize()); err != nil {
+		return nil, err
+	}
+
+	return work, txn.Put(workKey(block.Hash), work.Bytes())
+}
+
+// isMainChain tells if the block is part of the main chain
+func isMainChain(txn storage.Txn, block *Block) (bool, error) {
+	hash, err := getHashByHeight(txn, block.Height)
+	if errors.Is(err, errors.ErrBlockNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(hash, block.Hash), nil
+}
+
+// reorganize makes block the tip of the main chain, disconnecting the blocks of
+// the main chain after the fork and connecting the blocks of the branch of block.
+// If a block of the branch is invalid, the hashes of that block and of the blocks
+// built on it are returned with the error
+func reorganize(txn storage.Txn, block *Block, lastHash []byte) (*TipChange, [][]byte, error) {
+	change := &TipChange{}
+
+	// walking the branch back to the main chain
+	var branch []*Block
+	fork := block
+	for {
+		onMainChain, err := isMainChain(txn, fork)
+		if err != nil {
+			return nil, nil, err
+		}
+		if onMainChain {
+			break
+		}
+		branch = append([]*Block{fork}, branch...)
+
+		if len(fork.PrevHash) == 0 {
+			// the genesis block of an empty chain
+			fork = nil
+			break
+		}
+		if fork, err = getBlock(txn, fork.PrevHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if fork != nil {
+		change.Fork = fork.Hash
+
+		tip, err := getBlock(txn, lastHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		for !bytes.Equal(tip.Hash, fork.Hash) {
+			if err := disconnectBlock(txn, tip); err != nil {
+				return nil, nil, err
+			}
+			change.Disconnected = append(change.Disconnected, tip)
+
+			if tip, err = getBlock(txn, tip.PrevHash); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	for i, b := range branch {
+		if err := connectBlock(txn, b); err != nil {
+			var invalid [][]byte
+			for _, descendant := range branch[i:] {
+				invalid = append(invalid, descendant.Hash)
+			}
+			return nil, invalid, err
+		}
+		change.Connected = append(change.Connected, b)
+	}
+
+	return change, nil, nil
+}
+
+// connectBlock checks the transactions of the block against the UTXO set, applies
+// them, keeps the undo data of the block and makes it the tip of the main chain
+func connectBlock(txn storage.Txn, block *Block) error {
+	invalid := func(err error) error {
+		return fmt.Errorf("%w: %v", errors.NewInvalidBlockError(block.Hash, "it contains an invalid transaction"), err)
+	}
+
+	// the lock times are checked against the median time past of the previous block
+	var mtp int64
+	if len(block.PrevHash) != 0 {
+		var err error
+		if mtp, err = medianTimePast(txn, block.PrevHash); err != nil {
+			return err
+		}
+	}
+	clock := block.lockClock(mtp)
+	confirmation := utxoConfirmation(txn, block.Height, clock, block.Version >= medianTimeVersion)
+
+	undo := make([][]SpentOutput, len(block.Transactions))
+	fees := 0
+
+	for i, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			prevTXs, err := utxoPrevTransactions(txn, tx)
+			if err != nil {
+				return invalid(err)
+			}
+			fee, err := tx.Fee(prevTXs)
+			if err != nil {
+				return invalid(err)
+			}
+			if err := tx.Verify(prevTXs); err != nil {
+				return invalid(err)
+			}
+			if err := tx.checkLocks(block.Height, clock, confirmation); err != nil {
+				return invalid(err)
+			}
+			fees += fee
+		}
+
+		spent, err := applyTransaction(txn, tx, block.Height)
+		if err != nil {
+			return err
+		}
+		undo[i] = spent
+	}
+
+	if coinbase := block.Transactions[0]; coinbase.IsCoinbase() {
+		reward, err := coinbase.outputValue()
+		if err != nil {
+			return invalid(err)
+		}
+		if reward > Subsidy(block.Height)+fees {
+			return errors.NewInvalidBlockError(block.Hash, "its coinbase claims more than the subsidy and the fees")
+		}
+	}
+
+	if err := txn.Put(undoKey(block.Hash), serializeUndo(undo)); err != nil {
+		return err
+	}
+
+	if err := txn.Put([]byte("lh"), block.Hash); err != nil {
+		return err
+	}
+	if err := txn.Put(heightKey(block.Height), block.Hash); err != nil {
+		return err
+	}
+
+	indexed, err := txIndexEnabled(txn)
+	if err != nil || !indexed {
+		return err
+	}
+
+	return indexTransactions(txn, block)
+}
+
+// disconnectBlock removes the tip of the main chain, restoring the UTXO set and
+// the indexes to their state before the block was connected
+func disconnectBlock(txn storage.Txn, block *Block) error {
+	encodedUndo, err := txn.Get(undoKey(block.Hash))
+	if err != nil {
+		return err
+	}
+
+	undo, err := deserializeUndo(encodedUndo)
+	if err != nil {
+		return err
+	}
+	if len(undo) != len(block.Transactions) {
+		return fmt.Errorf("the undo data of block %x has %d transactions instead of %d", block.Hash, len(undo), len(block.Transactions))
+	}
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		if err := revertTransaction(txn, block.Transactions[i], undo[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := txn.Delete(undoKey(block.Hash)); err != nil {
+		return err
+	}
+	if err := txn.Delete(heightKey(block.Height)); err != nil {
+		return err
+	}
+	if err := txn.Put([]byte("lh"), block.PrevHash); err != nil {
+		return err
+	}
+
+	indexed, err := txIndexEnabled(txn)
+	if err != nil || !indexed {
+		return err
+	}
+
+	return unindexTransactions(txn, block)
+}
+
+// serializeUndo encodes the undo data of a block, the outputs spent by each of
+// its transactions, see EncodingVersion
+func serializeUndo(undo [][]SpentOutput) []byte {
+	var e encoder
+	e.WriteByte(EncodingVersion)
+
+	e.writeUint32(uint32(len(undo)))
+	for _, spent := range undo {
+		e.writeUint32(uint32(len(spent)))
+		for _, s := range spent {
+			e.writeSpentOutput(s)
+		}
+	}
+
+	return e.Bytes()
+}
+
+// deserializeUndo decodes undo data encoded by serializeUndo
+func deserializeUndo(data []byte) ([][]SpentOutput, error) {
+	d := newDecoder(data)
+
+	var undo [][]SpentOutput
+	for i, txs := uint32(0), d.readUint32(); i < txs && d.err == nil; i++ {
+		var spent []SpentOutput
+		for j, outputs := uint32(0), d.readUint32(); j < outputs && d.err == nil; j++ {
+			spent = append(spent, d.readSpentOutput())
+		}
+		undo = append(undo, spent)
+	}
+
+	return undo, d.finish()
+}
+
+// utxoPrevTransactions builds the transactions spent by tx from the unspent outputs
+// they still have inside txn. It fails if tx spends an output that is not unspent
+func utxoPrevTransactions(txn storage.Txn, tx *Transaction) (map[string]Transaction, error) {
+	prevTXs := make(map[string]Transaction)
+	spends := make(map[string]bool)
+
+	for _, in := range tx.Inputs {
+		point := outpoint(in.ID, in.Out)
+		if spends[point] {
+			return nil, errors.NewInvalidTransactionError(tx.ID)
+		}
+		spends[point] = true
+
+		outs, err := getUTXO(txn, in.ID)
+		if err != nil {
+			return nil, err
+		}
+		out, ok := outs.Outputs[in.Out]
+		if !ok {
+			return nil, errors.NewTransactionNotFoundError(in.ID)
+		}
+
+		// only the spent outputs of the previous transaction are filled in
+		key := hex.EncodeToString(in.ID)
+		prevTX := prevTXs[key]
+		prevTX.ID = in.ID
+		for len(prevTX.Outputs) <= in.Out {
+			prevTX.Outputs = append(prevTX.Outputs, TxOutput{})
+		}
+		prevTX.Outputs[in.Out] = out
+		prevTXs[key] = prevTX
+	}
+
+	return prevTXs, nil
+}
+
+// ChainTip is the last block of a branch of the chain
+type ChainTip struct {
+	Height int
+	Hash   []byte
+	Work   *big.Int
+	// BranchLength is the number of blocks of the branch that are not on the main chain
+	BranchLength int
+	// Active tells if the tip is the tip of the main chain
+	Active bool
+}
+
+// ChainTips returns the tips of the main chain and of the side branches, the
+// stored blocks no other block builds on
+func (chain *BlockChain) ChainTips() ([]ChainTip, error) {
+	var tips []ChainTip
+	lastHash := chain.GetLastHash()
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		blocks := make(map[string]*Block)
+		parents := make(map[string]bool)
+
+		err := txn.Iterate(workPrefix, func(key, _ []byte) error {
+			hash := bytes.TrimPrefix(key, workPrefix)
+			block, err := getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+			blocks[hex.EncodeToString(hash)] = block
+			parents[hex.EncodeToString(block.PrevHash)] = true
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for ID, block := range blocks {
+			if parents[ID] {
+				continue
+			}
+
+			tip := ChainTip{Height: block.Height, Hash: block.Hash, Active: bytes.Equal(block.Hash, lastHash)}
+			var err error
+			if tip.Work, err = getWork(txn, block.Hash); err != nil {
+				return err
+			}
+
+			for b := block; ; tip.BranchLength++ {
+				onMainChain, err := isMainChain(txn, b)
+				if err != nil {
+					return err
+				}
+				if onMainChain || len(b.PrevHash) == 0 {
+					break
+				}
+				if b, err = getBlock(txn, b.PrevHash); err != nil {
+					return err
+				}
+			}
+
+			tips = append(tips, tip)
+		}
+
+		return nil
+	})
+
+	sort.Slice(tips, func(i, j int) bool {
+		return tips[i].Height > tips[j].Height
+	})
+
+	return tips, err
+}
@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"go-blockchain/errors"
+	"reflect"
+	"testing"
+)
+
+func TestReorganizeToTheBranchWithMoreWork(t *testing.T) {
+	w, to, miner := newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	genesis := tip(t, chain)
+
+	var changes []*TipChange
+	chain.Subscribe(func(change *TipChange) {
+		changes = append(changes, change)
+	})
+
+	// the main chain pays to in its first block
+	a1 := addBlock(t, chain, genesis, miner, send(t, chain, w, to, 30))
+	a2 := addBlock(t, chain, a1, miner)
+	if got := balance(t, chain, to); got != 30 {
+		t.Fatalf("the balance is %d before the reorganization, expected 30", got)
+	}
+
+	// a branch with as much work does not take over
+	b1 := addBlock(t, chain, genesis, miner)
+	b2 := addBlock(t, chain, b1, miner)
+	if !bytes.Equal(chain.GetLastHash(), a2.Hash) {
+		t.Fatalf("the tip moved to %x, a branch with the same work", chain.GetLastHash())
+	}
+
+	b3 := addBlock(t, chain, b2, miner)
+	if !bytes.Equal(chain.GetLastHash(), b3.Hash) {
+		t.Fatalf("the tip is %x instead of the tip of the branch with more work", chain.GetLastHash())
+	}
+
+	change := changes[len(changes)-1]
+	if !change.IsReorg() || !bytes.Equal(change.Fork, genesis.Hash) {
+		t.Fatalf("the change forks from %x, expected a reorganization from the genesis block", change.Fork)
+	}
+	if got, want := hashes(change.Disconnected), hashes([]*Block{a2, a1}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("disconnected %v, expected %v", got, want)
+	}
+	if got, want := hashes(change.Connected), hashes([]*Block{b1, b2, b3}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("connected %v, expected %v", got, want)
+	}
+
+	// the payment of the old main chain is rolled back
+	if got := balance(t, chain, to); got != 0 {
+		t.Fatalf("the balance is %d after the reorganization, expected 0", got)
+	}
+	if got, want := balance(t, chain, w), Subsidy(0); got != want {
+		t.Fatalf("the balance of the payer is %d, expected the genesis subsidy %d", got, want)
+	}
+	checkUTXOSet(t, chain)
+
+	for _, block := range []*Block{a1, a2} {
+		if hasUndo(t, chain, block) {
+			t.Fatalf("the disconnected block %x keeps its undo data", block.Hash)
+		}
+		if !chain.HasBlock(block.Hash) {
+			t.Fatalf("the disconnected block %x is not stored anymore", block.Hash)
+		}
+	}
+	for _, block := range []*Block{genesis, b1, b2, b3} {
+		if !hasUndo(t, chain, block) {
+			t.Fatalf("the connected block %x has no undo data", block.Hash)
+		}
+	}
+	if block, err := chain.GetBlockByHeight(1); err != nil || !bytes.Equal(block.Hash, b1.Hash) {
+		t.Fatalf("the height index points to %x (%v) instead of the branch", block.Hash, err)
+	}
+
+	tips, err := chain.ChainTips()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tips) != 2 || !tips[0].Active || !bytes.Equal(tips[0].Hash, b3.Hash) || !bytes.Equal(tips[1].Hash, a2.Hash) || tips[1].BranchLength != 2 {
+		t.Fatalf("unexpected chain tips %+v", tips)
+	}
+
+	// the old branch takes over again once it has more work, connecting the payment again
+	a3 := addBlock(t, chain, a2, miner)
+	a4 := addBlock(t, chain, a3, miner)
+	if !bytes.Equal(chain.GetLastHash(), a4.Hash) {
+		t.Fatalf("the tip is %x instead of the tip of the old branch", chain.GetLastHash())
+	}
+	if got := balance(t, chain, to); got != 30 {
+		t.Fatalf("the balance is %d once the payment is connected again, expected 30", got)
+	}
+	checkUTXOSet(t, chain)
+
+	if err := chain.Verify(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReorganizationToAnInvalidBranchChangesNothing(t *testing.T) {
+	w, miner := newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	genesis := tip(t, chain)
+	a1 := addBlock(t, chain, genesis, miner)
+
+	// a transaction spending an output that never existed, which is only found
+	// once its block is connected
+	missingID := make([]byte, 32)
+	if _, err := rand.Read(missingID); err != nil {
+		t.Fatal(err)
+	}
+	output, err := NewTXOutput(10, string(miner.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidTx := &Transaction{
+		Version: TxVersion,
+		Inputs:  []TxInput{{ID: missingID, Out: 0, Sequence: SequenceFinal}},
+		Outputs: []TxOutput{*output},
+	}
+	invalidTx.SetID()
+
+	b1 := addBlock(t, chain, genesis, miner)
+	b2 := newBlock(t, chain, b1, miner, invalidTx)
+	if err := chain.AddBlock(b2); !errors.Is(err, errors.ErrInvalidBlock) {
+		t.Fatalf("adding the invalid block returned %v, expected ErrInvalidBlock", err)
+	}
+
+	if !bytes.Equal(chain.GetLastHash(), a1.Hash) {
+		t.Fatalf("the tip moved to %x", chain.GetLastHash())
+	}
+	if chain.HasBlock(b2.Hash) {
+		t.Fatal("the invalid block is stored")
+	}
+	if !chain.HasBlock(b1.Hash) || hasUndo(t, chain, b1) {
+		t.Fatal("the valid block of the branch is not kept as a side branch")
+	}
+	if block, err := chain.GetBlockByHeight(1); err != nil || !bytes.Equal(block.Hash, a1.Hash) {
+		t.Fatalf("the height index points to %x (%v) instead of the main chain", block.Hash, err)
+	}
+	checkUTXOSet(t, chain)
+
+	// the valid part of the branch can still take over
+	b2 = addBlock(t, chain, b1, miner)
+	if !bytes.Equal(chain.GetLastHash(), b2.Hash) {
+		t.Fatalf("the tip is %x instead of the valid branch", chain.GetLastHash())
+	}
+	checkUTXOSet(t, chain)
+}
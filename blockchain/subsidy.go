@@ -0,0 +1,91 @@
+package blockchain
+
+import "go-blockchain/config"
+
+// Subsidy schedule
+
+// The coinbase of a block can create new coins, its subsidy, on top of the fees
+// of the block. The subsidy starts at the InitialSubsidy of the network and is
+// halved every HalvingInterval blocks, like in bitcoin. The subsidies stop early
+// if they would create more than the MaxSupply of the network, so the last
+// subsidy may only be a part of the scheduled one
+
+// Supply describes the coins of the chain at its tip
+type Supply struct {
+	// Height is the height of the tip
+	Height int
+	// Issued is the number of coins in existence, the value of the unspent outputs.
+	// It can be lower than Scheduled if miners did not claim their whole reward
+	Issued int
+	// Scheduled is the number of coins the subsidies of the chain could create
+	Scheduled int
+	// NextSubsidy is the subsidy of the next block
+	NextSubsidy int
+	// NextHalving is the height of the next block whose subsidy is halved
+	NextHalving int
+	// MaxSupply is the number of coins that can ever be created
+	MaxSupply int
+}
+
+// Subsidy returns the number of coins the coinbase of the block at the height can create
+func Subsidy(height int) int {
+	return ScheduledSupply(height) - ScheduledSupply(height-1)
+}
+
+// ScheduledSupply returns the number of coins created by the subsidies of the
+// blocks from the genesis block to the block at the height
+func ScheduledSupply(height int) int {
+	params := config.Params()
+
+	total := 0
+	for halvings := 0; halvings < 63; halvings++ {
+		start := halvings * params.HalvingInterval
+		subsidy := params.InitialSubsidy >> uint(halvings)
+		if start > height || subsidy == 0 {
+			break
+		}
+
+		end := start + params.HalvingInterval - 1
+		if end > height {
+			end = height
+		}
+		total += (end - start + 1) * subsidy
+
+		if total >= params.MaxSupply {
+			return params.MaxSupply
+		}
+	}
+
+	return total
+}
+
+// Supply returns the supply of the chain at its tip
+func (chain *BlockChain) Supply() (*Supply, error) {
+	height, err := chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	issued := 0
+	UTXOSet := UTXOSet{Blockchain: chain}
+	err = UTXOSet.forEach(func(txID string, outs TxOutputs) bool {
+		for _, out := range outs.Outputs {
+			issued += out.Value
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	interval := config.Params().HalvingInterval
+
+	return &Supply{
+		Height:      height,
+		Issued:      issued,
+		Scheduled:   ScheduledSupply(height),
+		NextSubsidy: Subsidy(height + 1),
+		NextHalving: ((height+1)/interval + 1) * interval,
+		MaxSupply:   config.Params().MaxSupply,
+	}, nil
+}
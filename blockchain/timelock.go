@@ -0,0 +1,255 @@
+package blockchain
+
+import (
+	"go-blockchain/errors"
+	"sort"
+
+	"go-blockchain/storage"
+)
+
+// Transactions can be locked like in bitcoin:
+//
+//   - the lock time of a transaction keeps it out of the blocks until a height,
+//     or until a unix time if it is at least LockTimeThreshold. It only applies
+//     if one of the inputs is not final
+//   - the sequence of an input keeps the transaction out of the blocks until the
+//     output it spends is old enough: a number of blocks, or a number of 512
+//     seconds units if SequenceLockTimeIsSeconds is set. It only applies if
+//     SequenceLockTimeDisabled is not set
+//
+// The lock times are checked against the height of the block and the median time
+// past of its previous block, the median timestamp of the last medianTimeBlocks
+// blocks, which the miners cannot move forward on their own. The timestamp of a
+// block has to be after the median time past, and the relative lock times in
+// seconds count from the median time past of the block before the one confirming
+// the output. The blocks before medianTimeVersion use their own timestamps instead.
+// Scripts can also require lock times with OP_CHECKLOCKTIMEVERIFY and OP_CHECKSEQUENCEVERIFY
+
+const (
+	// LockTimeThreshold is the first lock time read as a unix time instead of a height
+	LockTimeThreshold = 500000000
+
+	// SequenceFinal is the sequence of the inputs that lock nothing
+	SequenceFinal uint32 = 0xffffffff
+	// SequenceLockTimeDisabled disables the relative lock time of an input
+	SequenceLockTimeDisabled uint32 = 1 << 31
+	// SequenceLockTimeIsSeconds makes the relative lock time a number of 512 seconds units
+	SequenceLockTimeIsSeconds uint32 = 1 << 22
+	// SequenceLockTimeMask selects the relative lock time in a sequence
+	SequenceLockTimeMask uint32 = 0x0000ffff
+	// SequenceLockTimeGranularity is the shift turning a relative lock time in units into seconds
+	SequenceLockTimeGranularity = 9
+
+	// medianTimeBlocks is the number of blocks the median time past is the median timestamp of
+	medianTimeBlocks = 11
+	// medianTimeVersion is the first block version using the median time past
+	medianTimeVersion = 3
+)
+
+// medianTime returns the median of the timestamps, of which there is at least one
+func medianTime(times []int64) int64 {
+	sorted := append([]int64{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[len(sorted)/2]
+}
+
+// medianTimePast returns the median time past of the block with the hash inside
+// txn, the median timestamp of the block and the blocks before it
+func medianTimePast(txn storage.Txn, hash []byte) (int64, error) {
+	var times []int64
+	for len(times) < medianTimeBlocks && len(hash) != 0 {
+		block, err := getBlock(txn, hash)
+		if err != nil {
+			return 0, err
+		}
+		times = append(times, block.Timestamp)
+		hash = block.PrevHash
+	}
+
+	return medianTime(times), nil
+}
+
+// MedianTimePast returns the median time past of the block with the hash, which
+// the timestamp of the next block has to be after
+func (chain *BlockChain) MedianTimePast(hash []byte) (int64, error) {
+	var mtp int64
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		var err error
+		mtp, err = medianTimePast(txn, hash)
+
+		return err
+	})
+
+	return mtp, err
+}
+
+// lockClock returns the time the lock times of the transactions of the block are
+// checked against, given the median time past of its previous block
+func (b *Block) lockClock(mtp int64) int64 {
+	if b.Version < medianTimeVersion {
+		return b.Timestamp
+	}
+
+	return mtp
+}
+
+// lockTimeSequence returns the sequence of the inputs of a transaction with the
+// lock time: not final, so that the lock time applies, and without relative lock time
+func lockTimeSequence(lockTime int64) uint32 {
+	if lockTime == 0 {
+		return SequenceFinal
+	}
+
+	return SequenceFinal - 1
+}
+
+// IsFinal tells if the lock time of the transaction allows it in the block at
+// height whose lock times are checked against blockTime, see lockClock
+func (tx *Transaction) IsFinal(height int, blockTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+
+	limit := int64(height)
+	if tx.LockTime >= LockTimeThreshold {
+		limit = blockTime
+	}
+	if tx.LockTime < limit {
+		return true
+	}
+
+	for _, in := range tx.Inputs {
+		if in.Sequence != SequenceFinal {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkSequenceLock checks the relative lock time of the input, spending an output
+// confirmed by the block at prevHeight at prevTime, against the block at height
+// whose lock times are checked against blockTime
+func checkSequenceLock(in TxInput, prevHeight int, prevTime int64, height int, blockTime int64) bool {
+	if in.Sequence&SequenceLockTimeDisabled != 0 {
+		return true
+	}
+
+	lock := int64(in.Sequence & SequenceLockTimeMask)
+	if in.Sequence&SequenceLockTimeIsSeconds != 0 {
+		return blockTime-prevTime >= lock<<SequenceLockTimeGranularity
+	}
+
+	return int64(height-prevHeight) >= lock
+}
+
+// confirmationFunc returns the height of the block confirming the output spent by
+// the input and the time its relative lock times in seconds count from: the median
+// time past of the block before it, or the timestamp of the block itself for the
+// spending blocks before medianTimeVersion
+type confirmationFunc func(in TxInput) (int, int64, error)
+
+// checkLocks checks the lock time and the relative lock times of the transaction
+// for the block at height whose lock times are checked against blockTime. It fails with
+// ErrLockedTransaction if the transaction is still locked
+func (tx *Transaction) checkLocks(height int, blockTime int64, confirmation confirmationFunc) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if !tx.IsFinal(height, blockTime) {
+		return errors.NewLockedTransactionError(tx.ID, "its lock time is %d", tx.LockTime)
+	}
+
+	for inputID, in := range tx.Inputs {
+		if in.Sequence&SequenceLockTimeDisabled != 0 {
+			continue
+		}
+
+		prevHeight, prevTime, err := confirmation(in)
+		if err != nil {
+			return err
+		}
+		if !checkSequenceLock(in, prevHeight, prevTime, height, blockTime) {
+			return errors.NewLockedTransactionError(tx.ID, "input %d has the sequence %08x", inputID, in.Sequence)
+		}
+	}
+
+	return nil
+}
+
+// utxoConfirmation finds the confirmations of the unspent outputs inside txn, for
+// the block at height whose lock times are checked against blockTime, which may
+// not be indexed yet. medianTime tells if the block uses the median time past
+func utxoConfirmation(txn storage.Txn, height int, blockTime int64, medianTime bool) confirmationFunc {
+	return func(in TxInput) (int, int64, error) {
+		outs, err := getUTXO(txn, in.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, ok := outs.Outputs[in.Out]; !ok {
+			return 0, 0, errors.NewTransactionNotFoundError(in.ID)
+		}
+		if outs.Height == height {
+			return height, blockTime, nil
+		}
+
+		if !medianTime {
+			hash, err := getHashByHeight(txn, outs.Height)
+			if err != nil {
+				return 0, 0, err
+			}
+			block, err := getBlock(txn, hash)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			return outs.Height, block.Timestamp, nil
+		}
+
+		prevHeight := outs.Height - 1
+		if prevHeight < 0 {
+			prevHeight = 0
+		}
+		hash, err := getHashByHeight(txn, prevHeight)
+		if err != nil {
+			return 0, 0, err
+		}
+		mtp, err := medianTimePast(txn, hash)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return outs.Height, mtp, nil
+	}
+}
+
+// CheckLocks checks that the lock times of the transaction allow it in the next
+// block. It fails with ErrLockedTransaction if they do not
+func (chain *BlockChain) CheckLocks(tx *Transaction) error {
+	return chain.Database.View(func(txn storage.Txn) error {
+		return checkNextBlockLocks(txn, tx)
+	})
+}
+
+// checkNextBlockLocks checks the lock times of the transaction inside txn for the
+// block on top of the main chain, against the median time past of the tip
+func checkNextBlockLocks(txn storage.Txn, tx *Transaction) error {
+	lastHash, err := txn.Get([]byte("lh"))
+	if err != nil {
+		return err
+	}
+	tip, err := getBlock(txn, lastHash)
+	if err != nil {
+		return err
+	}
+	mtp, err := medianTimePast(txn, lastHash)
+	if err != nil {
+		return err
+	}
+
+	height := tip.Height + 1
+
+	return tx.checkLocks(height, mtp, utxoConfirmation(txn, height, mtp, true))
+}
@@ -6,140 +6,356 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
 	"encoding/hex"
 	"fmt"
+	"go-blockchain/config"
 	"go-blockchain/errors"
+	"go-blockchain/script"
 	"go-blockchain/wallet"
-	"log"
 	"math/big"
 	"strings"
 )
 
+// FeeRateUnit is the number of bytes a fee rate is given for
+const FeeRateUnit = 1000
+
+// TxVersion is the version of the transactions created by the node. The
+// transactions of version 0, created before the binary encoding, are hashed in
+// their legacy serialization so that their IDs and signatures still hold
+const TxVersion = 1
+
+// legacyTxVersion is the last version of the transactions with a legacy serialization
+const legacyTxVersion = 0
+
 // Transaction struct
 // No sensitive info should be added to this
 type Transaction struct {
-	ID      []byte
-	Inputs  []TxInput
-	Outputs []TxOutput
+	ID       []byte
+	Version  int32 // see TxVersion
+	Inputs   []TxInput
+	Outputs  []TxOutput
+	LockTime int64 // height or unix time before which the transaction cannot be mined, see IsFinal
 }
 
-// Serialize serializes the transaction struct into bytes
+// Serialize encodes the transaction, see EncodingVersion
 func (tx Transaction) Serialize() []byte {
-	var encoded bytes.Buffer
+	var e encoder
+	e.WriteByte(EncodingVersion)
+	e.writeTransaction(&tx)
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	errors.HandleErr(err)
-
-	return encoded.Bytes()
+	return e.Bytes()
 }
 
-// Hash hashes the transaction struct into bytes
+// Hash hashes the encoding of the transaction, or its legacy serialization for
+// the legacy transactions
 func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
+	if tx.Version <= legacyTxVersion {
+		hash := sha256.Sum256(tx.legacySerialize())
+		return hash[:]
+	}
+
+	hash := sha256.Sum256(tx.Serialize())
+
+	return hash[:]
+}
+
+// Size returns the size in bytes of the encoding of the transaction, which fee
+// rates are computed from
+func (tx *Transaction) Size() int {
+	return len(tx.Serialize())
+}
+
+// legacySerialize writes the fields of the transaction in a fixed order
+func (tx *Transaction) legacySerialize() []byte {
+	var data bytes.Buffer
+
+	data.Write(toHex(int64(len(tx.Inputs))))
+	for _, in := range tx.Inputs {
+		writeLegacyBytes(&data, in.ID)
+		data.Write(toHex(int64(in.Out)))
+		writeLegacyBytes(&data, in.ScriptSig)
+		data.Write(toHex(int64(in.Sequence)))
+	}
+
+	data.Write(toHex(int64(len(tx.Outputs))))
+	for _, out := range tx.Outputs {
+		data.Write(toHex(int64(out.Value)))
+		writeLegacyBytes(&data, out.ScriptPubKey)
+	}
+
+	data.Write(toHex(tx.LockTime))
+
+	return data.Bytes()
+}
+
+// UnsignedHash returns the hash of the transaction without its unlocking scripts.
+// It is the ID of the transaction, which is set before the transaction is signed.
+// The data of a coinbase is kept, it is what tells coinbases apart
+func (tx *Transaction) UnsignedHash() []byte {
+	if tx.IsCoinbase() {
+		return tx.Hash()
+	}
 
 	txCopy := *tx
-	txCopy.ID = []byte{}
+	txCopy.Inputs = make([]TxInput, len(tx.Inputs))
+	for i, in := range tx.Inputs {
+		in.ScriptSig = nil
+		txCopy.Inputs[i] = in
+	}
 
-	hash = sha256.Sum256(txCopy.Serialize())
+	return txCopy.Hash()
+}
 
-	return hash[:]
+// SignatureHash returns the hash signed by the signatures unlocking the input of the
+// transaction at index: the hash of the transaction where the unlocking script of
+// that input is replaced by the locking script of the output it spends (the
+// redeem script for outputs paying to a script hash) and the other unlocking
+// scripts are removed
+func (tx *Transaction) SignatureHash(index int, prevScript script.Script) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.Inputs[index].ScriptSig = prevScript
+
+	return txCopy.Hash()
 }
 
-// SetID calculates and sets the
+// SetID calculates and sets the ID of the transaction
 func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
-
-	encoder := gob.NewEncoder(&encoded)
-	err := encoder.Encode(tx)
-	errors.HandleErr(err)
+	tx.ID = tx.UnsignedHash()
+}
 
-	hash := sha256.Sum256(encoded.Bytes())
-	tx.ID = hash[:]
+// writeLegacyBytes writes b prefixed with its length, in the legacy serialization
+func writeLegacyBytes(buf *bytes.Buffer, b []byte) {
+	buf.Write(toHex(int64(len(b))))
+	buf.Write(b)
 }
 
-// CoinBaseTx is the first transaction in the block
-func CoinBaseTx(to, data string) *Transaction {
+// CoinBaseTx is the first transaction in the block at the height. It pays the
+// subsidy of the block and the fees of its other transactions to the address
+func CoinBaseTx(to, data string, height, fees int) (*Transaction, error) {
 	if data == "" {
-		data = fmt.Sprintf("Coins to %s", to)
+		// random data keeps the IDs of coinbase transactions to the same address unique
+		randData := make([]byte, 24)
+		if _, err := rand.Read(randData); err != nil {
+			return nil, err
+		}
+		data = fmt.Sprintf("%x", randData)
 	}
 
+	// the height makes the coinbases of different blocks unique, like in bitcoin
 	txin := TxInput{
 		ID:        []byte{},
 		Out:       -1,
-		Signature: nil,
-		PubKey:    []byte(data),
+		ScriptSig: script.NewBuilder().AddInt(int64(height)).AddData([]byte(data)).Script(),
+		Sequence:  SequenceFinal,
 	}
 
-	txout := NewTXOutput(100, to)
-
 	tx := Transaction{
+		Version: TxVersion,
 		Inputs:  []TxInput{txin},
-		Outputs: []TxOutput{*txout},
+	}
+	// outputs have a value, so a coinbase without reward, once the supply is
+	// issued, has no output
+	if reward := Subsidy(height) + fees; reward > 0 {
+		txout, err := NewTXOutput(reward, to)
+		if err != nil {
+			return nil, err
+		}
+		tx.Outputs = append(tx.Outputs, *txout)
 	}
 	tx.SetID()
 
-	return &tx
+	return &tx, nil
+}
+
+// outputValue returns the total value of the outputs of the transaction. It
+// fails with ErrInvalidTransaction if an output has no value or if the values
+// add up to more than the MaxSupply of the network, which keeps the sums of
+// values from overflowing
+func (tx *Transaction) outputValue() (int, error) {
+	maxSupply := config.Params().MaxSupply
+
+	value := 0
+	for outIdx, out := range tx.Outputs {
+		if out.Value <= 0 || out.Value > maxSupply {
+			return 0, errors.NewOutputValueError(tx.ID, "output %d has a value of %d", outIdx, out.Value)
+		}
+		value += out.Value
+		if value > maxSupply {
+			return 0, errors.NewOutputValueError(tx.ID, "the outputs add up to more than the maximum supply %d", maxSupply)
+		}
+	}
+
+	return value, nil
+}
+
+// Fee returns the fee of the transaction, the value of the outputs it spends
+// minus the value of the outputs it creates. prevTXs are the transactions whose
+// outputs are spent. It fails with ErrInvalidTransaction if the transaction
+// creates more value than it spends or if its output values are invalid, see outputValue
+func (tx *Transaction) Fee(prevTXs map[string]Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	if err := tx.checkPrevTransactions(prevTXs); err != nil {
+		return 0, err
+	}
+
+	inputValue := 0
+	for _, in := range tx.Inputs {
+		inputValue += prevTXs[hex.EncodeToString(in.ID)].Outputs[in.Out].Value
+	}
+
+	outputValue, err := tx.outputValue()
+	if err != nil {
+		return 0, err
+	}
+	if outputValue > inputValue {
+		return 0, errors.NewOverspendError(tx.ID, inputValue, outputValue)
+	}
+
+	return inputValue - outputValue, nil
 }
 
-func (tx *Transaction) isCoinbase() bool {
+// FeeForRate returns the fee paying the fee rate, per FeeRateUnit bytes, for size bytes
+func FeeForRate(feeRate, size int) int {
+	return (feeRate*size + FeeRateUnit - 1) / FeeRateUnit
+}
+
+// IsCoinbase checks if the transaction is a coinbase, which creates coins out of nothing
+func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 &&
 		len(tx.Inputs[0].ID) == 0 &&
 		tx.Inputs[0].Out == -1
 }
 
-// NewTransaction creates and returns a new transaction
-func NewTransaction(from, to string, amount int, chain *BlockChain) (tx *Transaction) {
+// DeserializeTransaction decodes a transaction encoded by Serialize and computes its ID
+func DeserializeTransaction(data []byte) (Transaction, error) {
+	d := newDecoder(data)
+	tx := d.readTransaction()
+	if err := d.finish(); err != nil {
+		return Transaction{}, err
+	}
+	tx.SetID()
+
+	return tx, nil
+}
+
+// NewTransaction creates and returns a new transaction spending the outputs of the
+// wallet to send the amount to the address, leaving the fee to the miner. A lock
+// time other than 0 keeps the transaction out of the blocks until it, see IsFinal.
+// It fails with an *errors.InsufficientFundsError if the wallet cannot pay the amount and the fee
+func NewTransaction(w *wallet.Wallet, to string, amount, fee int, lockTime int64, UTXO *UTXOSet) (*Transaction, error) {
+	tx, err := NewUnsignedTransaction(string(w.Address()), to, amount, fee, lockTime, UTXO)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := UTXO.Blockchain.SignTransaction(tx, w.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// NewUnsignedTransaction creates a transaction spending the outputs of the
+// address to send the amount to another address, sending the change back.
+// Its inputs have no unlocking scripts yet
+func NewUnsignedTransaction(from, to string, amount, fee int, lockTime int64, UTXO *UTXOSet) (*Transaction, error) {
 	var inputs []TxInput
 	var outputs []TxOutput
 
-	wallets, err := wallet.CreateWallets()
-	errors.HandleErr(err)
-	w := wallets.GetWallet(from)
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	if amount <= 0 {
+		return nil, errors.NewInvalidAmountError("amount", amount)
+	}
+	if fee < 0 {
+		return nil, errors.NewInvalidAmountError("fee", fee)
+	}
+	if lockTime < 0 {
+		return nil, errors.NewInvalidAmountError("lock time", int(lockTime))
+	}
+
+	lockingScript, err := wallet.AddressToScript(from)
+	if err != nil {
+		return nil, err
+	}
 
-	acc, validOutputs := chain.FindSpendableOutputs(pubKeyHash, amount)
+	acc, validOutputs, err := UTXO.FindSpendableOutputs(lockingScript, amount+fee)
+	if err != nil {
+		return nil, err
+	}
 
-	if acc < amount {
-		log.Panic("Error, not enough funds... :(")
+	if acc < amount+fee {
+		return nil, errors.NewInsufficientFundsError(from, acc, amount+fee)
 	}
 
 	for txid, outs := range validOutputs {
 		txID, err := hex.DecodeString(txid)
-		errors.HandleErr(err)
+		if err != nil {
+			return nil, err
+		}
 
 		for _, out := range outs {
 			input := TxInput{
 				ID:        txID,
 				Out:       out,
-				Signature: nil,
-				PubKey:    w.PublicKey,
+				ScriptSig: nil,
+				Sequence:  lockTimeSequence(lockTime),
 			}
 			inputs = append(inputs, input)
 		}
 	}
 
-	output := *NewTXOutput(amount, to)
-	outputs = append(outputs, output)
+	output, err := NewTXOutput(amount, to)
+	if err != nil {
+		return nil, err
+	}
+	outputs = append(outputs, *output)
+
+	if acc > amount+fee {
+		change, err := NewTXOutput(acc-amount-fee, from)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *change)
+	}
 
-	if acc > amount {
-		output = *NewTXOutput(acc-amount, from)
-		outputs = append(outputs, output)
+	tx := &Transaction{
+		Version:  TxVersion,
+		Inputs:   inputs,
+		Outputs:  outputs,
+		LockTime: lockTime,
 	}
+	tx.SetID()
 
-	tx = &Transaction{
-		Inputs:  inputs,
-		Outputs: outputs,
+	return tx, nil
+}
+
+// NewTransactionWithFeeRate creates a transaction like NewTransaction, with a fee
+// paying the fee rate (per FeeRateUnit bytes) for the size of the transaction
+func NewTransactionWithFeeRate(w *wallet.Wallet, to string, amount, feeRate int, lockTime int64, UTXO *UTXOSet) (*Transaction, error) {
+	if feeRate < 0 {
+		return nil, errors.NewInvalidAmountError("fee rate", feeRate)
 	}
 
-	tx.ID = tx.Hash()
-	chain.SignTransaction(tx, w.PrivateKey)
+	// a higher fee can take more inputs and make the transaction bigger,
+	// so the fee is raised until it pays for the size of the transaction
+	fee := 0
+	for {
+		tx, err := NewTransaction(w, to, amount, fee, lockTime, UTXO)
+		if err != nil {
+			return nil, err
+		}
 
-	return tx
+		required := FeeForRate(feeRate, tx.Size())
+		if fee >= required {
+			return tx, nil
+		}
+		fee = required
+	}
 }
 
-// TrimmedCopy returns a copy of the transaction without the signature and the public key
+// TrimmedCopy returns a copy of the transaction without the unlocking scripts
 func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []TxInput
 	var outputs []TxOutput
@@ -148,106 +364,205 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 		inputCopy := TxInput{
 			ID:        input.ID,
 			Out:       input.Out,
-			Signature: nil,
-			PubKey:    nil,
+			ScriptSig: nil,
+			Sequence:  input.Sequence,
 		}
 		inputs = append(inputs, inputCopy)
 	}
 
 	for _, output := range tx.Outputs {
 		outputCopy := TxOutput{
-			Value:      output.Value,
-			PubKeyHash: output.PubKeyHash,
+			Value:        output.Value,
+			ScriptPubKey: output.ScriptPubKey,
 		}
 		outputs = append(outputs, outputCopy)
 	}
 
 	txCopy := Transaction{
-		ID:      tx.ID,
-		Inputs:  inputs,
-		Outputs: outputs,
+		ID:       tx.ID,
+		Version:  tx.Version,
+		Inputs:   inputs,
+		Outputs:  outputs,
+		LockTime: tx.LockTime,
 	}
 
 	return txCopy
 }
 
-// Sign signs the transaction with the passed in private key
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
-	if tx.isCoinbase() {
-		return
+// Sign signs the transaction with the passed in private key. Every input has to
+// spend an output locked to the address of the key
+func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
 	}
 
-	for _, input := range tx.Inputs {
-		prevTx := prevTXs[hex.EncodeToString(input.ID)]
-		if prevTx.ID == nil {
-			log.Panic("ERROR: Previous transaction does not exist")
+	if err := tx.checkPrevTransactions(prevTXs); err != nil {
+		return err
+	}
+
+	pubKey := publicKey(privKey)
+
+	for inputID, input := range tx.Inputs {
+		prevScript := prevTXs[hex.EncodeToString(input.ID)].Outputs[input.Out].ScriptPubKey
+		if _, ok := script.ExtractPubKeyHash(prevScript); !ok {
+			return errors.NewInvalidTransactionError(tx.ID)
+		}
+
+		signature, err := signHash(privKey, tx.SignatureHash(inputID, prevScript))
+		if err != nil {
+			return err
 		}
+		tx.Inputs[inputID].ScriptSig = script.PayToPubKeyHashUnlock(signature, pubKey)
 	}
 
-	txCopy := tx.TrimmedCopy()
+	return nil
+}
 
-	for inputID, input := range txCopy.Inputs {
-		prevTx := prevTXs[hex.EncodeToString(input.ID)]
-		txCopy.Inputs[inputID].Signature = nil
-		txCopy.Inputs[inputID].PubKey = prevTx.Outputs[input.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inputID].PubKey = nil
+// publicKey returns the public key of the private key, with its coordinates padded
+// like the public keys of the wallets
+func publicKey(privKey ecdsa.PrivateKey) []byte {
+	return append(privKey.PublicKey.X.FillBytes(make([]byte, 32)), privKey.PublicKey.Y.FillBytes(make([]byte, 32))...)
+}
+
+// Verify runs the unlocking script of every input of the transaction against the
+// locking script of the output it spends. It fails with ErrInvalidSignature,
+// wrapping the ErrScript of the script, if an input does not unlock its output
+func (tx *Transaction) Verify(prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	if err := tx.checkPrevTransactions(prevTXs); err != nil {
+		return err
+	}
+
+	for inputID, input := range tx.Inputs {
+		prevScript := prevTXs[hex.EncodeToString(input.ID)].Outputs[input.Out].ScriptPubKey
+		checker := &txChecker{
+			tx:         tx,
+			index:      inputID,
+			scriptCode: scriptCode(input.ScriptSig, prevScript),
+		}
+
+		if err := script.Execute(input.ScriptSig, prevScript, checker); err != nil {
+			return fmt.Errorf("%w: %v", errors.NewInvalidSignatureError(tx.ID, inputID), err)
+		}
+	}
+
+	return nil
+}
+
+// scriptCode returns the script the signatures of an input commit to: the locking
+// script of the output it spends, or its redeem script if the output pays to a script hash
+func scriptCode(unlocking, prevScript script.Script) script.Script {
+	if !script.IsPayToScriptHash(prevScript) {
+		return prevScript
+	}
+	redeemScript, _ := script.RedeemScript(unlocking)
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		errors.HandleErr(err)
+	return redeemScript
+}
 
-		signature := append(r.Bytes(), s.Bytes()...)
+// txChecker checks the signatures and the lock times of the scripts unlocking an input of a transaction
+type txChecker struct {
+	tx         *Transaction
+	index      int
+	scriptCode script.Script // see scriptCode
+	sigHash    []byte        // computed by the first signature check
+}
 
-		tx.Inputs[inputID].Signature = signature
+func (c *txChecker) CheckSig(signature, pubKey []byte) bool {
+	if c.sigHash == nil {
+		c.sigHash = c.tx.SignatureHash(c.index, c.scriptCode)
 	}
+
+	return verifySignature(c.sigHash, signature, pubKey)
+}
+
+// CheckLockTime checks that the lock time of the transaction is at least the lock
+// time of the script, of the same kind, and that it applies to the input
+func (c *txChecker) CheckLockTime(lockTime int64) bool {
+	if (lockTime < LockTimeThreshold) != (c.tx.LockTime < LockTimeThreshold) {
+		return false
+	}
+	if lockTime > c.tx.LockTime {
+		return false
+	}
+
+	return c.tx.Inputs[c.index].Sequence != SequenceFinal
 }
 
-// Verify verifies the transaction
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
-	if tx.isCoinbase() {
+// CheckSequence checks that the relative lock time of the input is at least the
+// relative lock time of the script, of the same kind. A script sequence with
+// SequenceLockTimeDisabled always passes
+func (c *txChecker) CheckSequence(sequence int64) bool {
+	if sequence < 0 || sequence > int64(SequenceFinal) {
+		return false
+	}
+
+	scriptSequence := uint32(sequence)
+	if scriptSequence&SequenceLockTimeDisabled != 0 {
 		return true
 	}
 
-	for _, input := range tx.Inputs {
-		prevTx := prevTXs[hex.EncodeToString(input.ID)]
-		if prevTx.ID == nil {
-			log.Panic("ERROR: Previous transaction does not exist")
-		}
+	txSequence := c.tx.Inputs[c.index].Sequence
+	if txSequence&SequenceLockTimeDisabled != 0 {
+		return false
 	}
 
-	txCopy := tx.TrimmedCopy()
+	mask := SequenceLockTimeIsSeconds | SequenceLockTimeMask
+	scriptSequence, txSequence = scriptSequence&mask, txSequence&mask
+	if (scriptSequence < SequenceLockTimeIsSeconds) != (txSequence < SequenceLockTimeIsSeconds) {
+		return false
+	}
+
+	return scriptSequence <= txSequence
+}
+
+// signHash signs the hash with the key. The signature is r followed by s, both padded to 32 bytes
+func signHash(privKey ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// r and s are padded to the same length so that verifySignature can split them apart
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), nil
+}
+
+// verifySignature checks the signature of the hash by the public key, the X
+// coordinate of the key followed by its Y coordinate
+func verifySignature(hash, signature, pubKey []byte) bool {
+	if len(signature) == 0 || len(signature)%2 != 0 || len(pubKey) == 0 || len(pubKey)%2 != 0 {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:len(signature)/2])
+	s := new(big.Int).SetBytes(signature[len(signature)/2:])
+
 	curve := elliptic.P256()
+	x := new(big.Int).SetBytes(pubKey[:len(pubKey)/2])
+	y := new(big.Int).SetBytes(pubKey[len(pubKey)/2:])
+	if !curve.IsOnCurve(x, y) {
+		return false
+	}
 
-	for inputID, input := range tx.Inputs {
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s)
+}
+
+// checkPrevTransactions checks that prevTXs has the outputs spent by the transaction
+func (tx *Transaction) checkPrevTransactions(prevTXs map[string]Transaction) error {
+	for _, input := range tx.Inputs {
 		prevTx := prevTXs[hex.EncodeToString(input.ID)]
-		txCopy.Inputs[inputID].Signature = nil
-		txCopy.Inputs[inputID].PubKey = prevTx.Outputs[input.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inputID].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		signatureLen := len(input.Signature)
-		r.SetBytes(input.Signature[:(signatureLen / 2)])
-		s.SetBytes(input.Signature[(signatureLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(input.PubKey)
-		x.SetBytes(input.PubKey[:(keyLen / 2)])
-		y.SetBytes(input.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{
-			Curve: curve,
-			X:     &x,
-			Y:     &y,
+		if prevTx.ID == nil {
+			return errors.NewTransactionNotFoundError(input.ID)
 		}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
-			return false
+		if input.Out < 0 || input.Out >= len(prevTx.Outputs) {
+			return errors.NewInvalidTransactionError(tx.ID)
 		}
 	}
 
-	return true
+	return nil
 }
 
 func (tx Transaction) String() string {
@@ -259,14 +574,18 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("\tInput %d:", i))
 		lines = append(lines, fmt.Sprintf("\t\tTXID:     %x", input.ID))
 		lines = append(lines, fmt.Sprintf("\t\tOut:       %d", input.Out))
-		lines = append(lines, fmt.Sprintf("\t\tSignature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("\t\tPubKey:    %x", input.PubKey))
+		lines = append(lines, fmt.Sprintf("\t\tScript:    %s", input.ScriptSig))
+		lines = append(lines, fmt.Sprintf("\t\tSequence:  %08x", input.Sequence))
 	}
 
 	for i, output := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("\tOutput %d:", i))
 		lines = append(lines, fmt.Sprintf("\t\tValue:  %d", output.Value))
-		lines = append(lines, fmt.Sprintf("\t\tScript: %x", output.PubKeyHash))
+		lines = append(lines, fmt.Sprintf("\t\tScript: %s", output.ScriptPubKey))
+	}
+
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("\tLock time: %d", tx.LockTime))
 	}
 
 	return strings.Join(lines, "\n")
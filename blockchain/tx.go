@@ -2,48 +2,72 @@ package blockchain
 
 import (
 	"bytes"
+	"go-blockchain/script"
 	"go-blockchain/wallet"
 )
 
 // TxInput is the transaction input
 type TxInput struct {
-	ID        []byte // transaction ID
-	Out       int    // index of the output
-	Signature []byte // digital signature
-	PubKey    []byte // unhashed public key
+	ID        []byte        // transaction ID
+	Out       int           // index of the output
+	ScriptSig script.Script // unlocking script, the data of the coinbase for coinbase inputs
+	Sequence  uint32        // relative lock time of the input, see SequenceFinal
 }
 
 // TxOutput is the transaction output
 type TxOutput struct {
-	Value      int    // value in tokens
-	PubKeyHash []byte // hashed public key
+	Value        int           // value in tokens
+	ScriptPubKey script.Script // locking script
 }
 
 // NewTXOutput creates a new transaction output and locks it
-func NewTXOutput(value int, address string) *TxOutput {
-	txo := &TxOutput{Value: value, PubKeyHash: nil}
-	txo.Lock([]byte(address))
+func NewTXOutput(value int, address string) (*TxOutput, error) {
+	txo := &TxOutput{Value: value, ScriptPubKey: nil}
+	if err := txo.Lock([]byte(address)); err != nil {
+		return nil, err
+	}
 
-	return txo
+	return txo, nil
 }
 
-// UsesKey checks if the transaction input uses the passed in public key hash passed in to lock it
+// UsesKey checks if the transaction input unlocks its output with the public key of the passed in public key hash
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := wallet.PublicKeyHash(in.PubKey)
+	items, err := in.ScriptSig.PushedData()
+	if err != nil || len(items) != 2 {
+		return false
+	}
 
-	return bytes.Compare(pubKeyHash, lockingHash) == 0
+	return bytes.Compare(pubKeyHash, wallet.PublicKeyHash(items[1])) == 0
 }
 
 // Lock will lock the output ensuing that the output can only be unlocked by the passed in address
-func (out *TxOutput) Lock(address []byte) {
-	decodedAddress := wallet.Base58Decode(address)
-	pubKeyHash := decodedAddress[1 : len(decodedAddress)-wallet.ChecksumLength]
-	out.PubKeyHash = pubKeyHash
+// It fails with ErrInvalidAddress if the address is not valid
+func (out *TxOutput) Lock(address []byte) error {
+	lockingScript, err := wallet.AddressToScript(string(address))
+	if err != nil {
+		return err
+	}
+	out.ScriptPubKey = lockingScript
+
+	return nil
+}
+
+// PubKeyHash returns the public key hash the output is locked with, if it is
+// locked to an address
+func (out *TxOutput) PubKeyHash() ([]byte, bool) {
+	return script.ExtractPubKeyHash(out.ScriptPubKey)
+}
+
+// IsLockedWith checks if the output is locked with the passed in locking script
+func (out *TxOutput) IsLockedWith(lockingScript script.Script) bool {
+	return bytes.Equal(out.ScriptPubKey, lockingScript)
 }
 
 // IsLockedWithKey checks if the output is locked with the passed in public key hash
 func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
+	lockingHash, ok := out.PubKeyHash()
+
+	return ok && bytes.Compare(lockingHash, pubKeyHash) == 0
 }
 
 // // CanUnlock means the account(data) owns the information referenced by the input
@@ -0,0 +1,154 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"go-blockchain/errors"
+
+	"go-blockchain/storage"
+)
+
+// Transaction index
+
+// The transaction index is optional. When it is enabled, every transaction of the
+// main chain is indexed by its ID, so that FindTransaction reads a single block
+// instead of walking the chain. The key of a transaction is txIndexPrefix followed
+// by its ID and its value is the hash of its block followed by its position in the
+// block as 4 big-endian bytes. The txIndexKey key marks a chain whose index is
+// complete and kept up to date when blocks are connected to or disconnected from
+// the main chain
+
+var (
+	// txIndexPrefix is prepended to the ID of every entry of the transaction index
+	txIndexPrefix = []byte("t-")
+	// txIndexKey is set when the transaction index is enabled
+	txIndexKey = []byte("txindex")
+)
+
+func txIndexEntryKey(ID []byte) []byte {
+	key := make([]byte, 0, len(txIndexPrefix)+len(ID))
+	key = append(key, txIndexPrefix...)
+
+	return append(key, ID...)
+}
+
+func txIndexEnabled(txn storage.Txn) (bool, error) {
+	_, err := txn.Get(txIndexKey)
+	if err == storage.ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// indexTransactions adds the transactions of the block to the transaction index
+func indexTransactions(txn storage.Txn, block *Block) error {
+	for i, tx := range block.Transactions {
+		location := make([]byte, len(block.Hash)+4)
+		copy(location, block.Hash)
+		binary.BigEndian.PutUint32(location[len(block.Hash):], uint32(i))
+
+		if err := txn.Put(txIndexEntryKey(tx.ID), location); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexTransactions removes the transactions of the block from the transaction index
+func unindexTransactions(txn storage.Txn, block *Block) error {
+	for _, tx := range block.Transactions {
+		if err := txn.Delete(txIndexEntryKey(tx.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findIndexedTransaction reads the transaction from the block the transaction index points to
+func findIndexedTransaction(txn storage.Txn, ID []byte) (Transaction, error) {
+	location, err := txn.Get(txIndexEntryKey(ID))
+	if err == storage.ErrNotFound {
+		return Transaction{}, errors.NewTransactionNotFoundError(ID)
+	}
+	if err != nil {
+		return Transaction{}, err
+	}
+	hash, position := location[:len(location)-4], binary.BigEndian.Uint32(location[len(location)-4:])
+
+	block, err := getBlock(txn, hash)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if int(position) >= len(block.Transactions) {
+		return Transaction{}, errors.NewTransactionNotFoundError(ID)
+	}
+
+	return *block.Transactions[position], nil
+}
+
+// HasTxIndex tells if the transaction index of the chain is enabled
+func (chain *BlockChain) HasTxIndex() (bool, error) {
+	var enabled bool
+
+	err := chain.Database.View(func(txn storage.Txn) error {
+		var err error
+		enabled, err = txIndexEnabled(txn)
+
+		return err
+	})
+
+	return enabled, err
+}
+
+// ReindexTransactions rebuilds the transaction index from the blocks of the main
+// chain and enables it. It returns the number of indexed transactions
+func (chain *BlockChain) ReindexTransactions() (int, error) {
+	if err := chain.DropTxIndex(); err != nil {
+		return 0, err
+	}
+
+	hashes, err := chain.GetBlockHashes(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	// a store may limit the size of a transaction, so every block is indexed in its own
+	for _, hash := range hashes {
+		err := chain.Database.Update(func(txn storage.Txn) error {
+			block, err := getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+			count += len(block.Transactions)
+
+			return indexTransactions(txn, block)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = chain.Database.Update(func(txn storage.Txn) error {
+		return txn.Put(txIndexKey, []byte{})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// DropTxIndex disables the transaction index and deletes its entries
+func (chain *BlockChain) DropTxIndex() error {
+	err := chain.Database.Update(func(txn storage.Txn) error {
+		return txn.Delete(txIndexKey)
+	})
+	if err != nil {
+		return err
+	}
+
+	return storage.DeleteByPrefix(chain.Database, txIndexPrefix)
+}
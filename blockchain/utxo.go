@@ -0,0 +1,278 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"go-blockchain/errors"
+	"go-blockchain/script"
+	"sort"
+
+	"go-blockchain/storage"
+)
+
+// utxoPrefix is prepended to the transaction ID of every entry in the UTXO set
+var utxoPrefix = []byte("utxo-")
+
+// UTXOSet is an index of all the unspent transaction outputs in the chain.
+// It lives in the same database as the blocks so that balance lookups do not
+// have to walk the whole chain
+type UTXOSet struct {
+	Blockchain *BlockChain
+}
+
+// TxOutputs holds the unspent outputs of a single transaction keyed by their index
+type TxOutputs struct {
+	Outputs map[int]TxOutput
+	Height  int // height of the block of the transaction, which relative lock times count from
+}
+
+// Serialize encodes the outputs, see EncodingVersion
+func (outs TxOutputs) Serialize() []byte {
+	var e encoder
+	e.WriteByte(EncodingVersion)
+	e.writeOutputs(outs)
+
+	return e.Bytes()
+}
+
+// DeserializeOutputs decodes outputs encoded by TxOutputs.Serialize
+func DeserializeOutputs(data []byte) (TxOutputs, error) {
+	d := newDecoder(data)
+	outs := d.readOutputs()
+
+	return outs, d.finish()
+}
+
+// utxoKey returns the key of the UTXO set entry for the transaction with the given ID
+func utxoKey(txID []byte) []byte {
+	key := make([]byte, 0, len(utxoPrefix)+len(txID))
+	key = append(key, utxoPrefix...)
+
+	return append(key, txID...)
+}
+
+// sortedIndexes returns the output indexes in ascending order
+func (outs TxOutputs) sortedIndexes() []int {
+	var indexes []int
+	for outIdx := range outs.Outputs {
+		indexes = append(indexes, outIdx)
+	}
+	sort.Ints(indexes)
+
+	return indexes
+}
+
+// FindUTXO finds all the unspent transaction outputs locked with the given locking script
+func (u UTXOSet) FindUTXO(lockingScript script.Script) ([]TxOutput, error) {
+	var UTXOs []TxOutput
+
+	err := u.forEach(func(txID string, outs TxOutputs) bool {
+		for _, outIdx := range outs.sortedIndexes() {
+			out := outs.Outputs[outIdx]
+			if out.IsLockedWith(lockingScript) {
+				UTXOs = append(UTXOs, out)
+			}
+		}
+		return true
+	})
+
+	return UTXOs, err
+}
+
+// FindSpendableOutputs finds enough unspent outputs locked with the given locking script
+// to cover amount and returns their total value together with their indexes by transaction
+func (u UTXOSet) FindSpendableOutputs(lockingScript script.Script, amount int) (int, map[string][]int, error) {
+	unspentOuts := make(map[string][]int)
+	accumulated := 0
+
+	err := u.forEach(func(txID string, outs TxOutputs) bool {
+		for _, outIdx := range outs.sortedIndexes() {
+			out := outs.Outputs[outIdx]
+			if out.IsLockedWith(lockingScript) && accumulated < amount {
+				accumulated += out.Value
+				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
+			}
+		}
+		return accumulated < amount
+	})
+
+	return accumulated, unspentOuts, err
+}
+
+// FindOutput returns the output of the transaction with the given ID at index out,
+// if it is unspent
+func (u UTXOSet) FindOutput(txID []byte, out int) (TxOutput, bool, error) {
+	var output TxOutput
+	found := false
+
+	err := u.Blockchain.Database.View(func(txn storage.Txn) error {
+		value, err := txn.Get(utxoKey(txID))
+		if err == storage.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		outs, err := DeserializeOutputs(value)
+		if err != nil {
+			return err
+		}
+		output, found = outs.Outputs[out]
+
+		return nil
+	})
+
+	return output, found, err
+}
+
+// CountTransactions returns the number of transactions with at least one unspent output
+func (u UTXOSet) CountTransactions() (int, error) {
+	counter := 0
+
+	err := u.forEach(func(txID string, outs TxOutputs) bool {
+		counter++
+		return true
+	})
+
+	return counter, err
+}
+
+// Reindex rebuilds the UTXO set from the blocks in the chain
+func (u UTXOSet) Reindex() error {
+	db := u.Blockchain.Database
+
+	if err := storage.DeleteByPrefix(db, utxoPrefix); err != nil {
+		return err
+	}
+
+	UTXO, err := u.Blockchain.FindUTXO()
+	if err != nil {
+		return err
+	}
+
+	batch := db.NewBatch()
+	for txID, outs := range UTXO {
+		key, err := hex.DecodeString(txID)
+		if err != nil {
+			batch.Cancel()
+			return err
+		}
+		if err := batch.Put(utxoKey(key), outs.Serialize()); err != nil {
+			batch.Cancel()
+			return err
+		}
+	}
+
+	return batch.Flush()
+}
+
+// forEach calls fn for every entry of the UTXO set until fn returns false
+func (u UTXOSet) forEach(fn func(txID string, outs TxOutputs) bool) error {
+	db := u.Blockchain.Database
+
+	return db.View(func(txn storage.Txn) error {
+		return txn.Iterate(utxoPrefix, func(key, value []byte) error {
+			outs, err := DeserializeOutputs(value)
+			if err != nil {
+				return err
+			}
+
+			txID := hex.EncodeToString(bytes.TrimPrefix(key, utxoPrefix))
+			if !fn(txID, outs) {
+				return storage.ErrStop
+			}
+
+			return nil
+		})
+	})
+}
+
+// SpentOutput is an output spent by a transaction of a block. The spent outputs
+// of a block are kept so that the block can be disconnected from the UTXO set
+type SpentOutput struct {
+	TxID   []byte
+	Out    int
+	Output TxOutput
+	Height int // see TxOutputs
+}
+
+// getUTXO reads the unspent outputs of the transaction with the given ID inside txn.
+// A transaction without unspent outputs has an empty set of outputs
+func getUTXO(txn storage.Txn, txID []byte) (TxOutputs, error) {
+	value, err := txn.Get(utxoKey(txID))
+	if err == storage.ErrNotFound {
+		return TxOutputs{Outputs: make(map[int]TxOutput)}, nil
+	}
+	if err != nil {
+		return TxOutputs{}, err
+	}
+
+	return DeserializeOutputs(value)
+}
+
+// setUTXO writes the unspent outputs of the transaction with the given ID inside
+// txn, deleting its entry when none are left
+func setUTXO(txn storage.Txn, txID []byte, outs TxOutputs) error {
+	if len(outs.Outputs) == 0 {
+		return txn.Delete(utxoKey(txID))
+	}
+
+	return txn.Put(utxoKey(txID), outs.Serialize())
+}
+
+// applyTransaction applies tx, confirmed by the block at height, to the UTXO set
+// inside txn, removing the outputs it spends and adding the outputs it creates.
+// It returns the spent outputs
+func applyTransaction(txn storage.Txn, tx *Transaction, height int) ([]SpentOutput, error) {
+	var spent []SpentOutput
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			outs, err := getUTXO(txn, in.ID)
+			if err != nil {
+				return nil, err
+			}
+			out, ok := outs.Outputs[in.Out]
+			if !ok {
+				return nil, errors.NewTransactionNotFoundError(in.ID)
+			}
+			spent = append(spent, SpentOutput{TxID: in.ID, Out: in.Out, Output: out, Height: outs.Height})
+
+			delete(outs.Outputs, in.Out)
+			if err := setUTXO(txn, in.ID, outs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	newOutputs := TxOutputs{Outputs: make(map[int]TxOutput), Height: height}
+	for outIdx, out := range tx.Outputs {
+		newOutputs.Outputs[outIdx] = out
+	}
+
+	return spent, setUTXO(txn, tx.ID, newOutputs)
+}
+
+// revertTransaction undoes applyTransaction: it removes the outputs created by tx
+// and restores the outputs it spent. The transactions of a block have to be
+// reverted in the reverse order they were applied
+func revertTransaction(txn storage.Txn, tx *Transaction, spent []SpentOutput) error {
+	if err := txn.Delete(utxoKey(tx.ID)); err != nil {
+		return err
+	}
+
+	for _, s := range spent {
+		outs, err := getUTXO(txn, s.TxID)
+		if err != nil {
+			return err
+		}
+		outs.Outputs[s.Out] = s.Output
+		outs.Height = s.Height
+
+		if err := setUTXO(txn, s.TxID, outs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
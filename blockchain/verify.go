@@ -0,0 +1,241 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"go-blockchain/errors"
+	"time"
+)
+
+// chainState is the set of unspent outputs built while replaying the chain
+type chainState struct {
+	txs     map[string]*Transaction // transactions replayed so far by ID
+	heights map[string]int          // ID -> height of the block of the transaction
+	times   []int64                 // timestamps of the blocks replayed so far by height
+	outputs map[string]bool         // outpoints of the unspent outputs
+	spent   map[string]bool         // outpoints of the outputs spent so far
+}
+
+// Verify replays the whole chain from the genesis block and checks that every
+// block links to the previous one, has a valid seal for the consensus of the
+// chain, claims no more than the subsidy and the fees in its coinbase and only contains correctly signed
+// transactions spending existing unspent outputs, whose lock times it reaches.
+// Blocks below the height from are replayed without being checked. The first invalid block is reported as an
+// *errors.ChainVerificationError
+func (chain *BlockChain) Verify(ctx context.Context, from int) error {
+	state := chainState{
+		txs:     make(map[string]*Transaction),
+		heights: make(map[string]int),
+		outputs: make(map[string]bool),
+		spent:   make(map[string]bool),
+	}
+
+	hashes, err := chain.GetBlockHashes(nil)
+	if err != nil {
+		return err
+	}
+
+	var prev *Block
+	for height, hash := range hashes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+
+		if height >= from {
+			if err := chain.verifyBlock(block, prev, height, &state); err != nil {
+				return err
+			}
+		} else {
+			state.apply(block)
+		}
+
+		prev = block
+	}
+
+	return nil
+}
+
+// verifyBlock checks the block and applies it to state. Like connectBlock, every
+// transaction is applied before the next one is checked, so a transaction can spend
+// the outputs of the transactions before it in the block
+func (chain *BlockChain) verifyBlock(block, prev *Block, height int, state *chainState) error {
+	fail := func(reason errors.VerificationFailure, detail string, args ...interface{}) error {
+		return errors.NewChainVerificationError(height, block.Hash, reason, detail, args...)
+	}
+
+	if prev == nil && len(block.PrevHash) != 0 {
+		return fail(errors.BadLink, "the genesis block has a previous block")
+	}
+	if prev != nil && !bytes.Equal(block.PrevHash, prev.Hash) {
+		return fail(errors.BadLink, "previous hash is %x instead of %x", block.PrevHash, prev.Hash)
+	}
+	if block.Height != height {
+		return fail(errors.BadHeight, "height is %d", block.Height)
+	}
+
+	if err := chain.Consensus.VerifyHeader(chain, block); err != nil {
+		if !errors.Is(err, errors.ErrInvalidBlock) {
+			return err
+		}
+		return fail(errors.BadSeal, "%v", err)
+	}
+
+	if block.Timestamp > time.Now().Add(maxFutureBlockTime).Unix() {
+		return fail(errors.BadTimestamp, "%s", time.Unix(block.Timestamp, 0))
+	}
+	var mtp int64
+	if prev != nil {
+		mtp = state.medianTimePast(height - 1)
+		if block.Version >= medianTimeVersion && block.Timestamp <= mtp {
+			return fail(errors.BadTimestamp, "%s is not after the median time past %s", time.Unix(block.Timestamp, 0), time.Unix(mtp, 0))
+		}
+	}
+	clock := block.lockClock(mtp)
+	confirmation := state.confirmation(height, clock, block.Version >= medianTimeVersion)
+
+	if len(block.Transactions) == 0 {
+		return fail(errors.BadCoinbase, "the block has no transactions")
+	}
+
+	// the coinbase has to be the first transaction. The blocks before coinbaseVersion
+	// may have none, send mined them without one
+	if block.Version >= coinbaseVersion && !block.Transactions[0].IsCoinbase() {
+		return fail(errors.BadCoinbase, "the first transaction is not a coinbase")
+	}
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() && i != 0 {
+			return fail(errors.BadCoinbase, "transaction %d is a coinbase", i)
+		}
+		if !bytes.Equal(tx.ID, tx.UnsignedHash()) {
+			return fail(errors.BadTransactionID, "transaction %d is %x", i, tx.ID)
+		}
+	}
+	if root := block.HashTransactions(); !bytes.Equal(block.MerkleRoot, root) {
+		return fail(errors.BadMerkleRoot, "merkle root is %x instead of %x", block.MerkleRoot, root)
+	}
+
+	fees := 0
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			state.applyTransaction(tx, height)
+			continue
+		}
+
+		prevTXs := make(map[string]Transaction)
+		inputValue := 0
+		// spends of the transaction checked so far, to catch an input spending the same output again
+		txSpends := make(map[string]bool)
+
+		for _, in := range tx.Inputs {
+			point := outpoint(in.ID, in.Out)
+			if state.spent[point] || txSpends[point] {
+				return fail(errors.DoubleSpend, "transaction %x spends output %d of %x again", tx.ID, in.Out, in.ID)
+			}
+			if !state.outputs[point] {
+				return fail(errors.MissingInput, "transaction %x spends unknown output %d of %x", tx.ID, in.Out, in.ID)
+			}
+			txSpends[point] = true
+
+			prevTX := state.txs[hex.EncodeToString(in.ID)]
+			prevTXs[hex.EncodeToString(in.ID)] = *prevTX
+			inputValue += prevTX.Outputs[in.Out].Value
+		}
+
+		outputValue, err := tx.outputValue()
+		if err != nil {
+			return fail(errors.BadOutputValue, "%v", err)
+		}
+		if outputValue > inputValue {
+			return fail(errors.ValueMismatch, "transaction %x spends %d but creates %d", tx.ID, inputValue, outputValue)
+		}
+		fees += inputValue - outputValue
+
+		if err := tx.Verify(prevTXs); err != nil {
+			return fail(errors.BadSignature, "%v", err)
+		}
+		if err := tx.checkLocks(height, clock, confirmation); err != nil {
+			return fail(errors.LockedTransaction, "%v", err)
+		}
+
+		state.applyTransaction(tx, height)
+	}
+
+	if coinbase := block.Transactions[0]; coinbase.IsCoinbase() {
+		reward, err := coinbase.outputValue()
+		if err != nil {
+			return fail(errors.BadOutputValue, "%v", err)
+		}
+		if allowed := Subsidy(height) + fees; reward > allowed {
+			return fail(errors.BadCoinbaseReward, "the coinbase claims %d but the subsidy and the fees are %d", reward, allowed)
+		}
+	}
+	state.times = append(state.times, block.Timestamp)
+
+	return nil
+}
+
+// confirmation finds the confirmations of the outputs replayed so far, for the
+// block at height whose lock times are checked against blockTime. medianTime
+// tells if the block uses the median time past, see utxoConfirmation
+func (state *chainState) confirmation(height int, blockTime int64, medianTime bool) confirmationFunc {
+	return func(in TxInput) (int, int64, error) {
+		prevHeight := state.heights[hex.EncodeToString(in.ID)]
+		if prevHeight >= len(state.times) {
+			return height, blockTime, nil
+		}
+		if !medianTime {
+			return prevHeight, state.times[prevHeight], nil
+		}
+		if prevHeight == 0 {
+			return prevHeight, state.medianTimePast(0), nil
+		}
+
+		return prevHeight, state.medianTimePast(prevHeight - 1), nil
+	}
+}
+
+// medianTimePast returns the median time past of the block at height, which is
+// replayed already
+func (state *chainState) medianTimePast(height int) int64 {
+	first := height + 1 - medianTimeBlocks
+	if first < 0 {
+		first = 0
+	}
+
+	return medianTime(state.times[first : height+1])
+}
+
+// apply spends the outputs used by the block and adds the outputs it creates
+func (state *chainState) apply(block *Block) {
+	for _, tx := range block.Transactions {
+		state.applyTransaction(tx, block.Height)
+	}
+	state.times = append(state.times, block.Timestamp)
+}
+
+// applyTransaction spends the outputs used by the transaction of the block at
+// height and adds the outputs it creates. The timestamp of the block is only
+// added once all its transactions are applied, see confirmation
+func (state *chainState) applyTransaction(tx *Transaction, height int) {
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			point := outpoint(in.ID, in.Out)
+			delete(state.outputs, point)
+			state.spent[point] = true
+		}
+	}
+
+	txID := hex.EncodeToString(tx.ID)
+	state.txs[txID] = tx
+	state.heights[txID] = height
+	for outIdx := range tx.Outputs {
+		state.outputs[outpoint(tx.ID, outIdx)] = true
+	}
+}
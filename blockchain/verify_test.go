@@ -0,0 +1,177 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/hex"
+	"go-blockchain/config"
+	"go-blockchain/errors"
+	"testing"
+)
+
+func TestVerifyTransactionsSpendingTheirBlock(t *testing.T) {
+	w, to, last := newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	genesis := tip(t, chain)
+
+	// tx2 spends the output tx1 creates in the same block
+	tx1 := send(t, chain, w, to, 30)
+	output, err := NewTXOutput(30, string(last.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2 := &Transaction{
+		Version: TxVersion,
+		Inputs:  []TxInput{{ID: tx1.ID, Out: 0, Sequence: SequenceFinal}},
+		Outputs: []TxOutput{*output},
+	}
+	tx2.SetID()
+	if err := tx2.Sign(to.PrivateKey, map[string]Transaction{hex.EncodeToString(tx1.ID): *tx1}); err != nil {
+		t.Fatal(err)
+	}
+
+	addBlock(t, chain, genesis, newWallet(t), tx1, tx2)
+	if got := balance(t, chain, last); got != 30 {
+		t.Fatalf("the balance is %d, expected 30", got)
+	}
+	if got := balance(t, chain, to); got != 0 {
+		t.Fatalf("the balance of the spent output is %d, expected 0", got)
+	}
+	checkUTXOSet(t, chain)
+
+	if err := chain.Verify(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidOutputValuesAreRejected(t *testing.T) {
+	w, to, miner := newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	genesis := tip(t, chain)
+
+	for _, value := range []int{0, -5, config.Params().MaxSupply + 1} {
+		tx := send(t, chain, w, to, 30)
+		tx.Outputs[0].Value = value
+		tx.SetID()
+		if err := chain.SignTransaction(tx, w.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := chain.VerifyTransaction(tx); !errors.Is(err, errors.ErrInvalidTransaction) {
+			t.Fatalf("verifying an output of %d returned %v, expected ErrInvalidTransaction", value, err)
+		}
+		block := newBlock(t, chain, genesis, miner, tx)
+		if err := chain.AddBlock(block); !errors.Is(err, errors.ErrInvalidBlock) {
+			t.Fatalf("adding a block with an output of %d returned %v, expected ErrInvalidBlock", value, err)
+		}
+		if chain.HasBlock(block.Hash) {
+			t.Fatalf("the block with an output of %d is stored", value)
+		}
+	}
+	checkUTXOSet(t, chain)
+}
+
+func TestMedianTimePast(t *testing.T) {
+	w, to, miner := newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+	parent := tip(t, chain)
+	for i := 0; i < 3; i++ {
+		parent = addBlock(t, chain, parent, miner)
+	}
+
+	mtp, err := chain.MedianTimePast(parent.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := newBlock(t, chain, parent, miner); next.Timestamp <= mtp {
+		t.Fatalf("the new block has the timestamp %d, not after the median time past %d", next.Timestamp, mtp)
+	}
+
+	// a block at the median time past is rejected
+	coinbase, err := CoinBaseTx(string(miner.Address()), "", parent.Height+1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	early := &Block{
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			PrevHash:  parent.Hash,
+			Timestamp: mtp,
+			Height:    parent.Height + 1,
+		},
+		Transactions: []*Transaction{coinbase},
+	}
+	early.MerkleRoot = early.HashTransactions()
+	if err := chain.Consensus.Prepare(chain, early); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Consensus.Seal(context.Background(), early, PoWOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(early); !errors.Is(err, errors.ErrInvalidBlock) {
+		t.Fatalf("adding a block at the median time past returned %v, expected ErrInvalidBlock", err)
+	}
+
+	// a transaction locked until the median time past is not final yet, even
+	// though the timestamp of the next block passes it
+	UTXOSet := UTXOSet{Blockchain: chain}
+	tx, err := NewTransaction(w, string(to.Address()), 30, 0, mtp, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.CheckLocks(tx); !errors.Is(err, errors.ErrLockedTransaction) {
+		t.Fatalf("checking the locks returned %v, expected ErrLockedTransaction", err)
+	}
+	if err := chain.AddBlock(newBlock(t, chain, parent, miner, tx)); !errors.Is(err, errors.ErrInvalidBlock) {
+		t.Fatalf("adding a block with the locked transaction returned %v, expected ErrInvalidBlock", err)
+	}
+
+	if err := chain.Verify(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMinedTransactionsPayTheirFeesToTheMiner(t *testing.T) {
+	w, to, miner := newWallet(t), newWallet(t), newWallet(t)
+	chain := newTestChain(t, w)
+
+	UTXOSet := UTXOSet{Blockchain: chain}
+	tx, err := NewTransaction(w, string(to.Address()), 30, 7, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := chain.MineTransactions(context.Background(), string(miner.Address()), []*Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block.Transactions[0].IsCoinbase() {
+		t.Fatal("the first transaction of the block is not a coinbase")
+	}
+	if got, want := balance(t, chain, miner), Subsidy(1)+7; got != want {
+		t.Fatalf("the miner has %d, expected the subsidy and the fee %d", got, want)
+	}
+
+	// a block without coinbase is rejected
+	unpaid := &Block{
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			PrevHash:  block.Hash,
+			Timestamp: block.Timestamp + 1,
+			Height:    2,
+		},
+		Transactions: []*Transaction{send(t, chain, to, w, 10)},
+	}
+	unpaid.MerkleRoot = unpaid.HashTransactions()
+	if err := chain.Consensus.Prepare(chain, unpaid); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Consensus.Seal(context.Background(), unpaid, PoWOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(unpaid); !errors.Is(err, errors.ErrInvalidBlock) {
+		t.Fatalf("adding a block without coinbase returned %v, expected ErrInvalidBlock", err)
+	}
+
+	if err := chain.Verify(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,30 +1,60 @@
 package commandline
 
 import (
+	"context"
+	"encoding/hex"
 	"flag"
 	"fmt"
 
 	"go-blockchain/blockchain"
+	"go-blockchain/config"
 	"go-blockchain/errors"
+	"go-blockchain/network"
+	"go-blockchain/rpc"
+	"go-blockchain/storage"
 	"go-blockchain/wallet"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // TODO? replace with a preexisting package
 
-type CommandLine struct{}
+// CommandLine runs the commands with the config of the node
+type CommandLine struct {
+	config *config.Config
+}
 
 func (cli *CommandLine) printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println(" printchain - Prints all the blocks in the chain")
 	fmt.Println(" getbalance -address ADDRESS - gets the balance for a given address")
-	fmt.Println(" createblockchain -address ADDRESS - creates a blockchain")
-	fmt.Println(" send -from FROM -to TO -amount -AMOUNT Send amount")
+	fmt.Println(" createblockchain -address ADDRESS [-txindex] - creates a blockchain, with a transaction index if -txindex is given")
+	fmt.Println(" send -from FROM -to TO -amount -AMOUNT [-fee FEE | -feerate RATE] [-locktime LOCKTIME] [-mine=false] [-node HOST:PORT] Send amount, queuing it in the mempool of a node when -mine=false")
 	fmt.Println(" createwallet - Creates a new Wallet")
-	fmt.Println(" listaddresses - Lists the addresses in our wallet file")
+	fmt.Println(" restorewallet -mnemonic \"WORDS\" - Restores the wallet file from its recovery phrase, finding its used addresses in the chain")
+	fmt.Println(" encryptwallet - Encrypts the wallet file with a passphrase")
+	fmt.Println(" changepassphrase - Changes the passphrase of the encrypted wallet file")
+	fmt.Println(" listaddresses [-pubkeys] - Lists the addresses in our wallet file, with their public keys if -pubkeys is given")
+	fmt.Println(" createmultisig -required M -pubkeys KEY,... - Adds a multisig address requiring M signatures of the public keys to the wallet file")
+	fmt.Println(" createrawtx -from FROM -to TO -amount AMOUNT [-fee FEE] [-locktime LOCKTIME] -out FILE - Writes an unsigned transaction and the outputs it spends to FILE, FROM can be a multisig address")
+	fmt.Println(" signrawtx -in FILE [-out FILE] - Signs the transaction of FILE with the keys of the wallet file, without the chain")
+	fmt.Println(" combinerawtx -in FILE,... -out FILE - Merges the signatures of copies of a transaction")
+	fmt.Println(" broadcastrawtx -in FILE [-miner ADDRESS | -mine=false] [-node HOST:PORT] - Finalizes and verifies the signed transaction of FILE and mines it in a block paying ADDRESS, or queues it like send")
+	fmt.Println(" reindexutxo - Rebuilds the UTXO set")
+	fmt.Println(" reindex [-txindex=false] - Rebuilds and enables the transaction index, or drops it with -txindex=false")
+	fmt.Println(" supply - Prints the number of coins issued at the tip of the chain")
+	fmt.Println(" verifychain [-from HEIGHT] - Verifies every block of the chain, fully checking the blocks from HEIGHT")
+	fmt.Println(" rpcserver [-port PORT] - Serves the chain and the wallets over JSON-RPC, with the credentials of RPC_USER and RPC_PASSWORD")
+	fmt.Println(" startnode [-port PORT] [-miner ADDRESS] [-peers HOST:PORT,...] - Starts a node, mining to ADDRESS if given")
+	fmt.Println(" mine -address ADDRESS [-blocks N] [-port PORT] [-peers HOST:PORT,...] - Runs a node mining the pending transactions to ADDRESS until interrupted, or until N blocks are mined")
+	fmt.Println(" migratedb -to BACKEND [-dir DIR] - Copies the chain to a database of BACKEND in DIR, the directory of the chain by default")
+	fmt.Println("Every command takes:")
+	fmt.Println(" [-datadir DIR] [-network mainnet|testnet|regtest|authority] [-config FILE] [-backend badger|bolt] - Selects the data directory, the network, the config file and the storage backend of the chain")
 }
 
 func (cli *CommandLine) validateArgs() {
@@ -34,18 +64,69 @@ func (cli *CommandLine) validateArgs() {
 	}
 }
 
+// continueBlockChain opens the blockchain of the node, exiting if it has none
+func (cli *CommandLine) continueBlockChain() *blockchain.BlockChain {
+	if !storage.Exists(cli.config.Backend, cli.config.BlocksDir()) {
+		fmt.Println("No existing blockchain found, create one!")
+		runtime.Goexit()
+	}
+	db, err := storage.Open(cli.config.Backend, cli.config.BlocksDir())
+	errors.HandleErr(err)
+
+	chain, err := blockchain.ContinueBlockChain(db)
+	if err != nil {
+		db.Close()
+	}
+	if errors.Is(err, errors.ErrChainNotFound) {
+		fmt.Println("No existing blockchain found, create one!")
+		runtime.Goexit()
+	}
+	errors.HandleErr(err)
+	chain.PoW = blockchain.PoWOptions{Workers: cli.config.Workers}
+
+	return chain
+}
+
+// consensus returns the consensus engine of the network. On a proof-of-authority
+// network it seals with the key of the signer of the config, read from wallets
+// or from the wallet file if wallets is nil
+func (cli *CommandLine) consensus(wallets *wallet.Wallets) blockchain.Consensus {
+	var signer *wallet.Wallet
+	if cli.config.Net.Consensus == config.ProofOfAuthority && cli.config.Signer != "" {
+		if wallets == nil {
+			wallets = cli.loadWallets()
+		}
+		w, err := wallets.GetWallet(cli.config.Signer)
+		errors.HandleErr(err)
+		signer = &w
+	}
+
+	engine, err := blockchain.NewConsensus(signer)
+	errors.HandleErr(err)
+
+	return engine
+}
+
 func (cli *CommandLine) printBlockChain() {
-	chain := blockchain.ContinueBlockChain("")
+	chain := cli.continueBlockChain()
 	defer chain.Database.Close()
 	iter := chain.Iterator()
 
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		errors.HandleErr(err)
+		fmt.Printf("Height       : %d\n", block.Height)
 		fmt.Printf("Hash         : %x\n", block.Hash)
+		fmt.Printf("Version      : %d\n", block.Version)
 		fmt.Printf("Previous Hash: %x\n", block.PrevHash)
+		fmt.Printf("Merkle Root  : %x\n", block.MerkleRoot)
+		fmt.Printf("Timestamp    : %s\n", time.Unix(block.Timestamp, 0).Format(time.RFC3339))
+		fmt.Printf("Bits         : %08x\n", block.Bits)
 
-		pow := blockchain.NewProof(block)
-		fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate()))
+		if block.Signer != nil {
+			fmt.Printf("Signer       : %x\n", block.Signer)
+		}
+		fmt.Printf("Seal: %s\n", strconv.FormatBool(chain.Consensus.VerifyHeader(chain, block) == nil))
 		for _, tx := range block.Transactions {
 			fmt.Println(tx)
 		}
@@ -57,24 +138,41 @@ func (cli *CommandLine) printBlockChain() {
 	}
 }
 
-func (cli *CommandLine) createBlockChain(address string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic(errors.NewInvalidAddressError(address))
+func (cli *CommandLine) createBlockChain(address string, txIndex bool) {
+	errors.HandleErr(wallet.CheckAddress(address))
+
+	if storage.Exists(cli.config.Backend, cli.config.BlocksDir()) {
+		fmt.Println("Blockchain already exists")
+		runtime.Goexit()
 	}
+	engine := cli.consensus(nil)
+
+	db, err := storage.Open(cli.config.Backend, cli.config.BlocksDir())
+	errors.HandleErr(err)
+	defer db.Close()
+
+	chain, err := blockchain.InitBlockChain(address, db, engine, blockchain.PoWOptions{Workers: cli.config.Workers})
+	errors.HandleErr(err)
 
-	chain := blockchain.InitBlockChain(address)
-	chain.Database.Close()
-	fmt.Printf("Genesis mined by address %s\n", address)
+	if txIndex {
+		_, err = chain.ReindexTransactions()
+		errors.HandleErr(err)
+	}
+	fmt.Printf("Genesis of the %s network mined by address %s\n", cli.config.Network, address)
 }
 
 func (cli *CommandLine) getBalance(address string) {
-	chain := blockchain.ContinueBlockChain(address)
+	lockingScript, err := wallet.AddressToScript(address)
+	errors.HandleErr(err)
+
+	chain := cli.continueBlockChain()
 	defer chain.Database.Close()
 
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
 	balance := 0
-	pubKeyHash := wallet.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-wallet.ChecksumLength]
-	UTXOs := chain.FindUTXO(pubKeyHash)
+	UTXOs, err := UTXOSet.FindUTXO(lockingScript)
+	errors.HandleErr(err)
 
 	for _, out := range UTXOs {
 		balance += out.Value
@@ -83,58 +181,296 @@ func (cli *CommandLine) getBalance(address string) {
 	fmt.Printf("Balance of %s is %d\n", address, balance)
 }
 
-func (cli *CommandLine) send(from, to string, amount int) {
+func (cli *CommandLine) send(from, to string, amount, fee, feeRate int, lockTime int64, mineNow bool, node string) {
+	errors.HandleErr(wallet.CheckAddress(to))
+	_, err := wallet.AddressToPubKeyHash(from)
+	errors.HandleErr(err)
+
+	chain := cli.continueBlockChain()
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	wallets := cli.loadWallets()
+	w, err := wallets.GetWallet(from)
+	errors.HandleErr(err)
+	chain.Consensus = cli.consensus(wallets)
+
+	var tx *blockchain.Transaction
+	if feeRate > 0 {
+		tx, err = blockchain.NewTransactionWithFeeRate(&w, to, amount, feeRate, lockTime, &UTXOSet)
+	} else {
+		tx, err = blockchain.NewTransaction(&w, to, amount, fee, lockTime, &UTXOSet)
+	}
+	errors.HandleErr(err)
+	fee, err = chain.TransactionFee(tx)
+	errors.HandleErr(err)
 
-	if !wallet.ValidateAddress(to) {
-		log.Panic(errors.NewInvalidAddressError(to))
+	if !mineNow {
+		if node == "" {
+			node = network.KnownNodes()[0]
+		}
+		err := network.SendTx(node, tx)
+		errors.HandleErr(err)
+		fmt.Printf("Transaction %x for amount %d and fee %d from %s to %s was queued by %s\n", tx.ID, amount, fee, from, to, node)
+		return
 	}
 
-	if !wallet.ValidateAddress(from) {
-		log.Panic(errors.NewInvalidAddressError(from))
+	if err := chain.CheckLocks(tx); errors.Is(err, errors.ErrLockedTransaction) {
+		fmt.Printf("Transaction %x cannot be mined before its lock time %d, queue it with -mine=false\n", tx.ID, lockTime)
+		runtime.Goexit()
 	}
+	// the sender mines the block, its coinbase pays the subsidy and the fee back to it
+	_, err = chain.MineTransactions(context.Background(), from, []*blockchain.Transaction{tx})
+	errors.HandleErr(err)
+	fmt.Printf("Transaction for amount %d and fee %d from %s to %s was successful!", amount, fee, from, to)
+}
 
-	chain := blockchain.ContinueBlockChain(from)
+func (cli *CommandLine) reindexUTXO() {
+	chain := cli.continueBlockChain()
 	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	errors.HandleErr(UTXOSet.Reindex())
 
-	tx := blockchain.NewTransaction(from, to, amount, chain)
-	chain.AddBlock([]*blockchain.Transaction{tx})
-	fmt.Printf("Transaction for amount %d from %s to %s was successful!", amount, from, to)
+	count, err := UTXOSet.CountTransactions()
+	errors.HandleErr(err)
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
 }
 
-func (cli *CommandLine) listAddresses() {
-	wallets, _ := wallet.CreateWallets()
+func (cli *CommandLine) reindex(txIndex bool) {
+	chain := cli.continueBlockChain()
+	defer chain.Database.Close()
+
+	if !txIndex {
+		errors.HandleErr(chain.DropTxIndex())
+		fmt.Println("Done! The transaction index is dropped.")
+		return
+	}
+
+	count, err := chain.ReindexTransactions()
+	errors.HandleErr(err)
+	fmt.Printf("Done! There are %d transactions in the transaction index.\n", count)
+}
+
+func (cli *CommandLine) printSupply() {
+	chain := cli.continueBlockChain()
+	defer chain.Database.Close()
+
+	supply, err := chain.Supply()
+	errors.HandleErr(err)
+
+	fmt.Printf("Height       : %d\n", supply.Height)
+	fmt.Printf("Issued       : %d\n", supply.Issued)
+	fmt.Printf("Scheduled    : %d\n", supply.Scheduled)
+	fmt.Printf("Max supply   : %d\n", supply.MaxSupply)
+	fmt.Printf("Next subsidy : %d\n", supply.NextSubsidy)
+	fmt.Printf("Next halving : at height %d\n", supply.NextHalving)
+}
+
+func (cli *CommandLine) listAddresses(pubKeys bool) {
+	wallets := cli.loadWallets()
 	addresses := wallets.GetAllAddresses()
 
 	for _, address := range addresses {
-		fmt.Println(address)
+		if !pubKeys {
+			fmt.Println(address)
+			continue
+		}
+		w, err := wallets.GetWallet(address)
+		errors.HandleErr(err)
+		fmt.Printf("%s %x\n", address, w.PublicKey)
+	}
+
+	for _, address := range wallets.GetMultiSigAddresses() {
+		redeemScript, err := wallets.GetMultiSig(address)
+		errors.HandleErr(err)
+		fmt.Printf("%s (%s multisig)\n", address, wallet.DescribeMultiSig(redeemScript))
 	}
 }
 
 func (cli *CommandLine) createWallet() {
-	wallets, _ := wallet.CreateWallets()
-	address := wallets.AddWallet()
-	wallets.SaveFile()
+	wallets := cli.loadWallets()
+	if !wallet.WalletFileExists(cli.config.WalletFile()) {
+		// an empty passphrase keeps the new wallet file unencrypted
+		wallets.SetPassphrase(readNewPassphrase(passphraseEnv, "New wallet passphrase (empty for none): "))
+	}
+
+	if !wallets.IsHD() {
+		mnemonic, err := wallet.NewMnemonic()
+		errors.HandleErr(err)
+		errors.HandleErr(wallets.SetMnemonic(mnemonic))
+
+		fmt.Printf("Recovery phrase: %s\n", mnemonic)
+		fmt.Println("Write it down, restorewallet recovers every address created from now on with it")
+	}
+
+	address, err := wallets.AddWallet()
+	errors.HandleErr(err)
+	errors.HandleErr(wallets.SaveFile(cli.config.WalletFile()))
 
 	fmt.Printf("New address is: %s\n", address)
 }
 
-// Run runs the cli
+func (cli *CommandLine) restoreWallet(mnemonic string) {
+	if wallet.WalletFileExists(cli.config.WalletFile()) {
+		fmt.Println("A wallet file already exists, move it away to restore a wallet")
+		runtime.Goexit()
+	}
+
+	used := make(map[string]bool)
+	if storage.Exists(cli.config.Backend, cli.config.BlocksDir()) {
+		chain := cli.continueBlockChain()
+		var err error
+		used, err = chain.FindUsedPubKeyHashes()
+		chain.Database.Close()
+		errors.HandleErr(err)
+	}
+
+	wallets := cli.loadWallets()
+	addresses, err := wallets.Restore(mnemonic, func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	})
+	errors.HandleErr(err)
+
+	wallets.SetPassphrase(readNewPassphrase(passphraseEnv, "New wallet passphrase (empty for none): "))
+	errors.HandleErr(wallets.SaveFile(cli.config.WalletFile()))
+
+	fmt.Printf("Restored %d addresses:\n", len(addresses))
+	for _, address := range addresses {
+		fmt.Println(address)
+	}
+}
+
+func (cli *CommandLine) startRPCServer() {
+	if cli.config.RPCUser == "" || cli.config.RPCPassword == "" {
+		fmt.Printf("Set the credentials of the server with %s and %s, or rpcuser and rpcpassword in the config file\n", config.RPCUserEnv, config.RPCPasswordEnv)
+		runtime.Goexit()
+	}
+
+	wallets := cli.loadWallets()
+	errors.HandleErr(rpc.StartServer(cli.config, wallets, cli.consensus(wallets)))
+}
+
+func (cli *CommandLine) verifyChain(from int) {
+	chain := cli.continueBlockChain()
+	defer chain.Database.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := chain.Verify(ctx, from); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	bestHeight, err := chain.GetBestHeight()
+	errors.HandleErr(err)
+	fmt.Printf("The chain is valid up to height %d\n", bestHeight)
+}
+
+func (cli *CommandLine) startNode(minerAddress string) {
+	if minerAddress != "" {
+		errors.HandleErr(wallet.CheckAddress(minerAddress))
+	}
+
+	errors.HandleErr(network.StartServer(cli.config, minerAddress, cli.consensus(nil)))
+}
+
+// Run runs the cli.
+// The NODE_ID environment variable selects the database and wallet file to use,
+// so that several nodes can be run from the same data directory
 func (cli *CommandLine) Run() {
 	cli.validateArgs()
 
+	// the settings of the config given on the command line
+	var flags config.Config
+
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
-	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send the subsidy of the genesis block to")
+	createBlockchainTxIndex := createBlockchainCmd.Bool("txindex", false, "Index the transactions of the chain by ID")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee left to the miner")
+	sendFeeRate := sendCmd.Int("feerate", 0, fmt.Sprintf("Fee rate per %d bytes of the transaction, instead of -fee", blockchain.FeeRateUnit))
+	sendMine := sendCmd.Bool("mine", true, "Mine a block with the transaction right away instead of queuing it in the mempool of a node")
+	sendNode := sendCmd.String("node", "", "The node queuing the transaction when -mine=false (default the node on the port of the network)")
+	sendLockTime := sendCmd.Int64("locktime", 0, fmt.Sprintf("Height, or unix time from %d, before which the transaction cannot be mined", blockchain.LockTimeThreshold))
 
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	reindexCmd := flag.NewFlagSet("reindex", flag.ExitOnError)
+	supplyCmd := flag.NewFlagSet("supply", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	rpcServerCmd := flag.NewFlagSet("rpcserver", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	migrateDBCmd := flag.NewFlagSet("migratedb", flag.ExitOnError)
+
+	createMultiSigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtx", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtx", flag.ExitOnError)
+	combineRawTxCmd := flag.NewFlagSet("combinerawtx", flag.ExitOnError)
+	broadcastRawTxCmd := flag.NewFlagSet("broadcastrawtx", flag.ExitOnError)
+
+	listAddressesPubKeys := listAddressesCmd.Bool("pubkeys", false, "Print the public key of every address")
+	createMultiSigRequired := createMultiSigCmd.Int("required", 0, "The number of signatures required to spend")
+	createMultiSigPubKeys := createMultiSigCmd.String("pubkeys", "", "Comma separated public keys in hex, as printed by listaddresses -pubkeys")
+	createRawTxFrom := createRawTxCmd.String("from", "", "Source address, a wallet address or a multisig address of the wallet file")
+	createRawTxTo := createRawTxCmd.String("to", "", "Destination wallet address")
+	createRawTxAmount := createRawTxCmd.Int("amount", 0, "Amount to send")
+	createRawTxFee := createRawTxCmd.Int("fee", 0, "Fee left to the miner")
+	createRawTxLockTime := createRawTxCmd.Int64("locktime", 0, fmt.Sprintf("Height, or unix time from %d, before which the transaction cannot be mined", blockchain.LockTimeThreshold))
+	createRawTxOut := createRawTxCmd.String("out", "", "The file to write the transaction to")
+	signRawTxIn := signRawTxCmd.String("in", "", "The file of the transaction to sign")
+	signRawTxOut := signRawTxCmd.String("out", "", "The file to write the signed transaction to (default the -in file)")
+	combineRawTxIn := combineRawTxCmd.String("in", "", "Comma separated files of the copies of the transaction")
+	combineRawTxOut := combineRawTxCmd.String("out", "", "The file to write the combined transaction to")
+	broadcastRawTxIn := broadcastRawTxCmd.String("in", "", "The file of the signed transaction")
+	broadcastRawTxMine := broadcastRawTxCmd.Bool("mine", true, "Mine a block with the transaction right away instead of queuing it in the mempool of a node")
+	broadcastRawTxMiner := broadcastRawTxCmd.String("miner", "", "The address the coinbase of the block pays the subsidy and the fee to, unless -mine=false")
+	broadcastRawTxNode := broadcastRawTxCmd.String("node", "", "The node queuing the transaction when -mine=false (default the node on the port of the network)")
+
+	verifyChainFrom := verifyChainCmd.Int("from", 0, "The height of the first block to fully verify")
+	restoreMnemonic := restoreWalletCmd.String("mnemonic", "", "The recovery phrase of the wallet")
+	reindexTxIndex := reindexCmd.Bool("txindex", true, "Rebuild the transaction index, or drop it when false")
+
+	rpcServerCmd.StringVar(&flags.RPCPort, "port", "", "The port to serve JSON-RPC on (default the RPC port of the network)")
+
+	startNodeCmd.StringVar(&flags.Port, "port", "", "The port to listen on (default the port of the network)")
+	startNodeMiner := startNodeCmd.String("miner", "", "Enables mining and sends the rewards to this address")
+	startNodePeers := startNodeCmd.String("peers", "", "Comma separated addresses of the nodes to connect to")
+
+	mineCmd.StringVar(&flags.Port, "port", "", "The port to listen on (default the port of the network)")
+	mineAddress := mineCmd.String("address", "", "The address to send the rewards of the blocks to")
+	mineBlocks := mineCmd.Int("blocks", 0, "The number of blocks to mine (default until interrupted)")
+	minePeers := mineCmd.String("peers", "", "Comma separated addresses of the nodes to connect to")
+
+	migrateDBTo := migrateDBCmd.String("to", "", "The backend to copy the chain to, one of "+strings.Join(storage.Backends, ", "))
+	migrateDBDir := migrateDBCmd.String("dir", "", "The directory of the copy (default the directory of the chain)")
+
+	for _, cmd := range []*flag.FlagSet{
+		getBalanceCmd, createBlockchainCmd, sendCmd, printChainCmd, createWalletCmd, listAddressesCmd,
+		restoreWalletCmd, encryptWalletCmd, changePassphraseCmd, reindexUTXOCmd, reindexCmd, supplyCmd,
+		startNodeCmd, verifyChainCmd, rpcServerCmd, createMultiSigCmd, createRawTxCmd, signRawTxCmd,
+		combineRawTxCmd, broadcastRawTxCmd, mineCmd, migrateDBCmd,
+	} {
+		cmd.StringVar(&flags.DataDir, "datadir", "", "The directory holding the chains and the wallet files (default "+config.DefaultDataDir+")")
+		cmd.StringVar(&flags.Network, "network", "", "The network to run, one of "+strings.Join(config.NetworkNames(), ", ")+" (default "+config.Mainnet.Name+")")
+		cmd.StringVar(&flags.File, "config", "", "The config file (default DATADIR/"+config.FileName+")")
+		cmd.StringVar(&flags.Backend, "backend", "", "The storage backend of the chain, one of "+strings.Join(storage.Backends, ", ")+" (default "+storage.Badger+")")
+	}
+	for _, cmd := range []*flag.FlagSet{createBlockchainCmd, sendCmd, startNodeCmd, rpcServerCmd, broadcastRawTxCmd, mineCmd} {
+		cmd.IntVar(&flags.Workers, "workers", 0, "The number of goroutines mining a block (default the number of CPUs)")
+	}
 
 	switch os.Args[1] {
 	case "getbalance":
@@ -167,11 +503,102 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "changepassphrase":
+		err := changePassphraseCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reindex":
+		err := reindexCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "supply":
+		err := supplyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifychain":
+		err := verifyChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "rpcserver":
+		err := rpcServerCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "startnode":
+		err := startNodeCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "mine":
+		err := mineCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "migratedb":
+		err := migrateDBCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisig":
+		err := createMultiSigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createrawtx":
+		err := createRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signrawtx":
+		err := signRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "combinerawtx":
+		err := combineRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "broadcastrawtx":
+		err := broadcastRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		runtime.Goexit()
 	}
 
+	if *startNodePeers != "" {
+		flags.Peers = strings.Split(*startNodePeers, ",")
+	}
+	if *minePeers != "" {
+		flags.Peers = strings.Split(*minePeers, ",")
+	}
+
+	cfg, err := config.Load(flags)
+	errors.HandleErr(err)
+	cli.config = cfg
+
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
@@ -185,7 +612,7 @@ func (cli *CommandLine) Run() {
 			createBlockchainCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.createBlockChain(*createBlockchainAddress)
+		cli.createBlockChain(*createBlockchainAddress, *createBlockchainTxIndex)
 	}
 
 	if printChainCmd.Parsed() {
@@ -193,12 +620,12 @@ func (cli *CommandLine) Run() {
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 || *sendFeeRate < 0 || (*sendFee > 0 && *sendFeeRate > 0) || *sendLockTime < 0 {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, *sendFeeRate, *sendLockTime, *sendMine, *sendNode)
 	}
 
 	if createWalletCmd.Parsed() {
@@ -206,6 +633,105 @@ func (cli *CommandLine) Run() {
 	}
 
 	if listAddressesCmd.Parsed() {
-		cli.listAddresses()
+		cli.listAddresses(*listAddressesPubKeys)
+	}
+
+	if createMultiSigCmd.Parsed() {
+		if *createMultiSigRequired <= 0 || *createMultiSigPubKeys == "" {
+			createMultiSigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createMultiSig(*createMultiSigRequired, *createMultiSigPubKeys)
+	}
+
+	if createRawTxCmd.Parsed() {
+		if *createRawTxFrom == "" || *createRawTxTo == "" || *createRawTxAmount <= 0 || *createRawTxFee < 0 || *createRawTxLockTime < 0 || *createRawTxOut == "" {
+			createRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createRawTx(*createRawTxFrom, *createRawTxTo, *createRawTxAmount, *createRawTxFee, *createRawTxLockTime, *createRawTxOut)
+	}
+
+	if signRawTxCmd.Parsed() {
+		if *signRawTxIn == "" {
+			signRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signRawTx(*signRawTxIn, *signRawTxOut)
+	}
+
+	if combineRawTxCmd.Parsed() {
+		if *combineRawTxIn == "" || *combineRawTxOut == "" {
+			combineRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.combineRawTx(*combineRawTxIn, *combineRawTxOut)
+	}
+
+	if broadcastRawTxCmd.Parsed() {
+		if *broadcastRawTxIn == "" || (*broadcastRawTxMine && *broadcastRawTxMiner == "") {
+			broadcastRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.broadcastRawTx(*broadcastRawTxIn, *broadcastRawTxMine, *broadcastRawTxMiner, *broadcastRawTxNode)
+	}
+
+	if restoreWalletCmd.Parsed() {
+		if *restoreMnemonic == "" {
+			restoreWalletCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.restoreWallet(*restoreMnemonic)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet()
+	}
+
+	if changePassphraseCmd.Parsed() {
+		cli.changePassphrase()
+	}
+
+	if reindexUTXOCmd.Parsed() {
+		cli.reindexUTXO()
+	}
+
+	if reindexCmd.Parsed() {
+		cli.reindex(*reindexTxIndex)
+	}
+
+	if supplyCmd.Parsed() {
+		cli.printSupply()
+	}
+
+	if verifyChainCmd.Parsed() {
+		if *verifyChainFrom < 0 {
+			verifyChainCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyChain(*verifyChainFrom)
+	}
+
+	if rpcServerCmd.Parsed() {
+		cli.startRPCServer()
+	}
+
+	if startNodeCmd.Parsed() {
+		cli.startNode(*startNodeMiner)
+	}
+
+	if mineCmd.Parsed() {
+		if *mineAddress == "" || *mineBlocks < 0 {
+			mineCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.mine(*mineAddress, *mineBlocks)
+	}
+	if migrateDBCmd.Parsed() {
+		if *migrateDBTo == "" {
+			migrateDBCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.migrateDB(*migrateDBTo, *migrateDBDir)
 	}
 }
@@ -0,0 +1,38 @@
+package commandline
+
+import (
+	"fmt"
+	"go-blockchain/blockchain"
+	"go-blockchain/errors"
+	"go-blockchain/storage"
+	"runtime"
+)
+
+func (cli *CommandLine) migrateDB(backend, dir string) {
+	if dir == "" {
+		dir = cli.config.BlocksDir()
+	}
+	if storage.Exists(backend, dir) {
+		fmt.Printf("There already is a %s database in %s\n", backend, dir)
+		runtime.Goexit()
+	}
+
+	chain := cli.continueBlockChain()
+	defer chain.Database.Close()
+
+	db, err := storage.Open(backend, dir)
+	errors.HandleErr(err)
+	defer db.Close()
+
+	keys, err := storage.Copy(db, chain.Database)
+	errors.HandleErr(err)
+
+	// the copy has to hold the whole chain
+	copied, err := blockchain.ContinueBlockChain(db)
+	errors.HandleErr(err)
+	height, err := copied.GetBestHeight()
+	errors.HandleErr(err)
+
+	fmt.Printf("Copied %d keys of the chain at height %d from %s to %s in %s\n", keys, height, cli.config.Backend, backend, dir)
+	fmt.Printf("Run the commands with -backend %s to use the copy\n", backend)
+}
@@ -0,0 +1,43 @@
+package commandline
+
+import (
+	"context"
+	"fmt"
+	"go-blockchain/errors"
+	"go-blockchain/network"
+	"go-blockchain/wallet"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+)
+
+// formatHashRate prints a number of hashes per second with the largest unit under 1000 of it
+func formatHashRate(hashesPerSecond float64) string {
+	units := []string{"H/s", "kH/s", "MH/s", "GH/s", "TH/s"}
+
+	unit := 0
+	for hashesPerSecond >= 1000 && unit < len(units)-1 {
+		hashesPerSecond /= 1000
+		unit++
+	}
+
+	return fmt.Sprintf("%.2f %s", hashesPerSecond, units[unit])
+}
+
+// mine runs a node mining blocks with the transactions it receives, see network.Server.Mine
+func (cli *CommandLine) mine(address string, blocks int) {
+	errors.HandleErr(wallet.CheckAddress(address))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Mining to %s the transactions received on port %s\n", address, cli.config.Port)
+	stats, err := network.StartMiner(ctx, cli.config, address, blocks, cli.consensus(nil))
+	if errors.Is(err, errors.ErrChainNotFound) {
+		fmt.Println("No existing blockchain found, create one!")
+		runtime.Goexit()
+	}
+	fmt.Printf("Mined %d blocks in %s at %s\n", stats.Blocks, stats.Elapsed.Round(time.Millisecond), formatHashRate(stats.HashRate()))
+	errors.HandleErr(err)
+}
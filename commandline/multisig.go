@@ -0,0 +1,29 @@
+package commandline
+
+import (
+	"encoding/hex"
+	"fmt"
+	"go-blockchain/errors"
+	"go-blockchain/wallet"
+	"strings"
+)
+
+func (cli *CommandLine) createMultiSig(required int, pubKeys string) {
+	var keys [][]byte
+	for _, pubKey := range strings.Split(pubKeys, ",") {
+		key, err := hex.DecodeString(strings.TrimSpace(pubKey))
+		errors.HandleErr(err)
+		keys = append(keys, key)
+	}
+
+	wallets := cli.loadWallets()
+	if !wallet.WalletFileExists(cli.config.WalletFile()) {
+		wallets.SetPassphrase(readNewPassphrase(passphraseEnv, "New wallet passphrase (empty for none): "))
+	}
+
+	address, err := wallets.AddMultiSig(required, keys)
+	errors.HandleErr(err)
+	errors.HandleErr(wallets.SaveFile(cli.config.WalletFile()))
+
+	fmt.Printf("New multisig address is: %s\n", address)
+}
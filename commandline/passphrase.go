@@ -0,0 +1,125 @@
+package commandline
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go-blockchain/errors"
+	"go-blockchain/wallet"
+	"log"
+	"os"
+	"runtime"
+
+	"golang.org/x/term"
+)
+
+const (
+	// passphraseEnv holds the passphrase of the wallet file, to avoid the prompt
+	passphraseEnv = "WALLET_PASSPHRASE"
+	// newPassphraseEnv holds the new passphrase for changepassphrase
+	newPassphraseEnv = "WALLET_NEW_PASSPHRASE"
+)
+
+// stdin reads the passphrases piped in. Every prompt reads from the same reader,
+// so that the lines it buffered ahead are not lost
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase reads a passphrase from the environment variable env,
+// or prompts for it without echoing it if the variable is not set
+func readPassphrase(env, prompt string) []byte {
+	if passphrase, ok := os.LookupEnv(env); ok {
+		return []byte(passphrase)
+	}
+
+	fmt.Print(prompt)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		// the passphrase is piped in
+		line, err := stdin.ReadBytes('\n')
+		fmt.Println()
+		if err != nil && len(line) == 0 {
+			return nil
+		}
+		return bytes.TrimRight(line, "\r\n")
+	}
+
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Println()
+	errors.HandleErr(err)
+
+	return passphrase
+}
+
+// readNewPassphrase reads a new passphrase from env, or prompts for it twice
+func readNewPassphrase(env, prompt string) []byte {
+	if passphrase, ok := os.LookupEnv(env); ok {
+		return []byte(passphrase)
+	}
+
+	passphrase := readPassphrase(env, prompt)
+	confirmation := readPassphrase(env, "Repeat the passphrase: ")
+	if !bytes.Equal(passphrase, confirmation) {
+		fmt.Println("The passphrases do not match")
+		runtime.Goexit()
+	}
+
+	return passphrase
+}
+
+// loadWallets loads the wallet file of the node, asking for its passphrase if it is encrypted
+func (cli *CommandLine) loadWallets() *wallet.Wallets {
+	var passphrase []byte
+	if wallet.IsEncrypted(cli.config.WalletFile()) {
+		passphrase = readPassphrase(passphraseEnv, "Wallet passphrase: ")
+	}
+
+	wallets, err := wallet.CreateWallets(cli.config.WalletFile(), passphrase)
+	if err != nil && !os.IsNotExist(err) {
+		log.Panic(err)
+	}
+
+	return wallets
+}
+
+func (cli *CommandLine) encryptWallet() {
+	if wallet.IsEncrypted(cli.config.WalletFile()) {
+		fmt.Println("The wallet file is already encrypted, use changepassphrase to change its passphrase")
+		runtime.Goexit()
+	}
+	if !wallet.WalletFileExists(cli.config.WalletFile()) {
+		fmt.Println("No wallet file found, create a wallet first!")
+		runtime.Goexit()
+	}
+
+	wallets := cli.loadWallets()
+	passphrase := readNewPassphrase(passphraseEnv, "New wallet passphrase: ")
+	if len(passphrase) == 0 {
+		fmt.Println("The passphrase cannot be empty")
+		runtime.Goexit()
+	}
+
+	wallets.SetPassphrase(passphrase)
+	errors.HandleErr(wallets.SaveFile(cli.config.WalletFile()))
+
+	fmt.Println("The wallet file is now encrypted")
+}
+
+func (cli *CommandLine) changePassphrase() {
+	if !wallet.IsEncrypted(cli.config.WalletFile()) {
+		fmt.Println("The wallet file is not encrypted, use encryptwallet to encrypt it")
+		runtime.Goexit()
+	}
+
+	wallets := cli.loadWallets()
+	passphrase := readNewPassphrase(newPassphraseEnv, "New wallet passphrase: ")
+	if len(passphrase) == 0 {
+		fmt.Println("The passphrase cannot be empty")
+		runtime.Goexit()
+	}
+
+	wallets.SetPassphrase(passphrase)
+	errors.HandleErr(wallets.SaveFile(cli.config.WalletFile()))
+
+	fmt.Println("The passphrase was changed")
+}
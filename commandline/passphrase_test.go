@@ -0,0 +1,48 @@
+package commandline
+
+import (
+	"bufio"
+	"os"
+	"testing"
+)
+
+// pipeStdin makes the prompts read input from a pipe until the test ends
+func pipeStdin(t *testing.T, input string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stdinFile, reader := os.Stdin, stdin
+	os.Stdin, stdin = r, bufio.NewReader(r)
+	t.Cleanup(func() {
+		os.Stdin, stdin = stdinFile, reader
+		r.Close()
+	})
+}
+
+func TestPipedPassphrasesReadOneLineEach(t *testing.T) {
+	const env = "TEST_UNSET_PASSPHRASE"
+	os.Unsetenv(env)
+
+	pipeStdin(t, "old passphrase\nnew passphrase\nnew passphrase\n")
+
+	if got := string(readPassphrase(env, "")); got != "old passphrase" {
+		t.Fatalf("read the passphrase %q, expected \"old passphrase\"", got)
+	}
+	// the confirmation is the line after the new passphrase
+	if got := string(readNewPassphrase(env, "")); got != "new passphrase" {
+		t.Fatalf("read the new passphrase %q, expected \"new passphrase\"", got)
+	}
+	if got := readPassphrase(env, ""); got != nil {
+		t.Fatalf("read %q after the last line", got)
+	}
+}
@@ -0,0 +1,171 @@
+package commandline
+
+import (
+	"context"
+	"fmt"
+	"go-blockchain/blockchain"
+	"go-blockchain/errors"
+	"go-blockchain/network"
+	"go-blockchain/script"
+	"go-blockchain/wallet"
+	"io/ioutil"
+	"runtime"
+	"strings"
+)
+
+// Raw transactions are passed around in partial transaction files, see blockchain.PartialTransaction
+
+func readPartialTransaction(path string) *blockchain.PartialTransaction {
+	content, err := ioutil.ReadFile(path)
+	errors.HandleErr(err)
+
+	partial, err := blockchain.DecodePartialTransaction(content)
+	errors.HandleErr(err)
+
+	return partial
+}
+
+func writePartialTransaction(path string, partial *blockchain.PartialTransaction) {
+	content, err := partial.Encode()
+	errors.HandleErr(err)
+
+	errors.HandleErr(ioutil.WriteFile(path, append(content, '\n'), 0600))
+}
+
+// printSignatures prints how many signatures every input of the transaction has
+func printSignatures(partial *blockchain.PartialTransaction) {
+	for i, status := range partial.Status() {
+		fmt.Printf("Input %d has %d of the %d signatures it needs\n", i, status.Signatures, status.Required)
+	}
+}
+
+// scriptAddress returns the address of a locking script, or the script itself if
+// it has no address
+func scriptAddress(lockingScript script.Script) string {
+	if address, ok := wallet.ScriptToAddress(lockingScript); ok {
+		return address
+	}
+
+	return lockingScript.String()
+}
+
+func (cli *CommandLine) createRawTx(from, to string, amount, fee int, lockTime int64, out string) {
+	errors.HandleErr(wallet.CheckAddress(to))
+	errors.HandleErr(wallet.CheckAddress(from))
+
+	chain := cli.continueBlockChain()
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	var tx *blockchain.Transaction
+	var err error
+	if _, keyErr := wallet.AddressToPubKeyHash(from); keyErr == nil {
+		tx, err = blockchain.NewUnsignedTransaction(from, to, amount, fee, lockTime, &UTXOSet)
+	} else {
+		// only the wallet file knows the redeem script of a multisig address
+		var redeemScript []byte
+		redeemScript, err = cli.loadWallets().GetMultiSig(from)
+		errors.HandleErr(err)
+		tx, err = blockchain.NewMultiSigTransaction(redeemScript, to, amount, fee, lockTime, &UTXOSet)
+	}
+	errors.HandleErr(err)
+
+	partial, err := chain.NewPartialTransaction(tx)
+	errors.HandleErr(err)
+	writePartialTransaction(out, partial)
+
+	fmt.Printf("Transaction %x for amount %d and fee %d from %s to %s was written to %s\n", tx.ID, amount, fee, from, to, out)
+	printSignatures(partial)
+}
+
+func (cli *CommandLine) signRawTx(in, out string) {
+	partial := readPartialTransaction(in)
+
+	// the signer checks what it signs, the chain is not needed: the spent outputs
+	// come from the spent transactions, whose IDs were checked against the inputs
+	fmt.Printf("Transaction %x spends:\n", partial.Tx.ID)
+	for i := range partial.Tx.Inputs {
+		spent := partial.Spent(i)
+		fmt.Printf("\t%d from %s\n", spent.Value, scriptAddress(spent.ScriptPubKey))
+	}
+	fmt.Println("and pays:")
+	for _, output := range partial.Tx.Outputs {
+		fmt.Printf("\t%d to %s\n", output.Value, scriptAddress(output.ScriptPubKey))
+	}
+	fee, err := partial.Fee()
+	errors.HandleErr(err)
+	fmt.Printf("\t%d of fee\n", fee)
+	if partial.Tx.LockTime != 0 {
+		fmt.Printf("It cannot be mined before its lock time %d\n", partial.Tx.LockTime)
+	}
+
+	wallets := cli.loadWallets()
+	signed := 0
+	for _, address := range wallets.GetAllAddresses() {
+		w, err := wallets.GetWallet(address)
+		errors.HandleErr(err)
+
+		count, err := partial.Sign(w.PrivateKey)
+		errors.HandleErr(err)
+		signed += count
+	}
+
+	if out == "" {
+		out = in
+	}
+	writePartialTransaction(out, partial)
+
+	fmt.Printf("Added %d signatures to transaction %x in %s\n", signed, partial.Tx.ID, out)
+	printSignatures(partial)
+}
+
+func (cli *CommandLine) combineRawTx(in, out string) {
+	files := strings.Split(in, ",")
+
+	partial := readPartialTransaction(files[0])
+	for _, file := range files[1:] {
+		errors.HandleErr(partial.Combine(readPartialTransaction(file)))
+	}
+	writePartialTransaction(out, partial)
+
+	fmt.Printf("Combined %d copies of transaction %x in %s\n", len(files), partial.Tx.ID, out)
+	printSignatures(partial)
+}
+
+func (cli *CommandLine) broadcastRawTx(in string, mineNow bool, minerAddress, node string) {
+	if mineNow {
+		errors.HandleErr(wallet.CheckAddress(minerAddress))
+	}
+
+	partial := readPartialTransaction(in)
+	if err := partial.Finalize(); err != nil {
+		fmt.Println(err)
+		runtime.Goexit()
+	}
+	tx := partial.Tx
+
+	chain := cli.continueBlockChain()
+	defer chain.Database.Close()
+	chain.Consensus = cli.consensus(nil)
+
+	errors.HandleErr(chain.VerifyTransaction(tx))
+	fee, err := chain.TransactionFee(tx)
+	errors.HandleErr(err)
+
+	if !mineNow {
+		if node == "" {
+			node = network.KnownNodes()[0]
+		}
+		errors.HandleErr(network.SendTx(node, tx))
+		fmt.Printf("Transaction %x with fee %d was queued by %s\n", tx.ID, fee, node)
+		return
+	}
+
+	if err := chain.CheckLocks(tx); errors.Is(err, errors.ErrLockedTransaction) {
+		fmt.Printf("Transaction %x cannot be mined before its lock time %d, queue it with -mine=false\n", tx.ID, tx.LockTime)
+		runtime.Goexit()
+	}
+	_, err = chain.MineTransactions(context.Background(), minerAddress, []*blockchain.Transaction{tx})
+	errors.HandleErr(err)
+	fmt.Printf("Transaction %x with fee %d was successful!\n", tx.ID, fee)
+}
@@ -0,0 +1,186 @@
+// Package config holds the settings of a node and the parameters of the networks it can run
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-blockchain/errors"
+	"go-blockchain/storage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultDataDir is the data directory used when none is given
+	DefaultDataDir = "./tmp"
+	// FileName is the name of the config file in the data directory
+	FileName = "config.json"
+
+	// the environment variables of the settings
+	DataDirEnv     = "CHAIN_DATADIR"
+	ConfigFileEnv  = "CHAIN_CONFIG"
+	NetworkEnv     = "CHAIN_NETWORK"
+	NodeIDEnv      = "NODE_ID"
+	RPCUserEnv     = "RPC_USER"
+	RPCPasswordEnv = "RPC_PASSWORD"
+	WorkersEnv     = "CHAIN_WORKERS"
+	SignersEnv     = "CHAIN_SIGNERS"
+	SignerEnv      = "CHAIN_SIGNER"
+	BackendEnv     = "CHAIN_BACKEND"
+)
+
+// Config holds the settings of a node. They come, by order of precedence, from
+// the command line flags, the environment variables, the config file and the defaults
+type Config struct {
+	// DataDir is the directory holding the chains and the wallet files
+	DataDir string `json:"-"`
+	// File is the config file, DataDir/config.json by default
+	File string `json:"-"`
+	// NodeID tells apart the files of the nodes sharing the data directory
+	NodeID string `json:"nodeid,omitempty"`
+
+	Network     string   `json:"network,omitempty"`
+	Port        string   `json:"port,omitempty"`
+	RPCPort     string   `json:"rpcport,omitempty"`
+	RPCUser     string   `json:"rpcuser,omitempty"`
+	RPCPassword string   `json:"rpcpassword,omitempty"`
+	Peers       []string `json:"peers,omitempty"`
+	// Workers is the number of goroutines mining a block, the number of CPUs if 0
+	Workers int `json:"workers,omitempty"`
+	// Signers replaces the signers of a proof-of-authority network, public keys in hex
+	Signers []string `json:"signers,omitempty"`
+	// Signer is the address of the wallet file sealing the blocks of a proof-of-authority network
+	Signer string `json:"signer,omitempty"`
+	// Backend is the storage backend of the chain, one of storage.Backends
+	Backend string `json:"backend,omitempty"`
+
+	// Net is the network selected by Network
+	Net *Network `json:"-"`
+}
+
+// Load builds the config of the node from the settings given by flags
+// (empty settings are unset) and selects its network
+func Load(flags Config) (*Config, error) {
+	cfg := &Config{}
+	cfg.DataDir = firstSet(flags.DataDir, os.Getenv(DataDirEnv), DefaultDataDir)
+	cfg.File = firstSet(flags.File, os.Getenv(ConfigFileEnv), filepath.Join(cfg.DataDir, FileName))
+
+	file, err := readFile(cfg.File)
+	// only the default config file is optional
+	if err != nil && !(os.IsNotExist(err) && flags.File == "" && os.Getenv(ConfigFileEnv) == "") {
+		return nil, err
+	}
+
+	cfg.NodeID = firstSet(flags.NodeID, os.Getenv(NodeIDEnv), file.NodeID)
+	cfg.Network = firstSet(flags.Network, os.Getenv(NetworkEnv), file.Network, Mainnet.Name)
+	cfg.RPCUser = firstSet(flags.RPCUser, os.Getenv(RPCUserEnv), file.RPCUser)
+	cfg.RPCPassword = firstSet(flags.RPCPassword, os.Getenv(RPCPasswordEnv), file.RPCPassword)
+
+	if err := SelectNetwork(cfg.Network); err != nil {
+		return nil, err
+	}
+	cfg.Net = Params()
+
+	cfg.Port = firstSet(flags.Port, file.Port, cfg.Net.Port)
+	cfg.RPCPort = firstSet(flags.RPCPort, file.RPCPort, cfg.Net.RPCPort)
+
+	cfg.Peers = flags.Peers
+	if len(cfg.Peers) == 0 {
+		cfg.Peers = file.Peers
+	}
+
+	cfg.Signer = firstSet(flags.Signer, os.Getenv(SignerEnv), file.Signer)
+	cfg.Signers = file.Signers
+	if signers := os.Getenv(SignersEnv); signers != "" {
+		cfg.Signers = strings.Split(signers, ",")
+	}
+	if len(cfg.Signers) > 0 {
+		// the network the process runs gets the signers of the node
+		network := *cfg.Net
+		network.Signers = cfg.Signers
+		active, cfg.Net = &network, &network
+	}
+
+	cfg.Backend = firstSet(flags.Backend, os.Getenv(BackendEnv), file.Backend, storage.Badger)
+	if !isBackend(cfg.Backend) {
+		return nil, storage.UnknownBackendError(cfg.Backend)
+	}
+
+	workers := firstSet(intSetting(flags.Workers), os.Getenv(WorkersEnv), intSetting(file.Workers), "0")
+	if cfg.Workers, err = strconv.Atoi(workers); err != nil {
+		return nil, fmt.Errorf("%s: %w", WorkersEnv, err)
+	}
+	if cfg.Workers < 0 {
+		return nil, errors.NewInvalidAmountError("number of workers", cfg.Workers)
+	}
+
+	return cfg, nil
+}
+
+// readFile reads the config file. A missing file reads as an empty config
+func readFile(path string) (Config, error) {
+	var file Config
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+
+	return file, json.Unmarshal(content, &file)
+}
+
+// NetworkDir returns the directory holding the files of the network
+func (c *Config) NetworkDir() string {
+	return filepath.Join(c.DataDir, c.Net.DataSubdir)
+}
+
+// BlocksDir returns the directory of the database of the chain of the node
+func (c *Config) BlocksDir() string {
+	return filepath.Join(c.NetworkDir(), "blocks"+c.suffix())
+}
+
+// WalletFile returns the wallet file of the node
+func (c *Config) WalletFile() string {
+	return filepath.Join(c.NetworkDir(), "wallets"+c.suffix()+".data")
+}
+
+// suffix tells apart the files of the nodes sharing the data directory
+func (c *Config) suffix() string {
+	if c.NodeID == "" {
+		return ""
+	}
+
+	return "_" + c.NodeID
+}
+
+func isBackend(backend string) bool {
+	for _, b := range storage.Backends {
+		if b == backend {
+			return true
+		}
+	}
+
+	return false
+}
+
+// intSetting returns the setting n as a string, empty when it is unset
+func intSetting(n int) string {
+	if n == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(n)
+}
+
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
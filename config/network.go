@@ -0,0 +1,167 @@
+package config
+
+import (
+	"go-blockchain/errors"
+	"sort"
+)
+
+// The consensus engines a network can run, see blockchain.Consensus
+const (
+	// ProofOfWork seals the blocks with a proof of work, retargeted to keep blocks coming every few seconds
+	ProofOfWork = "pow"
+	// ProofOfAuthority seals the blocks with the signature of one of the Signers of the network
+	ProofOfAuthority = "poa"
+	// InstantSeal seals the blocks right away, for tests
+	InstantSeal = "instant"
+)
+
+// Network holds the parameters of one of the chains a node can run. Each network
+// has its own genesis block, addresses and data directory, so that nodes of
+// several networks can run side by side without mixing their chains
+type Network struct {
+	// Name selects the network with -network
+	Name string
+	// AddressVersion is the version byte of the addresses of the network.
+	// Addresses with another version byte are rejected
+	AddressVersion byte
+	// ScriptAddressVersion is the version byte of the addresses paying to the hash
+	// of a script, like the multisig addresses
+	ScriptAddressVersion byte
+	// GenesisData is the data of the coinbase of the genesis block
+	GenesisData string
+	// Consensus is the engine sealing the blocks, one of ProofOfWork, ProofOfAuthority and InstantSeal
+	Consensus string
+	// Signers are the public keys, in hex, of the authorities sealing the blocks of
+	// a proof-of-authority network. Nodes can configure them, see Config.Signers
+	Signers []string
+	// InitialDifficulty is the number of leading zero bits required from the hash
+	// of the genesis block. It is also the easiest difficulty allowed
+	InitialDifficulty uint
+	// NoRetargeting keeps the difficulty of the genesis block forever
+	NoRetargeting bool
+	// InitialSubsidy is the number of coins the coinbase of a block can create
+	// before the first halving
+	InitialSubsidy int
+	// HalvingInterval is the number of blocks after which the subsidy is halved
+	HalvingInterval int
+	// MaxSupply is the number of coins that can ever be created. The subsidy
+	// stops once the blocks created that many coins
+	MaxSupply int
+	// Port is the default port of the nodes of the network
+	Port string
+	// RPCPort is the default port of the JSON-RPC server
+	RPCPort string
+	// DataSubdir is the directory holding the files of the network in the data directory
+	DataSubdir string
+}
+
+// The networks. Mainnet keeps its files directly in the data directory
+var (
+	Mainnet = Network{
+		Name:                 "mainnet",
+		AddressVersion:       0x00,
+		ScriptAddressVersion: 0x05,
+		GenesisData:          "First Transaction from Genesis",
+		Consensus:            ProofOfWork,
+		InitialDifficulty:    18,
+		InitialSubsidy:       100,
+		HalvingInterval:      100000,
+		MaxSupply:            20000000,
+		Port:                 "3000",
+		RPCPort:              "8332",
+	}
+
+	Testnet = Network{
+		Name:                 "testnet",
+		AddressVersion:       0x6f,
+		ScriptAddressVersion: 0xc4,
+		GenesisData:          "First Transaction from the Testnet Genesis",
+		Consensus:            ProofOfWork,
+		InitialDifficulty:    16,
+		InitialSubsidy:       100,
+		HalvingInterval:      100000,
+		MaxSupply:            20000000,
+		Port:                 "13000",
+		RPCPort:              "18332",
+		DataSubdir:           "testnet",
+	}
+
+	// Regtest is a local network for tests, where blocks are sealed instantly
+	Regtest = Network{
+		Name:                 "regtest",
+		AddressVersion:       0x7a,
+		ScriptAddressVersion: 0xc5,
+		GenesisData:          "First Transaction from the Regtest Genesis",
+		Consensus:            InstantSeal,
+		InitialSubsidy:       100,
+		HalvingInterval:      150,
+		MaxSupply:            20000,
+		Port:                 "23000",
+		RPCPort:              "18443",
+		DataSubdir:           "regtest",
+	}
+
+	// Authority is a network whose blocks are sealed by a configured set of signers
+	Authority = Network{
+		Name:                 "authority",
+		AddressVersion:       0x17,
+		ScriptAddressVersion: 0x1a,
+		GenesisData:          "First Transaction from the Authority Genesis",
+		Consensus:            ProofOfAuthority,
+		InitialSubsidy:       100,
+		HalvingInterval:      100000,
+		MaxSupply:            20000000,
+		Port:                 "33000",
+		RPCPort:              "28332",
+		DataSubdir:           "authority",
+	}
+)
+
+var networks = map[string]*Network{
+	Mainnet.Name:   &Mainnet,
+	Testnet.Name:   &Testnet,
+	Regtest.Name:   &Regtest,
+	Authority.Name: &Authority,
+}
+
+// the network the process runs, mainnet unless another one is selected
+var active = &Mainnet
+
+// NetworkByName returns the network with the name.
+// It fails with ErrUnknownNetwork if there is none
+func NetworkByName(name string) (*Network, error) {
+	network, ok := networks[name]
+	if !ok {
+		return nil, errors.NewUnknownNetworkError(name, NetworkNames())
+	}
+
+	return network, nil
+}
+
+// NetworkNames returns the names of the networks
+func NetworkNames() []string {
+	var names []string
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Params returns the parameters of the network the process runs
+func Params() *Network {
+	return active
+}
+
+// SelectNetwork makes the process run the network with the name.
+// It is meant to be called once, before opening a chain or a wallet file
+func SelectNetwork(name string) error {
+	network, err := NetworkByName(name)
+	if err != nil {
+		return err
+	}
+	active = network
+
+	return nil
+}
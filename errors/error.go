@@ -1,8 +1,10 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"log"
+	"strings"
 )
 
 // HandleErr panics and logs the error
@@ -12,27 +14,173 @@ func HandleErr(err error) {
 	}
 }
 
+// The package shadows the errors package of the standard library, so its functions are re-exported
+
+// Is reports whether any error in the chain of err matches target, see errors.Is
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As finds the first error in the chain of err that matches target, see errors.As
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+// Unwrap returns the error wrapped by err, see errors.Unwrap
+func Unwrap(err error) error {
+	return stderrors.Unwrap(err)
+}
+
+// New returns an error with the text, see errors.New
+func New(text string) error {
+	return stderrors.New(text)
+}
+
 type errorType int
 
 const (
 	transactionNotFoundErr = iota + 1
 	invalidAddressErr
+	invalidTransactionErr
+	invalidBlockErr
+	blockNotFoundErr
+	doubleSpendErr
+	passphraseRequiredErr
+	wrongPassphraseErr
+	invalidMnemonicErr
+	chainNotFoundErr
+	chainExistsErr
+	insufficientFundsErr
+	invalidSignatureErr
+	walletNotFoundErr
+	unknownNetworkErr
+	wrongNetworkErr
+	invalidAmountErr
+	scriptErr
+	invalidMultiSigErr
+	lockedTransactionErr
+	notSignerErr
+	signedRecentlyErr
 )
 
-var errorTypes = []string{"TransactionNotFoundError", "InvalidAddressError"}
+var errorTypes = []string{
+	"TransactionNotFoundError",
+	"InvalidAddressError",
+	"InvalidTransactionError",
+	"InvalidBlockError",
+	"BlockNotFoundError",
+	"DoubleSpendError",
+	"PassphraseRequiredError",
+	"WrongPassphraseError",
+	"InvalidMnemonicError",
+	"ChainNotFoundError",
+	"ChainExistsError",
+	"InsufficientFundsError",
+	"InvalidSignatureError",
+	"WalletNotFoundError",
+	"UnknownNetworkError",
+	"WrongNetworkError",
+	"InvalidAmountError",
+	"ScriptError",
+	"InvalidMultiSigError",
+	"LockedTransactionError",
+	"NotSignerError",
+	"SignedRecentlyError",
+}
 
 func (e errorType) String() string {
 	return red(errorTypes[e-1])
 }
 
+// Error is an error of the package. Errors of the same type match each other
+// with Is, so they can be compared to the Err sentinels:
+//
+//	if errors.Is(err, errors.ErrChainNotFound) {
+type Error struct {
+	errType errorType
+	msg     string
+}
+
+func (e *Error) Error() string {
+	if e.msg == "" {
+		return e.errType.String()
+	}
+
+	return fmt.Sprintf("%s: %s%s", e.errType.String(), e.msg, thumbsDown)
+}
+
+// Plain returns the text of err without the colors and the emoji of the
+// errors of the package, for the messages read by other programs
+func Plain(err error) string {
+	return strings.NewReplacer(bold, "", redColor, "", reset, "", thumbsDown, "").Replace(err.Error())
+}
+
+// Is matches the errors of the same type
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.errType == e.errType
+}
+
 func newError(errType errorType, template string, args ...interface{}) error {
-	msg := fmt.Sprintf(template, args...)
-	err := fmt.Errorf("%s: %s\t👎", errType.String(), msg)
-	return err
+	return &Error{errType: errType, msg: fmt.Sprintf(template, args...)}
 }
 
+const (
+	bold       = "\u001b[1m"
+	redColor   = "\u001b[31m"
+	reset      = "\u001b[0m"
+	thumbsDown = "\t👎"
+)
+
 func red(s string) string {
-	return "\u001b[1m\u001b[31m" + s + "\u001b[0m"
+	return bold + redColor + s + reset
+}
+
+/************************************ SENTINELS ************************************/
+
+// The sentinels match every error of their type with Is
+var (
+	ErrTransactionNotFound = &Error{errType: transactionNotFoundErr}
+	ErrInvalidAddress      = &Error{errType: invalidAddressErr}
+	ErrInvalidTransaction  = &Error{errType: invalidTransactionErr}
+	ErrInvalidBlock        = &Error{errType: invalidBlockErr}
+	ErrBlockNotFound       = &Error{errType: blockNotFoundErr}
+	ErrDoubleSpend         = &Error{errType: doubleSpendErr}
+	ErrPassphraseRequired  = &Error{errType: passphraseRequiredErr}
+	ErrWrongPassphrase     = &Error{errType: wrongPassphraseErr}
+	ErrInvalidMnemonic     = &Error{errType: invalidMnemonicErr}
+	ErrChainNotFound       = &Error{errType: chainNotFoundErr}
+	ErrChainExists         = &Error{errType: chainExistsErr}
+	ErrInsufficientFunds   = &Error{errType: insufficientFundsErr}
+	ErrInvalidSignature    = &Error{errType: invalidSignatureErr}
+	ErrWalletNotFound      = &Error{errType: walletNotFoundErr}
+	ErrUnknownNetwork      = &Error{errType: unknownNetworkErr}
+	ErrWrongNetwork        = &Error{errType: wrongNetworkErr}
+	ErrInvalidAmount       = &Error{errType: invalidAmountErr}
+	ErrScript              = &Error{errType: scriptErr}
+	ErrInvalidMultiSig     = &Error{errType: invalidMultiSigErr}
+	ErrLockedTransaction   = &Error{errType: lockedTransactionErr}
+	ErrNotSigner           = &Error{errType: notSignerErr}
+	ErrSignedRecently      = &Error{errType: signedRecentlyErr}
+)
+
+/************************************ TYPED ERRORS ************************************/
+
+// InsufficientFundsError is returned when an address cannot pay an amount.
+// It matches ErrInsufficientFunds
+type InsufficientFundsError struct {
+	Address   string
+	Available int
+	Required  int
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return newError(insufficientFundsErr, "%s has %d, %d are required", e.Address, e.Available, e.Required).Error()
+}
+
+// Is matches ErrInsufficientFunds
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
 }
 
 /************************************ FACTORY METHODS ************************************/
@@ -40,7 +188,7 @@ func red(s string) string {
 // NewTransactionNotFoundError returns
 // TransactionNotFoundError: No transaction found with ID: ID
 func NewTransactionNotFoundError(ID []byte) error {
-	return newError(transactionNotFoundErr, "No transaction found with ID %s", ID)
+	return newError(transactionNotFoundErr, "No transaction found with ID %x", ID)
 }
 
 // NewInvalidAddressError returns
@@ -48,3 +196,171 @@ func NewTransactionNotFoundError(ID []byte) error {
 func NewInvalidAddressError(address string) error {
 	return newError(invalidAddressErr, "%s is not a valid address", address)
 }
+
+// NewInvalidTransactionError returns
+// InvalidTransactionError: Transaction ID is not valid
+func NewInvalidTransactionError(ID []byte) error {
+	return newError(invalidTransactionErr, "Transaction %x is not valid", ID)
+}
+
+// NewInvalidPartialTransactionError returns
+// InvalidTransactionError: The partial transaction is not valid: REASON
+func NewInvalidPartialTransactionError(reason string) error {
+	return newError(invalidTransactionErr, "The partial transaction is not valid: %s", reason)
+}
+
+// NewOverspendError returns
+// InvalidTransactionError: Transaction ID spends INPUT but creates OUTPUT
+func NewOverspendError(ID []byte, inputValue, outputValue int) error {
+	return newError(invalidTransactionErr, "Transaction %x spends %d but creates %d", ID, inputValue, outputValue)
+}
+
+// NewOutputValueError returns
+// InvalidTransactionError: Transaction ID has invalid output values: REASON
+func NewOutputValueError(ID []byte, template string, args ...interface{}) error {
+	return newError(invalidTransactionErr, "Transaction %x has invalid output values: %s", ID, fmt.Sprintf(template, args...))
+}
+
+// NewInvalidBlockError returns
+// InvalidBlockError: Block HASH is not valid: REASON
+func NewInvalidBlockError(hash []byte, reason string) error {
+	return newError(invalidBlockErr, "Block %x is not valid: %s", hash, reason)
+}
+
+// NewBlockNotFoundError returns
+// BlockNotFoundError: No block found with hash HASH
+func NewBlockNotFoundError(hash []byte) error {
+	return newError(blockNotFoundErr, "No block found with hash %x", hash)
+}
+
+// NewBlockHeightNotFoundError returns
+// BlockNotFoundError: No block found at height HEIGHT
+func NewBlockHeightNotFoundError(height int) error {
+	return newError(blockNotFoundErr, "No block found at height %d", height)
+}
+
+// NewDoubleSpendError returns
+// DoubleSpendError: Transaction ID spends output OUT of PREVID already spent by SPENDER
+func NewDoubleSpendError(ID, prevID []byte, out int, spender string) error {
+	return newError(doubleSpendErr, "Transaction %x spends output %d of %x already spent by %s", ID, out, prevID, spender)
+}
+
+// NewPassphraseRequiredError returns
+// PassphraseRequiredError: The wallet file is encrypted, a passphrase is required
+func NewPassphraseRequiredError() error {
+	return newError(passphraseRequiredErr, "The wallet file is encrypted, a passphrase is required")
+}
+
+// NewWrongPassphraseError returns
+// WrongPassphraseError: The passphrase does not decrypt the wallet file
+func NewWrongPassphraseError() error {
+	return newError(wrongPassphraseErr, "The passphrase does not decrypt the wallet file")
+}
+
+// NewInvalidMnemonicError returns
+// InvalidMnemonicError: The recovery phrase is not a valid mnemonic
+func NewInvalidMnemonicError() error {
+	return newError(invalidMnemonicErr, "The recovery phrase is not a valid mnemonic")
+}
+
+// NewChainNotFoundError returns
+// ChainNotFoundError: No existing blockchain found, create one!
+func NewChainNotFoundError() error {
+	return newError(chainNotFoundErr, "No existing blockchain found, create one!")
+}
+
+// NewChainExistsError returns
+// ChainExistsError: Blockchain already exists
+func NewChainExistsError() error {
+	return newError(chainExistsErr, "Blockchain already exists")
+}
+
+// NewInsufficientFundsError returns
+// InsufficientFundsError: ADDRESS has AVAILABLE, REQUIRED are required
+func NewInsufficientFundsError(address string, available, required int) error {
+	return &InsufficientFundsError{Address: address, Available: available, Required: required}
+}
+
+// NewInvalidSignatureError returns
+// InvalidSignatureError: Input IN of transaction ID is not correctly signed
+func NewInvalidSignatureError(ID []byte, in int) error {
+	return newError(invalidSignatureErr, "Input %d of transaction %x is not correctly signed", in, ID)
+}
+
+// NewMissingSignaturesError returns
+// InvalidSignatureError: Input IN of transaction ID has HAVE of the REQUIRED signatures it needs
+func NewMissingSignaturesError(ID []byte, in, have, required int) error {
+	return newError(invalidSignatureErr, "Input %d of transaction %x has %d of the %d signatures it needs", in, ID, have, required)
+}
+
+// NewWalletNotFoundError returns
+// WalletNotFoundError: The wallet file has no wallet for ADDRESS
+func NewWalletNotFoundError(address string) error {
+	return newError(walletNotFoundErr, "The wallet file has no wallet for %s", address)
+}
+
+// NewUnknownNetworkError returns
+// UnknownNetworkError: NAME is not a network, choose one of NAMES
+func NewUnknownNetworkError(name string, names []string) error {
+	return newError(unknownNetworkErr, "%s is not a network, choose one of %s", name, strings.Join(names, ", "))
+}
+
+// NewScriptAddressError returns
+// InvalidAddressError: ADDRESS is the address of a script, not of a key
+func NewScriptAddressError(address string) error {
+	return newError(invalidAddressErr, "%s is the address of a script, not of a key", address)
+}
+
+// NewWrongNetworkAddressError returns
+// WrongNetworkError: ADDRESS is not an address of the NETWORK network
+func NewWrongNetworkAddressError(address, network string) error {
+	return newError(wrongNetworkErr, "%s is not an address of the %s network", address, network)
+}
+
+// NewWrongNetworkChainError returns
+// WrongNetworkError: The blockchain belongs to the FOUND network, not to the NETWORK network
+func NewWrongNetworkChainError(found, network string) error {
+	return newError(wrongNetworkErr, "The blockchain belongs to the %s network, not to the %s network", found, network)
+}
+
+// NewWrongNetworkTransactionError returns
+// WrongNetworkError: The transaction belongs to the FOUND network, not to the NETWORK network
+func NewWrongNetworkTransactionError(found, network string) error {
+	return newError(wrongNetworkErr, "The transaction belongs to the %s network, not to the %s network", found, network)
+}
+
+// NewInvalidAmountError returns
+// InvalidAmountError: The NAME cannot be VALUE
+func NewInvalidAmountError(name string, value int) error {
+	return newError(invalidAmountErr, "The %s cannot be %d", name, value)
+}
+
+// NewScriptError returns
+// ScriptError: REASON
+func NewScriptError(template string, args ...interface{}) error {
+	return newError(scriptErr, template, args...)
+}
+
+// NewInvalidMultiSigError returns
+// InvalidMultiSigError: REASON
+func NewInvalidMultiSigError(template string, args ...interface{}) error {
+	return newError(invalidMultiSigErr, template, args...)
+}
+
+// NewLockedTransactionError returns
+// LockedTransactionError: Transaction ID is locked: REASON
+func NewLockedTransactionError(ID []byte, template string, args ...interface{}) error {
+	return newError(lockedTransactionErr, "Transaction %x is locked: %s", ID, fmt.Sprintf(template, args...))
+}
+
+// NewNotSignerError returns
+// NotSignerError: The node cannot seal blocks: REASON
+func NewNotSignerError(template string, args ...interface{}) error {
+	return newError(notSignerErr, "The node cannot seal blocks: %s", fmt.Sprintf(template, args...))
+}
+
+// NewSignedRecentlyError returns
+// SignedRecentlyError: The signer sealed block LAST, it cannot seal blocks before block NEXT
+func NewSignedRecentlyError(last, next int) error {
+	return newError(signedRecentlyErr, "The signer sealed block %d, it cannot seal blocks before block %d", last, next)
+}
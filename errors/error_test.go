@@ -0,0 +1,14 @@
+package errors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlain(t *testing.T) {
+	err := fmt.Errorf("%w: %v", NewInvalidAddressError("abc"), NewWalletNotFoundError("abc"))
+	want := "InvalidAddressError: abc is not a valid address: WalletNotFoundError: The wallet file has no wallet for abc"
+	if got := Plain(err); got != want {
+		t.Fatalf("the plain message is %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package errors
+
+import "fmt"
+
+// VerificationFailure is the reason why a block failed the verification of the chain
+type VerificationFailure int
+
+const (
+	// BadLink means the block does not point to the previous block of the chain
+	BadLink VerificationFailure = iota + 1
+	// BadHeight means the height of the block does not follow the previous block
+	BadHeight
+	// BadSeal means the hash or the seal of the block are wrong, like its target or its nonce
+	BadSeal
+	// BadTimestamp means the block claims to have been created too far in the future
+	BadTimestamp
+	// BadCoinbase means the block has no transactions or a coinbase that is not its first transaction
+	BadCoinbase
+	// BadCoinbaseReward means the coinbase claims more than the subsidy and the fees of the block
+	BadCoinbaseReward
+	// BadSignature means a transaction of the block is not correctly signed
+	BadSignature
+	// MissingInput means a transaction spends an output that never existed
+	MissingInput
+	// DoubleSpend means a transaction spends an output that was already spent
+	DoubleSpend
+	// ValueMismatch means a transaction creates more value than it spends
+	ValueMismatch
+	// BadTransactionID means the ID of a transaction is not the hash of its content
+	BadTransactionID
+	// BadMerkleRoot means the merkle root of the header is not the one of the transactions of the block
+	BadMerkleRoot
+	// LockedTransaction means a transaction of the block is not final at its height or its timestamp
+	LockedTransaction
+	// BadOutputValue means a transaction of the block has an output without value or outputs adding up to more than the maximum supply
+	BadOutputValue
+)
+
+var verificationFailures = []string{
+	"bad link to the previous block",
+	"bad height",
+	"bad seal",
+	"bad timestamp",
+	"bad coinbase",
+	"bad coinbase reward",
+	"bad signature",
+	"missing input",
+	"double spend",
+	"outputs exceed inputs",
+	"bad transaction ID",
+	"bad merkle root",
+	"locked transaction",
+	"bad output value",
+}
+
+func (f VerificationFailure) String() string {
+	return verificationFailures[f-1]
+}
+
+// ChainVerificationError is the error describing the first invalid block of a chain
+type ChainVerificationError struct {
+	Height int
+	Hash   []byte
+	Reason VerificationFailure
+	Detail string
+}
+
+func (e *ChainVerificationError) Error() string {
+	msg := fmt.Sprintf("Block %x at height %d is invalid: %s", e.Hash, e.Height, e.Reason)
+	if e.Detail != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Detail)
+	}
+
+	return fmt.Sprintf("%s: %s%s", red("ChainVerificationError"), msg, thumbsDown)
+}
+
+// NewChainVerificationError returns
+// ChainVerificationError: Block HASH at height HEIGHT is invalid: REASON (DETAIL)
+func NewChainVerificationError(height int, hash []byte, reason VerificationFailure, detail string, args ...interface{}) error {
+	return &ChainVerificationError{
+		Height: height,
+		Hash:   hash,
+		Reason: reason,
+		Detail: fmt.Sprintf(detail, args...),
+	}
+}
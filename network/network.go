@@ -0,0 +1,798 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"go-blockchain/blockchain"
+	"go-blockchain/config"
+	"go-blockchain/errors"
+	"go-blockchain/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	protocol = "tcp"
+	// ProtocolVersion is the version of the message protocol spoken by the node.
+	// Nodes ignore the messages of peers speaking another version. Version 2 sends
+	// the blocks and the transactions in their binary encoding, version 3 compares
+	// the chainwork of the chains instead of their heights
+	ProtocolVersion = 3
+	commandLength   = 12
+	dialTimeout     = 5 * time.Second
+	// ioTimeout is how long a peer has to send or receive a whole message
+	ioTimeout = 30 * time.Second
+	// maxMessageSize is the size of the largest message a node reads
+	maxMessageSize = 32 << 20
+)
+
+// KnownNodes returns the nodes a node connects to when no peers are given:
+// the node listening on the default port of the network the process runs
+func KnownNodes() []string {
+	return []string{fmt.Sprintf("localhost:%s", config.Params().Port)}
+}
+
+// Version is sent when connecting to a node, to compare the chainwork of the chains.
+// Nodes ignore the peers of other networks
+type Version struct {
+	Version   int
+	ChainWork []byte // big-endian chainwork of the main chain, see blockchain.BlockChain.GetChainWork
+	AddrFrom  string
+	Network   string
+}
+
+// GetBlocks asks for the hashes of the blocks after the block with hash From
+type GetBlocks struct {
+	AddrFrom string
+	From     []byte
+}
+
+// Inv announces blocks or transactions the sender has
+type Inv struct {
+	AddrFrom string
+	Type     string
+	Items    [][]byte
+}
+
+// GetData asks for a single block or transaction
+type GetData struct {
+	AddrFrom string
+	Type     string
+	ID       []byte
+}
+
+// Block carries a serialized block
+type Block struct {
+	AddrFrom string
+	Block    []byte
+}
+
+// Tx carries a serialized transaction
+type Tx struct {
+	AddrFrom    string
+	Transaction []byte
+}
+
+// Server is a node of the peer-to-peer network. It keeps its chain in sync with
+// its peers, relays new blocks and transactions and, if it has a miner address,
+// mines the transactions it receives. Mining runs next to the handling of the
+// messages, a block received from a peer abandons the block being mined
+type Server struct {
+	Address      string
+	MinerAddress string
+
+	chain           *blockchain.BlockChain
+	knownNodes      []string
+	mempool         *blockchain.Mempool
+	miner           *blockchain.Miner
+	blocksInTransit [][]byte
+	listener        net.Listener
+	stopped         bool
+	handlers        sync.WaitGroup // the connections being handled, see Stop
+	outbox          []message      // messages queued while mu is held, see locked
+	mu              sync.Mutex
+}
+
+// message is a command with its payload, ready to be sent to address
+type message struct {
+	address string
+	data    []byte
+}
+
+// NewServer creates a node listening on address that connects to peers
+func NewServer(address, minerAddress string, chain *blockchain.BlockChain, peers []string) *Server {
+	s := &Server{
+		Address:      address,
+		MinerAddress: minerAddress,
+		chain:        chain,
+		mempool:      blockchain.NewMempool(chain),
+	}
+	chain.Subscribe(s.handleTipChange)
+
+	if minerAddress != "" {
+		s.miner = blockchain.NewMiner(chain, minerAddress, s.mempool)
+		s.miner.WaitForTransactions = true
+		s.miner.Found = s.announceBlock
+	}
+
+	for _, peer := range peers {
+		s.addNode(peer)
+	}
+
+	return s
+}
+
+// StartServer opens the chain of the node, sealing its blocks with engine, and runs
+// a server on its port until the process is interrupted
+func StartServer(cfg *config.Config, minerAddress string, engine blockchain.Consensus) error {
+	db, err := storage.Open(cfg.Backend, cfg.BlocksDir())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	chain, err := openChain(cfg, db, engine)
+	if err != nil {
+		return err
+	}
+
+	s := NewServer(fmt.Sprintf("localhost:%s", cfg.Port), minerAddress, chain, configPeers(cfg))
+	if minerAddress != "" {
+		fmt.Printf("Mining is on. Address to receive rewards: %s\n", minerAddress)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		s.Stop()
+	}()
+
+	return s.Start()
+}
+
+// StartMiner opens the chain of the node, sealing its blocks with engine, and runs
+// a server on its port mining blocks to minerAddress, see Server.Mine
+func StartMiner(ctx context.Context, cfg *config.Config, minerAddress string, blocks int, engine blockchain.Consensus) (blockchain.MinerStats, error) {
+	db, err := storage.Open(cfg.Backend, cfg.BlocksDir())
+	if err != nil {
+		return blockchain.MinerStats{}, err
+	}
+	defer db.Close()
+
+	chain, err := openChain(cfg, db, engine)
+	if err != nil {
+		return blockchain.MinerStats{}, err
+	}
+	if chain.GetLastHash() == nil {
+		return blockchain.MinerStats{}, errors.NewChainNotFoundError()
+	}
+
+	s := NewServer(fmt.Sprintf("localhost:%s", cfg.Port), "", chain, configPeers(cfg))
+
+	return s.Mine(ctx, minerAddress, blocks)
+}
+
+// openChain opens the chain of db, sealing its blocks with engine
+func openChain(cfg *config.Config, db storage.Store, engine blockchain.Consensus) (*blockchain.BlockChain, error) {
+	chain, err := blockchain.OpenBlockChain(db)
+	if err != nil {
+		return nil, err
+	}
+	chain.PoW = blockchain.PoWOptions{Workers: cfg.Workers}
+	chain.Consensus = engine
+
+	return chain, nil
+}
+
+// configPeers returns the nodes of cfg, or the known nodes if it has none
+func configPeers(cfg *config.Config) []string {
+	if len(cfg.Peers) == 0 {
+		return KnownNodes()
+	}
+
+	return cfg.Peers
+}
+
+// Start listens for messages and announces the node to its peers, while the miner
+// of the node mines if it has one. It blocks until the server is stopped
+func (s *Server) Start() error {
+	if s.miner != nil {
+		ctx, stopMining := context.WithCancel(context.Background())
+		mined := make(chan struct{})
+		go func() {
+			defer close(mined)
+			if _, err := s.miner.Mine(ctx, 0); err != nil {
+				log.Printf("Mining stopped: %v", err)
+			}
+		}()
+		defer func() {
+			stopMining()
+			<-mined
+		}()
+	}
+
+	return s.serve()
+}
+
+// serve listens for messages and announces the node to its peers.
+// It blocks until the server is stopped
+func (s *Server) serve() error {
+	ln, err := net.Listen(protocol, s.Address)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Starting node %s\n", s.Address)
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return ln.Close()
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	err = s.locked(func() error {
+		for _, node := range s.peers() {
+			if err := s.sendVersion(node); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		s.Stop()
+		return err
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isStopped() {
+				return nil
+			}
+			return err
+		}
+
+		// Stop waits for the handlers, none can start once it is stopped
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.handlers.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.handlers.Done()
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+// Mine runs the server while a miner mines blocks blocks paying minerAddress, or
+// until ctx is done if blocks is 0. The blocks hold the transactions of the mempool
+// of the node, or only a coinbase when none is pending. The server must not have
+// a miner address
+func (s *Server) Mine(ctx context.Context, minerAddress string, blocks int) (blockchain.MinerStats, error) {
+	s.miner = blockchain.NewMiner(s.chain, minerAddress, s.mempool)
+	s.miner.Found = s.announceBlock
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve()
+	}()
+
+	stats, err := s.miner.Mine(ctx, blocks)
+	s.Stop()
+	if serveErr := <-served; err == nil {
+		err = serveErr
+	}
+
+	return stats, err
+}
+
+// Stop stops listening and waits for the messages being handled
+func (s *Server) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	if s.listener != nil {
+		listener := s.listener
+		s.listener = nil
+		listener.Close()
+	}
+	s.mu.Unlock()
+
+	// the handlers hold mu while they handle their message
+	s.handlers.Wait()
+}
+
+func (s *Server) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stopped
+}
+
+// SendTx sends a transaction to the node at address, which relays it to the network
+func SendTx(address string, tx *blockchain.Transaction) error {
+	payload, err := GobEncode(Tx{AddrFrom: "", Transaction: tx.Serialize()})
+	if err != nil {
+		return err
+	}
+
+	command, err := CmdToBytes("tx")
+	if err != nil {
+		return err
+	}
+
+	return send(address, append(command, payload...))
+}
+
+/************************************ SENDING ************************************/
+
+// The messages are handled one at a time, holding s.mu, but a peer that is slow to
+// answer must not hold up the others: the messages sent while s.mu is held are
+// queued and only sent once it is released, see locked
+
+// locked runs fn holding s.mu, then sends the messages fn queued
+func (s *Server) locked(fn func() error) error {
+	s.mu.Lock()
+	err := fn()
+	outbox := s.outbox
+	s.outbox = nil
+	s.mu.Unlock()
+
+	for _, m := range outbox {
+		if err := send(m.address, m.data); err != nil {
+			fmt.Printf("%s is not available\n", m.address)
+			s.mu.Lock()
+			s.removeNode(m.address)
+			s.mu.Unlock()
+		}
+	}
+
+	return err
+}
+
+// sendMessage queues the command with its payload for address, s.mu is held.
+// Peers that cannot be reached are forgotten, only failing to encode the message
+// is an error
+func (s *Server) sendMessage(address, command string, payload interface{}) error {
+	cmd, err := CmdToBytes(command)
+	if err != nil {
+		return err
+	}
+	data, err := GobEncode(payload)
+	if err != nil {
+		return err
+	}
+	s.outbox = append(s.outbox, message{address, append(cmd, data...)})
+
+	return nil
+}
+
+func send(address string, data []byte) error {
+	conn, err := net.DialTimeout(protocol, address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(ioTimeout)); err != nil {
+		return err
+	}
+	_, err = io.Copy(conn, bytes.NewReader(data))
+	return err
+}
+
+func (s *Server) sendVersion(address string) error {
+	work, err := s.chainWork()
+	if err != nil {
+		return err
+	}
+
+	return s.sendMessage(address, "version", Version{ProtocolVersion, work.Bytes(), s.Address, config.Params().Name})
+}
+
+// chainWork returns the chainwork of the main chain, 0 for a chain without blocks
+func (s *Server) chainWork() (*big.Int, error) {
+	lastHash := s.chain.GetLastHash()
+	if lastHash == nil {
+		return big.NewInt(0), nil
+	}
+
+	return s.chain.GetChainWork(lastHash)
+}
+
+func (s *Server) sendGetBlocks(address string) error {
+	return s.sendMessage(address, "getblocks", GetBlocks{s.Address, s.chain.GetLastHash()})
+}
+
+func (s *Server) sendInv(address, kind string, items [][]byte) error {
+	return s.sendMessage(address, "inv", Inv{s.Address, kind, items})
+}
+
+func (s *Server) sendGetData(address, kind string, id []byte) error {
+	return s.sendMessage(address, "getdata", GetData{s.Address, kind, id})
+}
+
+func (s *Server) sendBlock(address string, b *blockchain.Block) error {
+	return s.sendMessage(address, "block", Block{s.Address, b.Serialize()})
+}
+
+func (s *Server) sendTx(address string, tx *blockchain.Transaction) error {
+	return s.sendMessage(address, "tx", Tx{s.Address, tx.Serialize()})
+}
+
+// broadcastInv announces items to every peer except the one they came from
+func (s *Server) broadcastInv(kind string, items [][]byte, except string) error {
+	for _, node := range s.peers() {
+		if node == except {
+			continue
+		}
+		if err := s.sendInv(node, kind, items); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/************************************ HANDLING ************************************/
+
+func (s *Server) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	// a peer can neither keep the connection open nor send more than a message
+	if err := conn.SetReadDeadline(time.Now().Add(ioTimeout)); err != nil {
+		return
+	}
+	request, err := ioutil.ReadAll(io.LimitReader(conn, maxMessageSize+1))
+	if err != nil || len(request) < commandLength {
+		return
+	}
+	if len(request) > maxMessageSize {
+		log.Printf("Dropped message from %s: it is larger than %d bytes", conn.RemoteAddr(), maxMessageSize)
+		return
+	}
+
+	command := BytesToCmd(request[:commandLength])
+	err = s.locked(func() error {
+		return s.handleMessage(command, request[commandLength:])
+	})
+	if err != nil {
+		log.Printf("Dropped %s message from %s: %v", command, conn.RemoteAddr(), err)
+	}
+}
+
+func (s *Server) handleMessage(command string, payload []byte) (err error) {
+	// a malformed message must not bring the whole node down
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	switch command {
+	case "version":
+		err = s.handleVersion(payload)
+	case "getblocks":
+		err = s.handleGetBlocks(payload)
+	case "inv":
+		err = s.handleInv(payload)
+	case "getdata":
+		err = s.handleGetData(payload)
+	case "block":
+		err = s.handleBlock(payload)
+	case "tx":
+		err = s.handleTx(payload)
+	default:
+		fmt.Printf("Unknown command %s\n", command)
+	}
+
+	return err
+}
+
+func (s *Server) handleVersion(request []byte) error {
+	var payload Version
+	if err := GobDecode(request, &payload); err != nil {
+		return err
+	}
+
+	if payload.Version != ProtocolVersion {
+		fmt.Printf("Ignoring %s, it speaks protocol version %d\n", payload.AddrFrom, payload.Version)
+		return nil
+	}
+	if payload.Network != config.Params().Name {
+		fmt.Printf("Ignoring %s, it runs the %s network\n", payload.AddrFrom, payload.Network)
+		return nil
+	}
+
+	s.addNode(payload.AddrFrom)
+
+	// the main chain is the one with the most work, which may not be the longest
+	work, err := s.chainWork()
+	if err != nil {
+		return err
+	}
+	switch work.Cmp(new(big.Int).SetBytes(payload.ChainWork)) {
+	case -1:
+		return s.sendGetBlocks(payload.AddrFrom)
+	case 1:
+		return s.sendVersion(payload.AddrFrom)
+	}
+
+	return nil
+}
+
+func (s *Server) handleGetBlocks(request []byte) error {
+	var payload GetBlocks
+	if err := GobDecode(request, &payload); err != nil {
+		return err
+	}
+
+	hashes, err := s.chain.GetBlockHashes(payload.From)
+	if err != nil {
+		return err
+	}
+	if len(hashes) > 0 {
+		return s.sendInv(payload.AddrFrom, "block", hashes)
+	}
+
+	return nil
+}
+
+func (s *Server) handleInv(request []byte) error {
+	var payload Inv
+	if err := GobDecode(request, &payload); err != nil {
+		return err
+	}
+
+	switch payload.Type {
+	case "block":
+		// the blocks are added to the ones of a sync in progress, which another
+		// peer may be sending
+		for _, hash := range payload.Items {
+			if !s.chain.HasBlock(hash) && !s.inTransit(hash) {
+				s.blocksInTransit = append(s.blocksInTransit, hash)
+			}
+		}
+		return s.requestNextBlock(payload.AddrFrom)
+	case "tx":
+		for _, txID := range payload.Items {
+			if s.mempool.Has(txID) {
+				continue
+			}
+			if err := s.sendGetData(payload.AddrFrom, "tx", txID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handleGetData(request []byte) error {
+	var payload GetData
+	if err := GobDecode(request, &payload); err != nil {
+		return err
+	}
+
+	switch payload.Type {
+	case "block":
+		block, err := s.chain.GetBlock(payload.ID)
+		if err != nil {
+			return nil
+		}
+		return s.sendBlock(payload.AddrFrom, block)
+	case "tx":
+		tx, ok := s.mempool.Get(payload.ID)
+		if !ok {
+			return nil
+		}
+		return s.sendTx(payload.AddrFrom, tx)
+	}
+
+	return nil
+}
+
+func (s *Server) handleBlock(request []byte) error {
+	var payload Block
+	if err := GobDecode(request, &payload); err != nil {
+		return err
+	}
+
+	block, err := blockchain.Deserialize(payload.Block)
+	if err != nil {
+		return err
+	}
+
+	if len(block.PrevHash) != 0 && !s.chain.HasBlock(block.PrevHash) {
+		// the block is on a branch of the peer the node misses blocks of, which it
+		// downloads from its tip like when it is behind
+		fmt.Printf("Received block %x whose previous block is unknown, asking %s for the missing blocks\n", block.Hash, payload.AddrFrom)
+		s.blocksInTransit = nil
+
+		return s.sendGetBlocks(payload.AddrFrom)
+	}
+	syncing := len(s.blocksInTransit) > 0
+
+	isNew := !s.chain.HasBlock(block.Hash)
+	if err := s.chain.AddBlock(block); err != nil {
+		s.blocksInTransit = nil
+		return err
+	}
+	fmt.Printf("Received block %x at height %d\n", block.Hash, block.Height)
+
+	if syncing {
+		return s.requestNextBlock(payload.AddrFrom)
+	}
+
+	if isNew && bytes.Equal(s.chain.GetLastHash(), block.Hash) {
+		return s.broadcastInv("block", [][]byte{block.Hash}, payload.AddrFrom)
+	}
+
+	return nil
+}
+
+func (s *Server) handleTx(request []byte) error {
+	var payload Tx
+	if err := GobDecode(request, &payload); err != nil {
+		return err
+	}
+
+	tx, err := blockchain.DeserializeTransaction(payload.Transaction)
+	if err != nil {
+		return err
+	}
+	if s.mempool.Has(tx.ID) {
+		return nil
+	}
+
+	if err := s.mempool.Add(&tx); err != nil {
+		return err
+	}
+	fmt.Printf("Received transaction %x\n", tx.ID)
+
+	if err := s.broadcastInv("tx", [][]byte{tx.ID}, payload.AddrFrom); err != nil {
+		return err
+	}
+
+	if s.miner != nil {
+		s.miner.Wake()
+	}
+
+	return nil
+}
+
+// handleTipChange updates the mempool after a change of the tip of the chain
+func (s *Server) handleTipChange(change *blockchain.TipChange) {
+	if change.IsReorg() {
+		fmt.Printf("Reorganized to block %x at height %d: %d blocks disconnected and %d connected after fork %x\n",
+			change.Tip().Hash, change.Tip().Height, len(change.Disconnected), len(change.Connected), change.Fork)
+	}
+
+	s.mempool.UpdateTip(change)
+}
+
+// inTransit checks if the block is still to be requested by the sync in progress
+func (s *Server) inTransit(hash []byte) bool {
+	for _, transit := range s.blocksInTransit {
+		if bytes.Equal(transit, hash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestNextBlock asks address for the next block of the sync in progress
+func (s *Server) requestNextBlock(address string) error {
+	if len(s.blocksInTransit) == 0 {
+		return nil
+	}
+
+	hash := s.blocksInTransit[0]
+	s.blocksInTransit = s.blocksInTransit[1:]
+
+	return s.sendGetData(address, "block", hash)
+}
+
+// announceBlock announces a block mined by the node to its peers
+func (s *Server) announceBlock(block *blockchain.Block) {
+	err := s.locked(func() error {
+		fmt.Printf("Mined block %x at height %d with %d transactions\n", block.Hash, block.Height, len(block.Transactions))
+		return s.broadcastInv("block", [][]byte{block.Hash}, "")
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+/************************************ PEERS ************************************/
+
+func (s *Server) peers() []string {
+	return append([]string{}, s.knownNodes...)
+}
+
+func (s *Server) addNode(address string) {
+	if address == "" || address == s.Address {
+		return
+	}
+
+	for _, node := range s.knownNodes {
+		if node == address {
+			return
+		}
+	}
+
+	s.knownNodes = append(s.knownNodes, address)
+}
+
+func (s *Server) removeNode(address string) {
+	for i, node := range s.knownNodes {
+		if node == address {
+			s.knownNodes = append(s.knownNodes[:i], s.knownNodes[i+1:]...)
+			return
+		}
+	}
+}
+
+/************************************ ENCODING ************************************/
+
+// CmdToBytes pads the command to commandLength bytes
+func CmdToBytes(cmd string) ([]byte, error) {
+	if len(cmd) > commandLength {
+		return nil, fmt.Errorf("the command %s is longer than %d bytes", cmd, commandLength)
+	}
+
+	var bytes [commandLength]byte
+	copy(bytes[:], cmd)
+
+	return bytes[:], nil
+}
+
+// BytesToCmd strips the padding of a command
+func BytesToCmd(bytes []byte) string {
+	var cmd []byte
+
+	for _, b := range bytes {
+		if b != 0x0 {
+			cmd = append(cmd, b)
+		}
+	}
+
+	return string(cmd)
+}
+
+// GobEncode encodes the payload of a message
+func GobEncode(data interface{}) ([]byte, error) {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// GobDecode decodes the payload of a message into data
+func GobDecode(payload []byte, data interface{}) error {
+	dec := gob.NewDecoder(bytes.NewReader(payload))
+
+	return dec.Decode(data)
+}
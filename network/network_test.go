@@ -0,0 +1,323 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"go-blockchain/blockchain"
+	"go-blockchain/config"
+	"go-blockchain/storage"
+	"go-blockchain/wallet"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// blocks are sealed instantly on regtest
+	if err := config.SelectNetwork(config.Regtest.Name); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// newWallet returns a wallet holding a new key
+func newWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+
+	w, err := wallet.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+// newChain returns a chain in memory whose genesis block pays w
+func newChain(t *testing.T, w *wallet.Wallet) *blockchain.BlockChain {
+	t.Helper()
+
+	engine, err := blockchain.NewConsensus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := blockchain.InitBlockChain(string(w.Address()), storage.NewMemory(), engine, blockchain.PoWOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chain
+}
+
+// emptyChain returns a chain in memory without blocks, like the one of a new node
+func emptyChain(t *testing.T) *blockchain.BlockChain {
+	t.Helper()
+
+	chain, err := blockchain.OpenBlockChain(storage.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chain
+}
+
+// mineBlocks mines blocks with only a coinbase paying w on top of the chain,
+// without announcing them
+func mineBlocks(t *testing.T, chain *blockchain.BlockChain, w *wallet.Wallet, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		height, err := chain.GetBestHeight()
+		if err != nil {
+			t.Fatal(err)
+		}
+		coinbase, err := blockchain.CoinBaseTx(string(w.Address()), "", height+1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.MineBlock(context.Background(), []*blockchain.Transaction{coinbase}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// freeAddress returns a local address no one listens on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen(protocol, "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+// startNode runs a node with the chain on a free local port until the test ends
+func startNode(t *testing.T, chain *blockchain.BlockChain, minerAddress string, peers ...string) *Server {
+	t.Helper()
+
+	s := NewServer(freeAddress(t), minerAddress, chain, peers)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Start()
+	}()
+	t.Cleanup(func() {
+		s.Stop()
+		if err := <-done; err != nil {
+			t.Errorf("node %s: %v", s.Address, err)
+		}
+	})
+
+	waitFor(t, "node "+s.Address+" to listen", func() bool {
+		conn, err := net.Dial(protocol, s.Address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+
+		return true
+	})
+
+	return s
+}
+
+// waitFor fails the test if cond is still false after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(10 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForTip waits until every node has the tip of the chain of want
+func waitForTip(t *testing.T, want *Server, nodes ...*Server) {
+	t.Helper()
+
+	tip := want.chain.GetLastHash()
+	for _, s := range nodes {
+		waitFor(t, "node "+s.Address+" to reach the tip", func() bool {
+			return bytes.Equal(s.chain.GetLastHash(), tip)
+		})
+	}
+}
+
+func TestNewNodesDownloadTheChain(t *testing.T) {
+	w := newWallet(t)
+	chain := newChain(t, w)
+	mineBlocks(t, chain, w, 3)
+
+	a := startNode(t, chain, "")
+	b := startNode(t, emptyChain(t), "", a.Address)
+	c := startNode(t, emptyChain(t), "", b.Address)
+
+	waitForTip(t, a, b, c)
+	if height, err := c.chain.GetBestHeight(); err != nil || height != 3 {
+		t.Fatalf("the node downloaded a chain of height %d (%v), expected 3", height, err)
+	}
+}
+
+func TestTransactionsAndBlocksPropagate(t *testing.T) {
+	w := newWallet(t)
+	chain := newChain(t, w)
+
+	// the transactions go c -> b -> a, where they are mined, and the block a -> b -> c
+	a := startNode(t, chain, string(newWallet(t).Address()))
+	b := startNode(t, emptyChain(t), "", a.Address)
+	c := startNode(t, emptyChain(t), "", b.Address)
+	waitForTip(t, a, b, c)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	tx, err := blockchain.NewTransaction(w, string(newWallet(t).Address()), 10, 1, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SendTx(c.Address, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the transaction to be mined", func() bool {
+		height, err := a.chain.GetBestHeight()
+		return err == nil && height == 1
+	})
+	waitForTip(t, a, b, c)
+
+	block, err := c.chain.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 2 || !bytes.Equal(block.Transactions[1].ID, tx.ID) {
+		t.Fatalf("the block has %d transactions, expected the coinbase and %x", len(block.Transactions), tx.ID)
+	}
+	for _, s := range []*Server{a, b, c} {
+		waitFor(t, "node "+s.Address+" to clear its mempool", func() bool {
+			return !s.mempool.Has(tx.ID)
+		})
+	}
+}
+
+func TestOrphanBlockFetchesItsAncestors(t *testing.T) {
+	w := newWallet(t)
+	chain := newChain(t, w)
+
+	a := startNode(t, chain, "")
+	b := startNode(t, emptyChain(t), "", a.Address)
+	waitForTip(t, a, b)
+
+	// b only hears of the last of the blocks a mined meanwhile
+	mineBlocks(t, chain, w, 3)
+	tip, err := chain.GetBlock(chain.GetLastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := GobEncode(Block{a.Address, tip.Serialize()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	command, err := CmdToBytes("block")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := send(b.Address, append(command, payload...)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForTip(t, a, b)
+}
+
+func TestMinerMinesTheTransactionsOfTheNode(t *testing.T) {
+	w, to, miner := newWallet(t), newWallet(t), newWallet(t)
+	chain := newChain(t, w)
+
+	s := NewServer(freeAddress(t), "", chain, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mined := make(chan error, 1)
+	var stats blockchain.MinerStats
+	go func() {
+		var err error
+		stats, err = s.Mine(ctx, string(miner.Address()), 0)
+		mined <- err
+	}()
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	tx, err := blockchain.NewTransaction(w, string(to.Address()), 10, 1, 0, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the node to queue the transaction", func() bool {
+		return SendTx(s.Address, tx) == nil
+	})
+
+	lockingScript, err := wallet.AddressToScript(string(to.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the transaction to be mined", func() bool {
+		outs, err := UTXOSet.FindUTXO(lockingScript)
+		return err == nil && len(outs) == 1
+	})
+
+	cancel()
+	if err := <-mined; err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blocks == 0 {
+		t.Fatal("the miner reports no block")
+	}
+	if s.mempool.Has(tx.ID) {
+		t.Fatal("the mined transaction is still pending")
+	}
+}
+
+func TestInvAddsToTheBlocksInTransit(t *testing.T) {
+	s := NewServer(freeAddress(t), "", emptyChain(t), nil)
+
+	inv := func(hashes ...string) {
+		t.Helper()
+
+		var items [][]byte
+		for _, hash := range hashes {
+			items = append(items, []byte(hash))
+		}
+		payload, err := GobEncode(Inv{"peer", "block", items})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.handleInv(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first block is requested, the others wait for it
+	inv("a", "b", "c")
+	inv("b", "c", "d")
+	var transit []string
+	for _, hash := range s.blocksInTransit {
+		transit = append(transit, string(hash))
+	}
+	if strings.Join(transit, " ") != "c d" {
+		t.Fatalf("the blocks in transit are %v, expected [c d]", transit)
+	}
+}
+
+func TestCmdToBytes(t *testing.T) {
+	command, err := CmdToBytes("getblocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(command) != commandLength || BytesToCmd(command) != "getblocks" {
+		t.Fatalf("the command is encoded as %q", command)
+	}
+
+	if _, err := CmdToBytes("longercommand"); err == nil {
+		t.Fatal("a command longer than 12 bytes was encoded")
+	}
+}
@@ -0,0 +1,181 @@
+// Package client is the Go client of the JSON-RPC server of the rpc package
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-blockchain/rpc"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const defaultTimeout = 2 * time.Minute
+
+// Client calls the methods of a JSON-RPC server. Errors returned by the server are *rpc.Error
+type Client struct {
+	URL      string
+	User     string
+	Password string
+
+	HTTPClient *http.Client
+
+	nextID uint64
+}
+
+// New creates a client of the server at the address (host:port)
+func New(address, user, password string) *Client {
+	return &Client{
+		URL:        fmt.Sprintf("http://%s/", address),
+		User:       user,
+		Password:   password,
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// Call calls the method with the params and decodes its result into result
+func (c *Client) Call(method string, params, result interface{}) error {
+	request := rpc.Request{
+		JSONRPC: rpc.Version,
+		Method:  method,
+		ID:      json.RawMessage(fmt.Sprintf("%d", atomic.AddUint64(&c.nextID, 1))),
+	}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		request.Params = encoded
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	httpRequest, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.SetBasicAuth(c.User, c.Password)
+
+	httpResponse, err := c.HTTPClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	content, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc server returned %s: %s", httpResponse.Status, bytes.TrimSpace(content))
+	}
+
+	var response rpc.Response
+	if err := json.Unmarshal(content, &response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// GetBalance returns the balance of the address
+func (c *Client) GetBalance(address string) (int, error) {
+	var balance int
+	err := c.Call("getbalance", rpc.GetBalanceParams{Address: address}, &balance)
+
+	return balance, err
+}
+
+// GetBlock returns the block with the hex encoded hash
+func (c *Client) GetBlock(hash string) (*rpc.Block, error) {
+	var block rpc.Block
+	if err := c.Call("getblock", rpc.GetBlockParams{Hash: hash}, &block); err != nil {
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+// GetBlockHash returns the hex encoded hash of the block at the height
+func (c *Client) GetBlockHash(height int) (string, error) {
+	var hash string
+	err := c.Call("getblockhash", rpc.GetBlockHashParams{Height: height}, &hash)
+
+	return hash, err
+}
+
+// GetBlockCount returns the height of the last block of the chain
+func (c *Client) GetBlockCount() (int, error) {
+	var count int
+	err := c.Call("getblockcount", nil, &count)
+
+	return count, err
+}
+
+// GetChainTips returns the tips of the main chain and of its side branches
+func (c *Client) GetChainTips() ([]rpc.ChainTip, error) {
+	var tips []rpc.ChainTip
+	err := c.Call("getchaintips", nil, &tips)
+
+	return tips, err
+}
+
+// GetTransaction returns the transaction with the hex encoded ID
+func (c *Client) GetTransaction(txID string) (*rpc.Transaction, error) {
+	var tx rpc.Transaction
+	if err := c.Call("gettransaction", rpc.GetTransactionParams{TxID: txID}, &tx); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// ListAddresses returns the addresses of the wallet file of the server
+func (c *Client) ListAddresses() ([]string, error) {
+	var addresses []string
+	err := c.Call("listaddresses", nil, &addresses)
+
+	return addresses, err
+}
+
+// CreateWallet creates a new address in the wallet file of the server
+func (c *Client) CreateWallet() (*rpc.CreateWalletResult, error) {
+	var result rpc.CreateWalletResult
+	if err := c.Call("createwallet", nil, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// SendToAddress sends the amount from an address of the wallet file of the server, with the fee
+func (c *Client) SendToAddress(from, to string, amount, fee int) (*rpc.SendToAddressResult, error) {
+	return c.send(rpc.SendToAddressParams{From: from, To: to, Amount: amount, Fee: fee})
+}
+
+// SendToAddressWithFeeRate sends the amount like SendToAddress, paying the fee
+// rate per blockchain.FeeRateUnit bytes
+func (c *Client) SendToAddressWithFeeRate(from, to string, amount, feeRate int) (*rpc.SendToAddressResult, error) {
+	return c.send(rpc.SendToAddressParams{From: from, To: to, Amount: amount, FeeRate: feeRate})
+}
+
+func (c *Client) send(params rpc.SendToAddressParams) (*rpc.SendToAddressResult, error) {
+	var result rpc.SendToAddressResult
+	if err := c.Call("sendtoaddress", params, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
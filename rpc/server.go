@@ -0,0 +1,502 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-blockchain/blockchain"
+	"go-blockchain/config"
+	"go-blockchain/errors"
+	"go-blockchain/storage"
+	"go-blockchain/wallet"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxRequestSize bounds the body of a request
+	maxRequestSize = 1 << 20
+	readTimeout    = 10 * time.Second
+)
+
+// Server serves the chain and the wallets of a node over JSON-RPC 2.0 on HTTP.
+// Every request has to carry the credentials of the server with basic auth.
+// Requests are handled one at a time, like the commands of the command line
+type Server struct {
+	Address  string
+	User     string
+	Password string
+
+	chain      *blockchain.BlockChain
+	wallets    *wallet.Wallets
+	walletFile string
+
+	httpServer *http.Server
+	mu         sync.Mutex
+}
+
+type method func(s *Server, params json.RawMessage) (interface{}, error)
+
+var methods = map[string]method{
+	"getbalance":     (*Server).getBalance,
+	"getblock":       (*Server).getBlock,
+	"getblockhash":   (*Server).getBlockHash,
+	"getblockcount":  (*Server).getBlockCount,
+	"getchaintips":   (*Server).getChainTips,
+	"gettransaction": (*Server).getTransaction,
+	"listaddresses":  (*Server).listAddresses,
+	"createwallet":   (*Server).createWallet,
+	"sendtoaddress":  (*Server).sendToAddress,
+}
+
+// NewServer creates a server for the chain and the wallets, saving the new wallets to walletFile
+func NewServer(address, user, password string, chain *blockchain.BlockChain, wallets *wallet.Wallets, walletFile string) *Server {
+	return &Server{
+		Address:    address,
+		User:       user,
+		Password:   password,
+		chain:      chain,
+		wallets:    wallets,
+		walletFile: walletFile,
+	}
+}
+
+// StartServer serves the chain and the wallets of the node on its RPC port until it
+// is interrupted. The blocks mined by sendtoaddress are sealed with engine
+func StartServer(cfg *config.Config, wallets *wallet.Wallets, engine blockchain.Consensus) error {
+	if !storage.Exists(cfg.Backend, cfg.BlocksDir()) {
+		return errors.NewChainNotFoundError()
+	}
+	db, err := storage.Open(cfg.Backend, cfg.BlocksDir())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	chain, err := blockchain.ContinueBlockChain(db)
+	if err != nil {
+		return err
+	}
+	chain.PoW = blockchain.PoWOptions{Workers: cfg.Workers}
+	chain.Consensus = engine
+
+	s := NewServer(fmt.Sprintf("localhost:%s", cfg.RPCPort), cfg.RPCUser, cfg.RPCPassword, chain, wallets, cfg.WalletFile())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		if err := s.Stop(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return s.Start()
+}
+
+// Start serves requests until the server is stopped
+func (s *Server) Start() error {
+	s.mu.Lock()
+	s.httpServer = &http.Server{
+		Addr:        s.Address,
+		Handler:     s,
+		ReadTimeout: readTimeout,
+	}
+	s.mu.Unlock()
+
+	fmt.Printf("Serving JSON-RPC on %s\n", s.Address)
+	err := s.httpServer.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// Stop stops the server, waiting for the requests being handled
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	httpServer := s.httpServer
+	s.mu.Unlock()
+
+	if httpServer == nil {
+		return nil
+	}
+
+	return httpServer.Shutdown(context.Background())
+}
+
+// ServeHTTP handles a single request or a batch of requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		writeJSON(w, Response{JSONRPC: Version, Error: newError(CodeParseError, "%s", err), ID: json.RawMessage("null")})
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		writeJSON(w, Response{JSONRPC: Version, Error: newError(CodeParseError, "invalid JSON"), ID: json.RawMessage("null")})
+		return
+	}
+
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeJSON(w, Response{JSONRPC: Version, Error: newError(CodeParseError, "%s", err), ID: json.RawMessage("null")})
+			return
+		}
+		if len(batch) == 0 {
+			writeJSON(w, Response{JSONRPC: Version, Error: newError(CodeInvalidRequest, "empty batch"), ID: json.RawMessage("null")})
+			return
+		}
+
+		var responses []Response
+		for _, request := range batch {
+			if response := s.handle(request); response != nil {
+				responses = append(responses, *response)
+			}
+		}
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, responses)
+		return
+	}
+
+	response := s.handle(body)
+	if response == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, response)
+}
+
+// authorized checks the basic auth credentials of the request in constant time
+func (s *Server) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	// hashing makes the comparisons independent of the lengths of the credentials
+	userHash, expectedUser := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(s.User))
+	passwordHash, expectedPassword := sha256.Sum256([]byte(password)), sha256.Sum256([]byte(s.Password))
+
+	validUser := subtle.ConstantTimeCompare(userHash[:], expectedUser[:])
+	validPassword := subtle.ConstantTimeCompare(passwordHash[:], expectedPassword[:])
+
+	return validUser&validPassword == 1
+}
+
+// handle runs a request and returns its response, nil for a notification
+func (s *Server) handle(data json.RawMessage) *Response {
+	var request Request
+	if err := json.Unmarshal(data, &request); err != nil {
+		return &Response{JSONRPC: Version, Error: newError(CodeInvalidRequest, "%s", err), ID: json.RawMessage("null")}
+	}
+
+	response := &Response{JSONRPC: Version, ID: request.ID}
+	if response.ID == nil {
+		response.ID = json.RawMessage("null")
+	}
+
+	// invalid requests are answered even without an ID
+	if request.JSONRPC != Version || request.Method == "" {
+		response.Error = newError(CodeInvalidRequest, "not a JSON-RPC %s request", Version)
+		return response
+	}
+
+	result, rpcErr := s.call(request)
+	if request.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		response.Error = rpcErr
+		return response
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		response.Error = newError(CodeInternalError, "%s", err)
+		return response
+	}
+	response.Result = resultJSON
+
+	return response
+}
+
+// call runs the method of the request. A panicking method is turned into an
+// internal error instead of stopping the server
+func (s *Server) call(request Request) (result interface{}, rpcErr *Error) {
+	method, ok := methods[request.Method]
+	if !ok {
+		return nil, newError(CodeMethodNotFound, "method %s not found", request.Method)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Method %s failed: %v", request.Method, r)
+			result, rpcErr = nil, newError(CodeInternalError, "%v", r)
+		}
+	}()
+
+	result, err := method(s, request.Params)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	return result, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write the response: %v", err)
+	}
+}
+
+// decodeParams decodes the params of a method into v
+func decodeParams(params json.RawMessage, v interface{}) *Error {
+	if len(params) == 0 {
+		return newError(CodeInvalidParams, "missing params")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return newError(CodeInvalidParams, "%s", err)
+	}
+
+	return nil
+}
+
+// rpcError converts an error of a method into the error of the response
+func rpcError(err error) *Error {
+	var rpcErr *Error
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, errors.ErrInvalidAddress), errors.Is(err, errors.ErrWrongNetwork):
+		return newError(CodeInvalidAddress, "%s", errors.Plain(err))
+	case errors.Is(err, errors.ErrBlockNotFound), errors.Is(err, errors.ErrTransactionNotFound):
+		return newError(CodeNotFound, "%s", errors.Plain(err))
+	case errors.Is(err, errors.ErrWalletNotFound):
+		return newError(CodeWallet, "%s", errors.Plain(err))
+	case errors.Is(err, errors.ErrInsufficientFunds):
+		return newError(CodeInsufficientFunds, "%s", errors.Plain(err))
+	case errors.Is(err, errors.ErrInvalidAmount):
+		return newError(CodeInvalidParams, "%s", errors.Plain(err))
+	default:
+		return newError(CodeInternalError, "%s", errors.Plain(err))
+	}
+}
+
+// ====================== METHODS ======================
+
+func (s *Server) getBalance(params json.RawMessage) (interface{}, error) {
+	var p GetBalanceParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	lockingScript, err := wallet.AddressToScript(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: s.chain}
+	UTXOs, err := UTXOSet.FindUTXO(lockingScript)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := 0
+	for _, out := range UTXOs {
+		balance += out.Value
+	}
+
+	return balance, nil
+}
+
+func (s *Server) getBlock(params json.RawMessage) (interface{}, error) {
+	var p GetBlockParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	hash, err := hex.DecodeString(p.Hash)
+	if err != nil {
+		return nil, newError(CodeInvalidParams, "%s is not a hex encoded hash", p.Hash)
+	}
+
+	block, err := s.chain.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBlock(block), nil
+}
+
+func (s *Server) getBlockHash(params json.RawMessage) (interface{}, error) {
+	var p GetBlockHashParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	hash, err := s.chain.GetBlockHashByHeight(p.Height)
+	if errors.Is(err, errors.ErrBlockNotFound) {
+		return nil, newError(CodeNotFound, "no block at height %d", p.Height)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+// getBlockCount returns the height of the last block, like bitcoin's getblockcount
+func (s *Server) getBlockCount(params json.RawMessage) (interface{}, error) {
+	return s.chain.GetBestHeight()
+}
+
+func (s *Server) getChainTips(params json.RawMessage) (interface{}, error) {
+	tips, err := s.chain.ChainTips()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []ChainTip{}
+	for _, tip := range tips {
+		result = append(result, NewChainTip(tip))
+	}
+
+	return result, nil
+}
+
+func (s *Server) getTransaction(params json.RawMessage) (interface{}, error) {
+	var p GetTransactionParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	ID, err := hex.DecodeString(p.TxID)
+	if err != nil {
+		return nil, newError(CodeInvalidParams, "%s is not a hex encoded transaction ID", p.TxID)
+	}
+
+	tx, err := s.chain.FindTransaction(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTransaction(&tx), nil
+}
+
+func (s *Server) listAddresses(params json.RawMessage) (interface{}, error) {
+	addresses := s.wallets.GetAllAddresses()
+	if addresses == nil {
+		addresses = []string{}
+	}
+
+	return addresses, nil
+}
+
+func (s *Server) createWallet(params json.RawMessage) (interface{}, error) {
+	var result CreateWalletResult
+
+	if !s.wallets.IsHD() {
+		mnemonic, err := wallet.NewMnemonic()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.wallets.SetMnemonic(mnemonic); err != nil {
+			return nil, err
+		}
+		result.Mnemonic = mnemonic
+	}
+
+	address, err := s.wallets.AddWallet()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.wallets.SaveFile(s.walletFile); err != nil {
+		return nil, err
+	}
+	result.Address = address
+
+	return result, nil
+}
+
+// sendToAddress sends the amount and mines a block with the transaction paying
+// the subsidy and the fee to the sender, like send
+func (s *Server) sendToAddress(params json.RawMessage) (interface{}, error) {
+	var p SendToAddressParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Amount <= 0 {
+		return nil, newError(CodeInvalidParams, "the amount has to be positive")
+	}
+	if p.Fee != 0 && p.FeeRate != 0 {
+		return nil, newError(CodeInvalidParams, "fee and feerate cannot be both given")
+	}
+	if _, err := wallet.AddressToPubKeyHash(p.From); err != nil {
+		return nil, err
+	}
+
+	w, err := s.wallets.GetWallet(p.From)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: s.chain}
+	var tx *blockchain.Transaction
+	if p.FeeRate != 0 {
+		tx, err = blockchain.NewTransactionWithFeeRate(&w, p.To, p.Amount, p.FeeRate, p.LockTime, &UTXOSet)
+	} else {
+		tx, err = blockchain.NewTransaction(&w, p.To, p.Amount, p.Fee, p.LockTime, &UTXOSet)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fee, err := s.chain.TransactionFee(tx)
+	if err != nil {
+		return nil, err
+	}
+	block, err := s.chain.MineTransactions(context.Background(), p.From, []*blockchain.Transaction{tx})
+	if err != nil {
+		return nil, err
+	}
+
+	return SendToAddressResult{
+		TxID:      hex.EncodeToString(tx.ID),
+		Fee:       fee,
+		BlockHash: hex.EncodeToString(block.Hash),
+	}, nil
+}
@@ -0,0 +1,231 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-blockchain/blockchain"
+	"go-blockchain/wallet"
+)
+
+// Version is the JSON-RPC version spoken by the server
+const Version = "2.0"
+
+// Error codes of the JSON-RPC 2.0 specification
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error codes of the methods of the server
+const (
+	// CodeNotFound means the block or the transaction does not exist
+	CodeNotFound = -32001
+	// CodeInvalidAddress means an address is not valid
+	CodeInvalidAddress = -32002
+	// CodeWallet means the wallet file does not have the requested address
+	CodeWallet = -32003
+	// CodeInsufficientFunds means the sender cannot pay the amount
+	CodeInsufficientFunds = -32004
+)
+
+// Request is a JSON-RPC request. Params are passed by name
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// ID is absent for notifications, which get no response
+	ID json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC response, with either a result or an error
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error is the error of a JSON-RPC response
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func newError(code int, template string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(template, args...)}
+}
+
+// ====================== PARAMS ======================
+
+// GetBalanceParams are the params of getbalance
+type GetBalanceParams struct {
+	Address string `json:"address"`
+}
+
+// GetBlockParams are the params of getblock
+type GetBlockParams struct {
+	Hash string `json:"hash"`
+}
+
+// GetBlockHashParams are the params of getblockhash
+type GetBlockHashParams struct {
+	Height int `json:"height"`
+}
+
+// GetTransactionParams are the params of gettransaction
+type GetTransactionParams struct {
+	TxID string `json:"txid"`
+}
+
+// SendToAddressParams are the params of sendtoaddress. The fee is either given
+// or paid at the fee rate, per blockchain.FeeRateUnit bytes. There is no fee by
+// default. The lock time has to be reached by the next block
+type SendToAddressParams struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Amount   int    `json:"amount"`
+	Fee      int    `json:"fee,omitempty"`
+	FeeRate  int    `json:"feerate,omitempty"`
+	LockTime int64  `json:"locktime,omitempty"`
+}
+
+// ====================== RESULTS ======================
+
+// Block is a block as returned by getblock
+type Block struct {
+	Hash         string        `json:"hash"`
+	Version      int32         `json:"version"`
+	PrevHash     string        `json:"prevhash"`
+	MerkleRoot   string        `json:"merkleroot"`
+	Height       int           `json:"height"`
+	Timestamp    int64         `json:"timestamp"`
+	Bits         string        `json:"bits"`
+	Nonce        int           `json:"nonce"`
+	Signer       string        `json:"signer,omitempty"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// Transaction is a transaction as returned by gettransaction
+type Transaction struct {
+	TxID     string   `json:"txid"`
+	Version  int32    `json:"version"`
+	Coinbase bool     `json:"coinbase"`
+	Inputs   []Input  `json:"inputs"`
+	Outputs  []Output `json:"outputs"`
+	LockTime int64    `json:"locktime"`
+}
+
+// Input is an input of a Transaction. Coinbase inputs spend nothing.
+// The unlocking script is disassembled
+type Input struct {
+	TxID      string `json:"txid,omitempty"`
+	Out       int    `json:"out"`
+	ScriptSig string `json:"scriptsig"`
+	Sequence  uint32 `json:"sequence"`
+}
+
+// Output is an output of a Transaction. The locking script is disassembled
+// and the address is only set for outputs locked to an address
+type Output struct {
+	Value        int    `json:"value"`
+	Address      string `json:"address,omitempty"`
+	ScriptPubKey string `json:"scriptpubkey"`
+}
+
+// ChainTip is a tip of the chain as returned by getchaintips
+type ChainTip struct {
+	Height       int    `json:"height"`
+	Hash         string `json:"hash"`
+	ChainWork    string `json:"chainwork"`
+	BranchLength int    `json:"branchlen"`
+	Status       string `json:"status"`
+}
+
+// CreateWalletResult is the result of createwallet. The mnemonic is only
+// returned when the wallet file gets its seed
+type CreateWalletResult struct {
+	Address  string `json:"address"`
+	Mnemonic string `json:"mnemonic,omitempty"`
+}
+
+// SendToAddressResult is the result of sendtoaddress
+type SendToAddressResult struct {
+	TxID      string `json:"txid"`
+	Fee       int    `json:"fee"`
+	BlockHash string `json:"blockhash"`
+}
+
+// NewChainTip converts a tip of the chain. The status is "active" for the
+// tip of the main chain and "valid-fork" for the tips of the side branches
+func NewChainTip(tip blockchain.ChainTip) ChainTip {
+	status := "valid-fork"
+	if tip.Active {
+		status = "active"
+	}
+
+	return ChainTip{
+		Height:       tip.Height,
+		Hash:         hex.EncodeToString(tip.Hash),
+		ChainWork:    fmt.Sprintf("%064x", tip.Work),
+		BranchLength: tip.BranchLength,
+		Status:       status,
+	}
+}
+
+// NewBlock converts a block of the chain
+func NewBlock(block *blockchain.Block) Block {
+	result := Block{
+		Hash:       hex.EncodeToString(block.Hash),
+		Version:    block.Version,
+		PrevHash:   hex.EncodeToString(block.PrevHash),
+		MerkleRoot: hex.EncodeToString(block.MerkleRoot),
+		Height:     block.Height,
+		Timestamp:  block.Timestamp,
+		Bits:       fmt.Sprintf("%08x", block.Bits),
+		Nonce:      block.Nonce,
+		Signer:     hex.EncodeToString(block.Signer),
+	}
+	for _, tx := range block.Transactions {
+		result.Transactions = append(result.Transactions, NewTransaction(tx))
+	}
+
+	return result
+}
+
+// NewTransaction converts a transaction of the chain
+func NewTransaction(tx *blockchain.Transaction) Transaction {
+	result := Transaction{
+		TxID:     hex.EncodeToString(tx.ID),
+		Version:  tx.Version,
+		Coinbase: tx.IsCoinbase(),
+		LockTime: tx.LockTime,
+	}
+	for _, in := range tx.Inputs {
+		result.Inputs = append(result.Inputs, Input{
+			TxID:      hex.EncodeToString(in.ID),
+			Out:       in.Out,
+			ScriptSig: in.ScriptSig.String(),
+			Sequence:  in.Sequence,
+		})
+	}
+	for _, out := range tx.Outputs {
+		output := Output{
+			Value:        out.Value,
+			ScriptPubKey: out.ScriptPubKey.String(),
+		}
+		if address, ok := wallet.ScriptToAddress(out.ScriptPubKey); ok {
+			output.Address = address
+		}
+		result.Outputs = append(result.Outputs, output)
+	}
+
+	return result
+}
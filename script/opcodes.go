@@ -0,0 +1,62 @@
+package script
+
+// The opcodes of the VM. They keep the values of their bitcoin counterparts
+const (
+	Op0         byte = 0x00 // pushes an empty item, which is false
+	OpPushData1 byte = 0x4c // pushes the number of bytes given by the next byte
+	OpPushData2 byte = 0x4d // pushes the number of bytes given by the next 2 bytes, little-endian
+	Op1Negate   byte = 0x4f // pushes -1
+	Op1         byte = 0x51 // Op1 to Op16 push the numbers 1 to 16
+	Op16        byte = 0x60
+
+	OpVerify byte = 0x69 // fails unless the top item is true, which it pops
+	OpReturn byte = 0x6a // fails, it marks outputs that can never be spent
+
+	OpDrop byte = 0x75 // pops the top item
+	OpDup  byte = 0x76 // duplicates the top item
+	OpSwap byte = 0x7c // swaps the two top items
+
+	OpEqual       byte = 0x87 // pops two items and pushes whether they are equal
+	OpEqualVerify byte = 0x88 // OpEqual followed by OpVerify
+
+	OpSHA256  byte = 0xa8 // replaces the top item with its SHA-256 hash
+	OpHash160 byte = 0xa9 // replaces the top item with its RIPEMD-160 hash of its SHA-256 hash
+
+	OpCheckSig            byte = 0xac // pops a public key and a signature and pushes whether the signature is valid
+	OpCheckSigVerify      byte = 0xad // OpCheckSig followed by OpVerify
+	OpCheckMultiSig       byte = 0xae // pops N, N public keys, M and M signatures and pushes whether the M signatures are valid
+	OpCheckMultiSigVerify byte = 0xaf // OpCheckMultiSig followed by OpVerify
+
+	OpCheckLockTimeVerify byte = 0xb1 // fails unless the spending transaction is locked until the top item
+	OpCheckSequenceVerify byte = 0xb2 // fails unless the spent output is older than the top item
+)
+
+// maxDataPush is the highest opcode pushing its own value as number of bytes
+const maxDataPush = 0x4b
+
+var opcodeNames = map[byte]string{
+	Op0:                   "OP_0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpPushData2:           "OP_PUSHDATA2",
+	Op1Negate:             "OP_1NEGATE",
+	OpVerify:              "OP_VERIFY",
+	OpReturn:              "OP_RETURN",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpSwap:                "OP_SWAP",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	OpSHA256:              "OP_SHA256",
+	OpHash160:             "OP_HASH160",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+}
+
+// isSmallInt tells if the opcode pushes a number from 1 to 16
+func isSmallInt(op byte) bool {
+	return op >= Op1 && op <= Op16
+}
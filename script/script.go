@@ -0,0 +1,275 @@
+// Package script implements the scripts locking the outputs of transactions and
+// the small stack machine that runs them.
+//
+// An output is locked by a locking script and spent by an input carrying an
+// unlocking script. To spend the output, the unlocking script, which can only push
+// data, is run first and the locking script is then run on the stack it left. The
+// output is spent if the locking script succeeds and leaves a true item on top of
+// the stack. The opcodes are a small subset of the ones of bitcoin, with the same
+// values and the same meaning
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"go-blockchain/errors"
+	"strings"
+)
+
+// Script is a serialized script: a sequence of opcodes, each data push being
+// followed by its data
+type Script []byte
+
+// instruction is an opcode along with the data it pushes
+type instruction struct {
+	op   byte
+	data []byte
+}
+
+// parse splits the script into its instructions
+func (s Script) parse() ([]instruction, error) {
+	var instructions []instruction
+
+	for i := 0; i < len(s); {
+		op := s[i]
+		i++
+
+		length := 0
+		switch {
+		case op != Op0 && op <= maxDataPush:
+			length = int(op)
+		case op == OpPushData1:
+			if i+1 > len(s) {
+				return nil, errors.NewScriptError("OP_PUSHDATA1 has no length")
+			}
+			length = int(s[i])
+			i++
+		case op == OpPushData2:
+			if i+2 > len(s) {
+				return nil, errors.NewScriptError("OP_PUSHDATA2 has no length")
+			}
+			length = int(binary.LittleEndian.Uint16(s[i:]))
+			i += 2
+		}
+
+		if i+length > len(s) {
+			return nil, errors.NewScriptError("a push of %d bytes goes past the end of the script", length)
+		}
+		instructions = append(instructions, instruction{op: op, data: s[i : i+length]})
+		i += length
+	}
+
+	return instructions, nil
+}
+
+// pushes tells if the instruction only pushes an item
+func (in instruction) pushes() bool {
+	return in.op <= OpPushData2 || in.op == Op1Negate || isSmallInt(in.op)
+}
+
+// IsPushOnly tells if the script only pushes data, which unlocking scripts must do
+func (s Script) IsPushOnly() bool {
+	instructions, err := s.parse()
+	if err != nil {
+		return false
+	}
+
+	for _, in := range instructions {
+		if !in.pushes() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PushedData returns the items pushed by a push only script
+func (s Script) PushedData() ([][]byte, error) {
+	instructions, err := s.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var items [][]byte
+	for _, in := range instructions {
+		if !in.pushes() {
+			return nil, errors.NewScriptError("the script does not only push data")
+		}
+		items = append(items, pushedItem(in))
+	}
+
+	return items, nil
+}
+
+// pushedItem returns the item pushed by a push instruction
+func pushedItem(in instruction) []byte {
+	switch {
+	case in.op == Op1Negate:
+		return encodeNum(-1)
+	case isSmallInt(in.op):
+		return encodeNum(int64(in.op - Op1 + 1))
+	}
+
+	return in.data
+}
+
+// String disassembles the script: data pushes are written in hex and the other
+// opcodes by their bitcoin names. A script that cannot be parsed is written in hex
+func (s Script) String() string {
+	instructions, err := s.parse()
+	if err != nil {
+		return "[invalid] " + hex.EncodeToString(s)
+	}
+
+	var words []string
+	for _, in := range instructions {
+		switch {
+		case in.op == Op0:
+			words = append(words, "0")
+		case in.op == Op1Negate:
+			words = append(words, "-1")
+		case isSmallInt(in.op):
+			words = append(words, fmt.Sprint(in.op-Op1+1))
+		case in.op <= OpPushData2:
+			words = append(words, hex.EncodeToString(in.data))
+		default:
+			name, ok := opcodeNames[in.op]
+			if !ok {
+				name = fmt.Sprintf("OP_UNKNOWN_%02x", in.op)
+			}
+			words = append(words, name)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// ====================== BUILDER ======================
+
+// Builder writes a script instruction by instruction
+type Builder struct {
+	script Script
+}
+
+// NewBuilder returns a builder of an empty script
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp adds an opcode
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+
+	return b
+}
+
+// AddData adds a push of the data with the smallest push instruction
+func (b *Builder) AddData(data []byte) *Builder {
+	switch {
+	case len(data) == 0:
+		b.script = append(b.script, Op0)
+	case len(data) <= maxDataPush:
+		b.script = append(b.script, byte(len(data)))
+	case len(data) <= 0xff:
+		b.script = append(b.script, OpPushData1, byte(len(data)))
+	default:
+		b.script = append(b.script, OpPushData2, 0, 0)
+		binary.LittleEndian.PutUint16(b.script[len(b.script)-2:], uint16(len(data)))
+	}
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+// AddInt adds a push of the number, with a single opcode for the numbers from -1 to 16
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(Op0)
+	case n == -1:
+		return b.AddOp(Op1Negate)
+	case n >= 1 && n <= 16:
+		return b.AddOp(Op1 + byte(n-1))
+	}
+
+	return b.AddData(encodeNum(n))
+}
+
+// Script returns the script written so far
+func (b *Builder) Script() Script {
+	return append(Script{}, b.script...)
+}
+
+// ====================== NUMBERS ======================
+
+// Numbers are stored on the stack like in bitcoin: little-endian, with the sign in
+// the most significant bit of the last byte and without unnecessary bytes. Zero is
+// the empty item
+
+// maxNumSize is the number of bytes of the longest item read as a number, enough for lock times
+const maxNumSize = 5
+
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+
+	var result []byte
+	for n > 0 {
+		result = append(result, byte(n&0xff))
+		n >>= 8
+	}
+
+	// the sign takes a byte of its own if the most significant bit is taken
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+func decodeNum(item []byte) (int64, error) {
+	if len(item) > maxNumSize {
+		return 0, errors.NewScriptError("the number %x is longer than %d bytes", item, maxNumSize)
+	}
+	if len(item) == 0 {
+		return 0, nil
+	}
+
+	var n int64
+	for i, b := range item {
+		n |= int64(b) << uint(8*i)
+	}
+
+	// the sign is removed from the magnitude
+	if item[len(item)-1]&0x80 != 0 {
+		n &= ^(int64(0x80) << uint(8*(len(item)-1)))
+		return -n, nil
+	}
+
+	return n, nil
+}
+
+// asBool tells if the item is true: items are false when all their bytes are zero,
+// the last byte being allowed to be a negative zero (0x80)
+func asBool(item []byte) bool {
+	for i, b := range item {
+		if b != 0 && !(i == len(item)-1 && b == 0x80) {
+			return true
+		}
+	}
+
+	return false
+}
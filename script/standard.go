@@ -0,0 +1,139 @@
+package script
+
+// Standard scripts
+
+// PayToPubKeyHash returns the locking script of the outputs sent to an address:
+//
+//	OP_DUP OP_HASH160 <public key hash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(pubKeyHash []byte) Script {
+	return NewBuilder().
+		AddOp(OpDup).
+		AddOp(OpHash160).
+		AddData(pubKeyHash).
+		AddOp(OpEqualVerify).
+		AddOp(OpCheckSig).
+		Script()
+}
+
+// PayToPubKeyHashUnlock returns the unlocking script spending a PayToPubKeyHash output:
+//
+//	<signature> <public key>
+func PayToPubKeyHashUnlock(signature, pubKey []byte) Script {
+	return NewBuilder().AddData(signature).AddData(pubKey).Script()
+}
+
+// ExtractPubKeyHash returns the public key hash of a PayToPubKeyHash script
+func ExtractPubKeyHash(s Script) ([]byte, bool) {
+	instructions, err := s.parse()
+	if err != nil || len(instructions) != 5 {
+		return nil, false
+	}
+
+	if instructions[0].op != OpDup ||
+		instructions[1].op != OpHash160 ||
+		instructions[2].op > maxDataPush || len(instructions[2].data) != 20 ||
+		instructions[3].op != OpEqualVerify ||
+		instructions[4].op != OpCheckSig {
+		return nil, false
+	}
+
+	return instructions[2].data, true
+}
+
+// PayToScriptHash returns the locking script of the outputs sent to the hash of a
+// redeem script, see Execute:
+//
+//	OP_HASH160 <script hash> OP_EQUAL
+func PayToScriptHash(scriptHash []byte) Script {
+	return NewBuilder().AddOp(OpHash160).AddData(scriptHash).AddOp(OpEqual).Script()
+}
+
+// ExtractScriptHash returns the script hash of a PayToScriptHash script
+func ExtractScriptHash(s Script) ([]byte, bool) {
+	instructions, err := s.parse()
+	if err != nil || len(instructions) != 3 {
+		return nil, false
+	}
+
+	if instructions[0].op != OpHash160 ||
+		instructions[1].op > maxDataPush || len(instructions[1].data) != 20 ||
+		instructions[2].op != OpEqual {
+		return nil, false
+	}
+
+	return instructions[1].data, true
+}
+
+// IsPayToScriptHash tells if the script is a PayToScriptHash script
+func IsPayToScriptHash(s Script) bool {
+	_, ok := ExtractScriptHash(s)
+
+	return ok
+}
+
+// RedeemScript returns the redeem script of an unlocking script spending a
+// PayToScriptHash output, its last pushed item
+func RedeemScript(unlocking Script) (Script, bool) {
+	items, err := unlocking.PushedData()
+	if err != nil || len(items) == 0 {
+		return nil, false
+	}
+
+	return items[len(items)-1], true
+}
+
+// MultiSig returns a script locking an output to m signatures of the public keys:
+//
+//	<m> <public key 1> ... <public key n> <n> OP_CHECKMULTISIG
+func MultiSig(m int, pubKeys [][]byte) Script {
+	b := NewBuilder().AddInt(int64(m))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+
+	return b.AddInt(int64(len(pubKeys))).AddOp(OpCheckMultiSig).Script()
+}
+
+// ExtractMultiSig returns the number of signatures and the public keys of a MultiSig script
+func ExtractMultiSig(s Script) (int, [][]byte, bool) {
+	instructions, err := s.parse()
+	if err != nil || len(instructions) < 4 || instructions[len(instructions)-1].op != OpCheckMultiSig {
+		return 0, nil, false
+	}
+
+	m, n := instructions[0], instructions[len(instructions)-2]
+	if !isSmallInt(m.op) || !isSmallInt(n.op) {
+		return 0, nil, false
+	}
+
+	var pubKeys [][]byte
+	for _, in := range instructions[1 : len(instructions)-2] {
+		if in.op == Op0 || in.op > OpPushData2 {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, in.data)
+	}
+
+	required := int(m.op - Op1 + 1)
+	if len(pubKeys) != int(n.op-Op1+1) || required > len(pubKeys) {
+		return 0, nil, false
+	}
+
+	return required, pubKeys, true
+}
+
+// LockUntil returns the script locking an output with s until the spending
+// transaction is locked until lockTime:
+//
+//	<lock time> OP_CHECKLOCKTIMEVERIFY OP_DROP <s>
+func LockUntil(lockTime int64, s Script) Script {
+	return append(NewBuilder().AddInt(lockTime).AddOp(OpCheckLockTimeVerify).AddOp(OpDrop).Script(), s...)
+}
+
+// LockFor returns the script locking an output with s until it is older than the
+// relative lock time sequence:
+//
+//	<sequence> OP_CHECKSEQUENCEVERIFY OP_DROP <s>
+func LockFor(sequence int64, s Script) Script {
+	return append(NewBuilder().AddInt(sequence).AddOp(OpCheckSequenceVerify).AddOp(OpDrop).Script(), s...)
+}
@@ -0,0 +1,350 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"go-blockchain/errors"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	// MaxScriptSize is the size in bytes of the longest script that can run
+	MaxScriptSize = 10000
+	// MaxStackSize is the number of items the stack can hold
+	MaxStackSize = 1000
+	// MaxMultiSigKeys is the number of public keys an OP_CHECKMULTISIG can check against
+	MaxMultiSigKeys = 20
+)
+
+// Checker checks what a script cannot check by itself because it depends on
+// the transaction spending the output
+type Checker interface {
+	// CheckSig tells if the signature of the spending transaction by the public key is valid
+	CheckSig(signature, pubKey []byte) bool
+	// CheckLockTime tells if the spending transaction is locked until at least lockTime
+	CheckLockTime(lockTime int64) bool
+	// CheckSequence tells if the spent output is older than the relative lock time sequence
+	CheckSequence(sequence int64) bool
+}
+
+// Execute runs the unlocking script and then the locking script on the stack it
+// left. It fails with ErrScript unless the locking script ends with a true item
+// on top of the stack.
+// When the locking script pays to a script hash, the last item pushed by the
+// unlocking script is the redeem script. Once the locking script checked its
+// hash, the redeem script runs on the other items and has to succeed too
+func Execute(unlocking, locking Script, checker Checker) error {
+	if len(unlocking) > MaxScriptSize || len(locking) > MaxScriptSize {
+		return errors.NewScriptError("the script is longer than %d bytes", MaxScriptSize)
+	}
+	if !unlocking.IsPushOnly() {
+		return errors.NewScriptError("the unlocking script does not only push data")
+	}
+
+	vm := &vm{checker: checker}
+	if err := vm.run(unlocking); err != nil {
+		return err
+	}
+
+	var redeemScript Script
+	var redeemStack [][]byte
+	payToScriptHash := IsPayToScriptHash(locking)
+	if payToScriptHash {
+		if len(vm.stack) == 0 {
+			return errors.NewScriptError("the unlocking script has no redeem script")
+		}
+		redeemScript = vm.stack[len(vm.stack)-1]
+		redeemStack = append([][]byte{}, vm.stack[:len(vm.stack)-1]...)
+	}
+
+	if err := vm.run(locking); err != nil {
+		return err
+	}
+	if err := vm.checkResult(); err != nil {
+		return err
+	}
+	if !payToScriptHash {
+		return nil
+	}
+
+	if len(redeemScript) > MaxScriptSize {
+		return errors.NewScriptError("the redeem script is longer than %d bytes", MaxScriptSize)
+	}
+	vm.stack = redeemStack
+	if err := vm.run(redeemScript); err != nil {
+		return err
+	}
+
+	return vm.checkResult()
+}
+
+// vm runs scripts on its stack
+type vm struct {
+	stack   [][]byte
+	checker Checker
+}
+
+// checkResult fails unless the top item is true
+func (vm *vm) checkResult() error {
+	if len(vm.stack) == 0 || !asBool(vm.stack[len(vm.stack)-1]) {
+		return errors.NewScriptError("the script ends without a true item on the stack")
+	}
+
+	return nil
+}
+
+func (vm *vm) push(item []byte) error {
+	if len(vm.stack) >= MaxStackSize {
+		return errors.NewScriptError("the stack has more than %d items", MaxStackSize)
+	}
+	vm.stack = append(vm.stack, item)
+
+	return nil
+}
+
+func (vm *vm) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, errors.NewScriptError("the stack is empty")
+	}
+	item := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+
+	return item, nil
+}
+
+func (vm *vm) peek() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, errors.NewScriptError("the stack is empty")
+	}
+
+	return vm.stack[len(vm.stack)-1], nil
+}
+
+func (vm *vm) popNum() (int64, error) {
+	item, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeNum(item)
+}
+
+func (vm *vm) pushBool(b bool) error {
+	if b {
+		return vm.push([]byte{1})
+	}
+
+	return vm.push(nil)
+}
+
+// verify pops the top item and fails unless it is true
+func (vm *vm) verify(op byte) error {
+	item, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(item) {
+		return errors.NewScriptError("%s failed", opcodeNames[op])
+	}
+
+	return nil
+}
+
+func (vm *vm) run(s Script) error {
+	instructions, err := s.parse()
+	if err != nil {
+		return err
+	}
+
+	for _, in := range instructions {
+		if err := vm.step(in); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (vm *vm) step(in instruction) error {
+	if in.pushes() {
+		return vm.push(pushedItem(in))
+	}
+
+	switch in.op {
+	case OpVerify:
+		return vm.verify(in.op)
+
+	case OpReturn:
+		return errors.NewScriptError("OP_RETURN was reached")
+
+	case OpDrop:
+		_, err := vm.pop()
+		return err
+
+	case OpDup:
+		item, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		return vm.push(item)
+
+	case OpSwap:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.stack = append(vm.stack, a, b)
+		return nil
+
+	case OpEqual, OpEqualVerify:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if err := vm.pushBool(bytes.Equal(a, b)); err != nil {
+			return err
+		}
+		if in.op == OpEqualVerify {
+			return vm.verify(in.op)
+		}
+		return nil
+
+	case OpSHA256:
+		item, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(item)
+		return vm.push(hash[:])
+
+	case OpHash160:
+		item, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		return vm.push(Hash160(item))
+
+	case OpCheckSig, OpCheckSigVerify:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if err := vm.pushBool(vm.checker.CheckSig(signature, pubKey)); err != nil {
+			return err
+		}
+		if in.op == OpCheckSigVerify {
+			return vm.verify(in.op)
+		}
+		return nil
+
+	case OpCheckMultiSig, OpCheckMultiSigVerify:
+		valid, err := vm.checkMultiSig()
+		if err != nil {
+			return err
+		}
+		if err := vm.pushBool(valid); err != nil {
+			return err
+		}
+		if in.op == OpCheckMultiSigVerify {
+			return vm.verify(in.op)
+		}
+		return nil
+
+	case OpCheckLockTimeVerify, OpCheckSequenceVerify:
+		// the lock time is left on the stack, like in bitcoin
+		item, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		lockTime, err := decodeNum(item)
+		if err != nil {
+			return err
+		}
+		if lockTime < 0 {
+			return errors.NewScriptError("%s has a negative lock time", opcodeNames[in.op])
+		}
+
+		check := vm.checker.CheckLockTime
+		if in.op == OpCheckSequenceVerify {
+			check = vm.checker.CheckSequence
+		}
+		if !check(lockTime) {
+			return errors.NewScriptError("%s failed for %d", opcodeNames[in.op], lockTime)
+		}
+		return nil
+	}
+
+	return errors.NewScriptError("unknown opcode %02x", in.op)
+}
+
+// checkMultiSig pops N, the N public keys, M and the M signatures and tells if
+// every signature is valid for one of the public keys. The signatures have to be
+// in the order of their public keys. Unlike in bitcoin, no extra item is popped
+func (vm *vm) checkMultiSig() (bool, error) {
+	n, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > MaxMultiSigKeys {
+		return false, errors.NewScriptError("OP_CHECKMULTISIG has %d public keys", n)
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := vm.popNum()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, errors.NewScriptError("OP_CHECKMULTISIG needs %d signatures of %d public keys", m, n)
+	}
+	signatures := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if signatures[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	// every signature is matched with the next public key it is valid for
+	key := 0
+	for _, signature := range signatures {
+		for key < len(pubKeys) && !vm.checker.CheckSig(signature, pubKeys[key]) {
+			key++
+		}
+		if key == len(pubKeys) {
+			return false, nil
+		}
+		key++
+	}
+
+	return true, nil
+}
+
+// Hash160 returns the RIPEMD-160 hash of the SHA-256 hash of data, the hash of
+// the public keys in addresses
+func Hash160(data []byte) []byte {
+	hash := sha256.Sum256(data)
+
+	hasher := ripemd160.New()
+	// writing to a hash never fails
+	hasher.Write(hash[:])
+
+	return hasher.Sum(nil)
+}
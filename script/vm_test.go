@@ -0,0 +1,225 @@
+package script
+
+import (
+	"bytes"
+	"encoding/hex"
+	"go-blockchain/errors"
+	"testing"
+)
+
+// testChecker accepts the signatures it was given, and the locks up to the lock
+// time of the spending transaction and the age of the spent output
+type testChecker struct {
+	signed   map[string]string // signature -> public key it is valid for
+	lockTime int64
+	age      int64
+}
+
+func (c testChecker) CheckSig(signature, pubKey []byte) bool {
+	key, ok := c.signed[string(signature)]
+	return ok && key == string(pubKey)
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) bool {
+	return lockTime <= c.lockTime
+}
+
+func (c testChecker) CheckSequence(sequence int64) bool {
+	return sequence <= c.age
+}
+
+var (
+	key1, key2, key3 = []byte("public key 1"), []byte("public key 2"), []byte("public key 3")
+	sig1, sig2, sig3 = []byte("signature 1"), []byte("signature 2"), []byte("signature 3")
+
+	checker = testChecker{
+		signed:   map[string]string{string(sig1): string(key1), string(sig2): string(key2), string(sig3): string(key3)},
+		lockTime: 100,
+		age:      10,
+	}
+)
+
+// scriptCase runs unlocking then locking, expecting success or ErrScript
+type scriptCase struct {
+	name      string
+	unlocking Script
+	locking   Script
+	valid     bool
+}
+
+func runCases(t *testing.T, c Checker, cases []scriptCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		err := Execute(tc.unlocking, tc.locking, c)
+		switch {
+		case tc.valid && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case !tc.valid && err == nil:
+			t.Errorf("%s: the script succeeded", tc.name)
+		case !tc.valid && !errors.Is(err, errors.ErrScript):
+			t.Errorf("%s: failed with %v, expected ErrScript", tc.name, err)
+		}
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestStackOpcodes(t *testing.T) {
+	a, b := []byte("a"), []byte("b")
+	long := bytes.Repeat([]byte{7}, 300)
+
+	runCases(t, checker, []scriptCase{
+		{"empty script", nil, nil, false},
+		{"true", nil, NewBuilder().AddInt(1).Script(), true},
+		{"false", nil, NewBuilder().AddInt(0).Script(), false},
+		{"negative zero is false", nil, NewBuilder().AddData([]byte{0, 0x80}).Script(), false},
+		{"dup equal", nil, NewBuilder().AddData(a).AddOp(OpDup).AddOp(OpEqual).Script(), true},
+		{"dup on empty stack", nil, NewBuilder().AddOp(OpDup).Script(), false},
+		{"equal", nil, NewBuilder().AddData(a).AddData(b).AddOp(OpEqual).Script(), false},
+		{"equalverify", nil, NewBuilder().AddData(a).AddData(b).AddOp(OpEqualVerify).AddInt(1).Script(), false},
+		{"swap", nil, NewBuilder().AddData(a).AddData(b).AddOp(OpSwap).
+			AddData(a).AddOp(OpEqualVerify).AddData(b).AddOp(OpEqual).Script(), true},
+		{"swap one item", nil, NewBuilder().AddData(a).AddOp(OpSwap).Script(), false},
+		{"drop", nil, NewBuilder().AddInt(1).AddInt(0).AddOp(OpDrop).Script(), true},
+		{"drop on empty stack", nil, NewBuilder().AddOp(OpDrop).Script(), false},
+		{"verify true", nil, NewBuilder().AddInt(1).AddOp(OpVerify).AddInt(1).Script(), true},
+		{"verify false", nil, NewBuilder().AddInt(0).AddOp(OpVerify).AddInt(1).Script(), false},
+		{"return", nil, NewBuilder().AddInt(1).AddOp(OpReturn).Script(), false},
+		{"unknown opcode", nil, NewBuilder().AddInt(1).AddOp(0xff).Script(), false},
+		{"small ints", nil, NewBuilder().AddOp(Op16).AddData([]byte{16}).AddOp(OpEqualVerify).
+			AddOp(Op1Negate).AddData([]byte{0x81}).AddOp(OpEqual).Script(), true},
+		{"pushdata2", nil, NewBuilder().AddData(long).AddOp(OpDup).AddOp(OpEqual).Script(), true},
+		{"truncated push", nil, Script{0x05, 1, 2}, false},
+		{"truncated pushdata1", nil, Script{OpPushData1}, false},
+		{"unlocking script pushes", NewBuilder().AddData(a).Script(), NewBuilder().AddData(a).AddOp(OpEqual).Script(), true},
+		{"unlocking script runs opcodes", NewBuilder().AddInt(1).AddOp(OpDup).Script(), NewBuilder().AddOp(OpEqual).Script(), false},
+	})
+}
+
+func TestCryptoOpcodes(t *testing.T) {
+	abc := []byte("abc")
+	sha := mustDecodeHex(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+	// the public key of the private key 1 and the hash of its address
+	pubKey := mustDecodeHex(t, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	hash160 := mustDecodeHex(t, "751e76e8199196d454941c45d1b3a323f1433bd6")
+
+	if got := Hash160(pubKey); !bytes.Equal(got, hash160) {
+		t.Fatalf("Hash160 is %x, expected %x", got, hash160)
+	}
+
+	runCases(t, checker, []scriptCase{
+		{"sha256", nil, NewBuilder().AddData(abc).AddOp(OpSHA256).AddData(sha).AddOp(OpEqual).Script(), true},
+		{"sha256 of another item", nil, NewBuilder().AddData(pubKey).AddOp(OpSHA256).AddData(sha).AddOp(OpEqual).Script(), false},
+		{"hash160", nil, NewBuilder().AddData(pubKey).AddOp(OpHash160).AddData(hash160).AddOp(OpEqual).Script(), true},
+		{"hash160 on empty stack", nil, NewBuilder().AddOp(OpHash160).Script(), false},
+		{"checksig", nil, NewBuilder().AddData(sig1).AddData(key1).AddOp(OpCheckSig).Script(), true},
+		{"checksig with another key", nil, NewBuilder().AddData(sig1).AddData(key2).AddOp(OpCheckSig).Script(), false},
+		{"checksigverify", nil, NewBuilder().AddData(sig2).AddData(key2).AddOp(OpCheckSigVerify).AddInt(1).Script(), true},
+		{"checksigverify with another key", nil, NewBuilder().AddData(sig2).AddData(key1).AddOp(OpCheckSigVerify).AddInt(1).Script(), false},
+		{"checksig without signature", nil, NewBuilder().AddData(key1).AddOp(OpCheckSig).Script(), false},
+	})
+}
+
+func TestPayToPubKeyHash(t *testing.T) {
+	locking := PayToPubKeyHash(Hash160(key1))
+	if hash, ok := ExtractPubKeyHash(locking); !ok || !bytes.Equal(hash, Hash160(key1)) {
+		t.Fatalf("extracted %x from %s", hash, locking)
+	}
+
+	runCases(t, checker, []scriptCase{
+		{"signed", PayToPubKeyHashUnlock(sig1, key1), locking, true},
+		{"signed for another key", PayToPubKeyHashUnlock(sig2, key1), locking, false},
+		{"signed by another key", PayToPubKeyHashUnlock(sig2, key2), locking, false},
+		{"without signature", NewBuilder().AddData(key1).Script(), locking, false},
+		{"without anything", nil, locking, false},
+	})
+}
+
+func TestPayToScriptHashMultiSig(t *testing.T) {
+	redeem := MultiSig(2, [][]byte{key1, key2, key3})
+	locking := PayToScriptHash(Hash160(redeem))
+	if m, keys, ok := ExtractMultiSig(redeem); !ok || m != 2 || len(keys) != 3 {
+		t.Fatalf("extracted %d of %d keys from %s", m, len(keys), redeem)
+	}
+
+	unlock := func(redeem Script, signatures ...[]byte) Script {
+		b := NewBuilder()
+		for _, signature := range signatures {
+			b.AddData(signature)
+		}
+		return b.AddData(redeem).Script()
+	}
+
+	runCases(t, checker, []scriptCase{
+		{"signatures 1 and 2", unlock(redeem, sig1, sig2), locking, true},
+		{"signatures 1 and 3", unlock(redeem, sig1, sig3), locking, true},
+		{"signatures 2 and 3", unlock(redeem, sig2, sig3), locking, true},
+		{"signatures out of order", unlock(redeem, sig2, sig1), locking, false},
+		{"the same signature twice", unlock(redeem, sig1, sig1), locking, false},
+		{"too few signatures", unlock(redeem, sig1), locking, false},
+		{"an invalid signature", unlock(redeem, sig1, []byte("forged")), locking, false},
+		{"another redeem script", unlock(MultiSig(1, [][]byte{key1}), sig1), locking, false},
+		{"without redeem script", nil, locking, false},
+		{"bare multisig", NewBuilder().AddData(sig1).AddData(sig3).Script(), redeem, true},
+		{"more signatures than keys", NewBuilder().AddData(sig1).AddData(sig1).Script(),
+			NewBuilder().AddInt(2).AddData(key1).AddInt(1).AddOp(OpCheckMultiSig).Script(), false},
+	})
+}
+
+func TestLocks(t *testing.T) {
+	pay := PayToPubKeyHash(Hash160(key1))
+	unlock := PayToPubKeyHashUnlock(sig1, key1)
+
+	runCases(t, checker, []scriptCase{
+		{"lock time reached", unlock, LockUntil(100, pay), true},
+		{"lock time passed", unlock, LockUntil(99, pay), true},
+		{"lock time not reached", unlock, LockUntil(101, pay), false},
+		{"negative lock time", unlock, LockUntil(-1, pay), false},
+		{"lock time longer than 5 bytes", unlock, LockUntil(1<<40, pay), false},
+		{"lock time without item", nil, NewBuilder().AddOp(OpCheckLockTimeVerify).Script(), false},
+		{"age reached", unlock, LockFor(10, pay), true},
+		{"age not reached", unlock, LockFor(11, pay), false},
+		{"negative age", unlock, LockFor(-1, pay), false},
+		{"locked and signed by another key", PayToPubKeyHashUnlock(sig2, key2), LockUntil(100, pay), false},
+	})
+}
+
+func TestNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		n       int64
+		encoded string
+	}{
+		{0, ""},
+		{1, "01"},
+		{-1, "81"},
+		{127, "7f"},
+		{128, "8000"},
+		{-128, "8080"},
+		{255, "ff00"},
+		{256, "0001"},
+		{500000000, "0065cd1d"},
+		{1 << 31, "0000008000"},
+	} {
+		encoded := encodeNum(tc.n)
+		if hex.EncodeToString(encoded) != tc.encoded {
+			t.Errorf("%d is encoded as %x, expected %s", tc.n, encoded, tc.encoded)
+		}
+		if n, err := decodeNum(encoded); err != nil || n != tc.n {
+			t.Errorf("%x is decoded as %d (%v), expected %d", encoded, n, err, tc.n)
+		}
+	}
+
+	if _, err := decodeNum(make([]byte, maxNumSize+1)); !errors.Is(err, errors.ErrScript) {
+		t.Fatalf("decoding a number of %d bytes returned %v, expected ErrScript", maxNumSize+1, err)
+	}
+}
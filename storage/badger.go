@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"path/filepath"
+
+	"github.com/dgraph-io/badger"
+)
+
+// BadgerStore is a store in a Badger database, a directory of files
+type BadgerStore struct {
+	DB *badger.DB
+}
+
+// OpenBadger opens the Badger database in the directory path, creating it if needed
+func OpenBadger(path string) (*BadgerStore, error) {
+	opts := badger.DefaultOptions(path)
+	opts.Logger = nil
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BadgerStore{DB: db}, nil
+}
+
+// badgerManifest returns the file every Badger database in the directory path has
+func badgerManifest(path string) string {
+	return filepath.Join(path, "MANIFEST")
+}
+
+// View runs fn in a read-only transaction
+func (s *BadgerStore) View(fn func(txn Txn) error) error {
+	return s.DB.View(func(txn *badger.Txn) error {
+		return fn(badgerTxn{txn})
+	})
+}
+
+// Update runs fn in a read-write transaction. Badger limits the size of a
+// transaction, use a batch to write many keys
+func (s *BadgerStore) Update(fn func(txn Txn) error) error {
+	return s.DB.Update(func(txn *badger.Txn) error {
+		return fn(badgerTxn{txn})
+	})
+}
+
+// NewBatch returns a Badger write batch
+func (s *BadgerStore) NewBatch() Batch {
+	return badgerBatch{s.DB.NewWriteBatch()}
+}
+
+// Close closes the database
+func (s *BadgerStore) Close() error {
+	return s.DB.Close()
+}
+
+type badgerBatch struct {
+	*badger.WriteBatch
+}
+
+func (b badgerBatch) Put(key, value []byte) error {
+	return b.Set(key, value)
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+func (t badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+func (t badgerTxn) Put(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (t badgerTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	it := t.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(item.KeyCopy(nil), value); err == ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// boltBucket is the bucket holding every key of a bolt store
+var boltBucket = []byte("chain")
+
+// BoltStore is a store in a bolt database, a single file
+type BoltStore struct {
+	DB *bbolt.DB
+}
+
+// OpenBolt opens the bolt database in the directory path, creating it if needed
+func OpenBolt(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+
+	// bolt waits forever for a database opened by another process without a timeout
+	db, err := bbolt.Open(boltFile(path), 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{DB: db}, nil
+}
+
+// boltFile returns the file of the bolt database in the directory path
+func boltFile(path string) string {
+	return filepath.Join(path, "chain.bolt")
+}
+
+// View runs fn in a read-only transaction
+func (s *BoltStore) View(fn func(txn Txn) error) error {
+	return s.DB.View(func(tx *bbolt.Tx) error {
+		return fn(boltTxn{tx.Bucket(boltBucket)})
+	})
+}
+
+// Update runs fn in a read-write transaction
+func (s *BoltStore) Update(fn func(txn Txn) error) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		return fn(boltTxn{tx.Bucket(boltBucket)})
+	})
+}
+
+// NewBatch returns a batch committing its writes in large transactions
+func (s *BoltStore) NewBatch() Batch {
+	return &updateBatch{store: s}
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.DB.Close()
+}
+
+type boltTxn struct {
+	bucket *bbolt.Bucket
+}
+
+func (t boltTxn) Get(key []byte) ([]byte, error) {
+	// the value of a key set to an empty value may be nil, the key tells it apart
+	k, value := t.bucket.Cursor().Seek(key)
+	if k == nil || !bytes.Equal(k, key) {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+func (t boltTxn) Put(key, value []byte) error {
+	return t.bucket.Put(key, value)
+}
+
+func (t boltTxn) Delete(key []byte) error {
+	return t.bucket.Delete(key)
+}
+
+func (t boltTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	c := t.bucket.Cursor()
+
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		err := fn(append([]byte{}, k...), append([]byte{}, v...))
+		if err == ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"go-blockchain/errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errReadOnly is returned by the writes of the read-only transactions of a memory store
+var errReadOnly = errors.New("the transaction is read-only")
+
+// MemoryStore is a store holding its keys in memory, which are lost once the
+// process exits. It is meant for tests
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemory returns an empty memory store
+func NewMemory() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+// View runs fn in a read-only transaction
+func (s *MemoryStore) View(fn func(txn Txn) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return fn(&memoryTxn{store: s})
+}
+
+// Update runs fn in a read-write transaction, the writes of fn being applied
+// once it returns. Update transactions run one at a time
+func (s *MemoryStore) Update(fn func(txn Txn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txn := &memoryTxn{store: s, writes: make(map[string][]byte)}
+	if err := fn(txn); err != nil {
+		return err
+	}
+
+	for key, value := range txn.writes {
+		if value == nil {
+			delete(s.data, key)
+		} else {
+			s.data[key] = value
+		}
+	}
+
+	return nil
+}
+
+// NewBatch returns a batch committing its writes in large transactions
+func (s *MemoryStore) NewBatch() Batch {
+	return &updateBatch{store: s}
+}
+
+// Close does nothing, the keys stay in memory
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// memoryTxn reads the data of its store through its writes, in which the deleted
+// keys have a nil value. Read-only transactions have no writes
+type memoryTxn struct {
+	store  *MemoryStore
+	writes map[string][]byte
+}
+
+func (t *memoryTxn) Get(key []byte) ([]byte, error) {
+	value, ok := t.writes[string(key)]
+	if !ok {
+		value, ok = t.store.data[string(key)]
+	}
+	if !ok || value == nil {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+func (t *memoryTxn) Put(key, value []byte) error {
+	if t.writes == nil {
+		return errReadOnly
+	}
+	// a copy is never nil, unlike value
+	t.writes[string(key)] = append([]byte{}, value...)
+
+	return nil
+}
+
+func (t *memoryTxn) Delete(key []byte) error {
+	if t.writes == nil {
+		return errReadOnly
+	}
+	t.writes[string(key)] = nil
+
+	return nil
+}
+
+func (t *memoryTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	var keys []string
+	for key := range t.store.data {
+		if _, written := t.writes[key]; !written && strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	for key, value := range t.writes {
+		if value != nil && strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := t.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		if err := fn([]byte(key), value); err == ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package storage holds the key-value stores the chains are kept in. A chain only
+// depends on the Store interface, so that it can be stored by any backend
+package storage
+
+import (
+	"fmt"
+	"go-blockchain/errors"
+	"os"
+	"strings"
+)
+
+// The backends Open can open
+const (
+	Badger = "badger"
+	Bolt   = "bolt"
+)
+
+// Backends are the names of the backends, Badger being the default one
+var Backends = []string{Badger, Bolt}
+
+var (
+	// ErrNotFound is returned by Txn.Get for a key the store does not have
+	ErrNotFound = errors.New("key not found")
+	// ErrStop stops Txn.Iterate without failing it
+	ErrStop = errors.New("stop iteration")
+)
+
+// Store is a sorted key-value store
+type Store interface {
+	// View runs fn in a read-only transaction
+	View(fn func(txn Txn) error) error
+	// Update runs fn in a read-write transaction, which is committed if fn returns
+	// nil and discarded otherwise
+	Update(fn func(txn Txn) error) error
+	// NewBatch returns a batch of writes to the store
+	NewBatch() Batch
+	// Close closes the store
+	Close() error
+}
+
+// Txn is a transaction of a store. It sees its own writes. The keys and values
+// it is given must not be modified until it ends, the ones it returns are copies
+type Txn interface {
+	// Get returns the value of the key, failing with ErrNotFound if there is none
+	Get(key []byte) ([]byte, error)
+	// Put sets the value of the key
+	Put(key, value []byte) error
+	// Delete deletes the key, which may not exist
+	Delete(key []byte) error
+	// Iterate calls fn, in the order of the keys, with every key starting with
+	// prefix and its value, until fn fails. fn must not write to the transaction.
+	// It returns the error of fn, unless it is ErrStop
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+}
+
+// Batch writes many keys to a store. Unlike a transaction its size is not limited,
+// but it is not atomic either: its writes may be partly applied if Flush fails
+type Batch interface {
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// Flush writes what is left of the batch to the store
+	Flush() error
+	// Cancel drops the writes that are not flushed yet
+	Cancel()
+}
+
+// Open opens the store of the backend at path, creating it if needed
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case Badger:
+		return OpenBadger(path)
+	case Bolt:
+		return OpenBolt(path)
+	default:
+		return nil, UnknownBackendError(backend)
+	}
+}
+
+// Exists tells if there is a store of the backend at path
+func Exists(backend, path string) bool {
+	var file string
+	switch backend {
+	case Badger:
+		file = badgerManifest(path)
+	case Bolt:
+		file = boltFile(path)
+	default:
+		return false
+	}
+
+	_, err := os.Stat(file)
+
+	return err == nil
+}
+
+// UnknownBackendError returns the error of a backend that is not one of Backends
+func UnknownBackendError(backend string) error {
+	return fmt.Errorf("unknown storage backend %q, expected one of %s", backend, strings.Join(Backends, ", "))
+}
+
+// Copy writes every key of src to dst and returns the number of keys
+func Copy(dst, src Store) (int, error) {
+	batch := dst.NewBatch()
+	count := 0
+
+	err := src.View(func(txn Txn) error {
+		return txn.Iterate(nil, func(key, value []byte) error {
+			count++
+			return batch.Put(key, value)
+		})
+	})
+	if err != nil {
+		batch.Cancel()
+		return 0, err
+	}
+
+	return count, batch.Flush()
+}
+
+// DeleteByPrefix deletes every key of the store starting with prefix. The keys
+// are deleted in a batch, so they may be partly deleted if it fails
+func DeleteByPrefix(db Store, prefix []byte) error {
+	var keys [][]byte
+	err := db.View(func(txn Txn) error {
+		return txn.Iterate(prefix, func(key, _ []byte) error {
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	batch := db.NewBatch()
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			batch.Cancel()
+			return err
+		}
+	}
+
+	return batch.Flush()
+}
+
+// maxBatchWrites is the number of writes an updateBatch commits in a single transaction
+const maxBatchWrites = 100000
+
+// updateBatch is a Batch committing its writes with the Update transactions of its store
+type updateBatch struct {
+	store  Store
+	writes []write
+}
+
+// write is a Put, or a Delete if deleted is set
+type write struct {
+	key, value []byte
+	deleted    bool
+}
+
+func (b *updateBatch) Put(key, value []byte) error {
+	return b.add(write{key: key, value: value})
+}
+
+func (b *updateBatch) Delete(key []byte) error {
+	return b.add(write{key: key, deleted: true})
+}
+
+func (b *updateBatch) add(w write) error {
+	b.writes = append(b.writes, w)
+	if len(b.writes) < maxBatchWrites {
+		return nil
+	}
+
+	return b.Flush()
+}
+
+func (b *updateBatch) Flush() error {
+	writes := b.writes
+	b.writes = nil
+
+	return b.store.Update(func(txn Txn) error {
+		for _, w := range writes {
+			var err error
+			if w.deleted {
+				err = txn.Delete(w.key)
+			} else {
+				err = txn.Put(w.key, w.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *updateBatch) Cancel() {
+	b.writes = nil
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"fmt"
+	"go-blockchain/errors"
+	"reflect"
+	"testing"
+)
+
+// forEachStore runs test with an empty store of every backend
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	opens := map[string]func(t *testing.T) (Store, error){
+		Badger: func(t *testing.T) (Store, error) { return OpenBadger(t.TempDir()) },
+		Bolt:   func(t *testing.T) (Store, error) { return OpenBolt(t.TempDir()) },
+		"memory": func(t *testing.T) (Store, error) {
+			return NewMemory(), nil
+		},
+	}
+
+	for name, open := range opens {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			s, err := open(t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if err := s.Close(); err != nil {
+					t.Error(err)
+				}
+			})
+
+			test(t, s)
+		})
+	}
+}
+
+// put sets the keys of the store to their values
+func put(t *testing.T, s Store, values map[string]string) {
+	t.Helper()
+
+	err := s.Update(func(txn Txn) error {
+		for key, value := range values {
+			if err := txn.Put([]byte(key), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// contents returns the keys of the store starting with prefix and their values
+// in the order Iterate gives them
+func contents(t *testing.T, s Store, prefix string) []string {
+	t.Helper()
+
+	var pairs []string
+	err := s.View(func(txn Txn) error {
+		return txn.Iterate([]byte(prefix), func(key, value []byte) error {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pairs
+}
+
+// checkContents fails the test if the store does not hold exactly the pairs
+func checkContents(t *testing.T, s Store, want ...string) {
+	t.Helper()
+
+	if got := contents(t, s, ""); !reflect.DeepEqual(got, want) {
+		t.Fatalf("the store holds %q, expected %q", got, want)
+	}
+}
+
+func TestTxnSeesItsOwnWrites(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"a": "1", "b": "2"})
+
+		err := s.Update(func(txn Txn) error {
+			if err := txn.Put([]byte("c"), []byte("3")); err != nil {
+				return err
+			}
+			if err := txn.Delete([]byte("a")); err != nil {
+				return err
+			}
+
+			if _, err := txn.Get([]byte("a")); err != ErrNotFound {
+				return fmt.Errorf("getting the deleted key returned %v", err)
+			}
+			if value, err := txn.Get([]byte("c")); err != nil || string(value) != "3" {
+				return fmt.Errorf("getting the written key returned %q, %v", value, err)
+			}
+
+			var keys string
+			err := txn.Iterate(nil, func(key, _ []byte) error {
+				keys += string(key)
+				return nil
+			})
+			if err == nil && keys != "bc" {
+				err = fmt.Errorf("the transaction iterates over %q, expected \"bc\"", keys)
+			}
+
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkContents(t, s, "b=2", "c=3")
+	})
+}
+
+func TestFailedUpdateIsDiscarded(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"a": "1"})
+
+		failure := errors.New("failure")
+		err := s.Update(func(txn Txn) error {
+			if err := txn.Put([]byte("b"), []byte("2")); err != nil {
+				return err
+			}
+			if err := txn.Delete([]byte("a")); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Fatalf("the update returned %v instead of the error of its function", err)
+		}
+
+		checkContents(t, s, "a=1")
+	})
+}
+
+func TestViewCannotWrite(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		err := s.View(func(txn Txn) error {
+			return txn.Put([]byte("a"), []byte("1"))
+		})
+		if err == nil {
+			t.Fatal("a read-only transaction wrote a key")
+		}
+
+		checkContents(t, s)
+	})
+}
+
+func TestEmptyValues(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"a": ""})
+
+		err := s.View(func(txn Txn) error {
+			value, err := txn.Get([]byte("a"))
+			if err != nil {
+				return err
+			}
+			if len(value) != 0 {
+				return fmt.Errorf("the empty value is read as %q", value)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkContents(t, s, "a=")
+	})
+}
+
+func TestIterateByPrefixInOrder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"b-2": "x", "a": "y", "b-10": "z", "b": "w", "c-1": "v"})
+
+		if got, want := contents(t, s, "b-"), []string{"b-10=z", "b-2=x"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("the prefix iterates over %q, expected %q", got, want)
+		}
+		checkContents(t, s, "a=y", "b=w", "b-10=z", "b-2=x", "c-1=v")
+		if got := contents(t, s, "d"); len(got) != 0 {
+			t.Fatalf("a missing prefix iterates over %q", got)
+		}
+
+		// the keys and values outlive their call
+		var keys, values [][]byte
+		err := s.View(func(txn Txn) error {
+			return txn.Iterate([]byte("b"), func(key, value []byte) error {
+				keys, values = append(keys, key), append(values, value)
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%s %s", keys, values) != "[b b-10 b-2] [w z x]" {
+			t.Fatalf("the kept keys are %q and the values %q", keys, values)
+		}
+	})
+}
+
+func TestIterateStops(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"a": "1", "b": "2", "c": "3"})
+
+		failure := errors.New("failure")
+		for stop, want := range map[error]error{ErrStop: nil, failure: failure} {
+			var keys string
+			err := s.View(func(txn Txn) error {
+				return txn.Iterate(nil, func(key, _ []byte) error {
+					keys += string(key)
+					if string(key) == "b" {
+						return stop
+					}
+					return nil
+				})
+			})
+			if err != want {
+				t.Fatalf("stopping with %v returned %v, expected %v", stop, err, want)
+			}
+			if keys != "ab" {
+				t.Fatalf("stopping with %v iterated over %q, expected \"ab\"", stop, keys)
+			}
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"a": "1", "b": "2"})
+
+		batch := s.NewBatch()
+		for _, key := range []string{"c", "d", "e"} {
+			if err := batch.Put([]byte(key), []byte(key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := batch.Delete([]byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		checkContents(t, s, "b=2", "c=c", "d=d", "e=e")
+
+		batch = s.NewBatch()
+		if err := batch.Put([]byte("f"), []byte("6")); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Delete([]byte("b")); err != nil {
+			t.Fatal(err)
+		}
+		batch.Cancel()
+		checkContents(t, s, "b=2", "c=c", "d=d", "e=e")
+	})
+}
+
+func TestDeleteByPrefix(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"u-1": "1", "u-2": "2", "u": "3", "v-1": "4"})
+
+		if err := DeleteByPrefix(s, []byte("u-")); err != nil {
+			t.Fatal(err)
+		}
+		checkContents(t, s, "u=3", "v-1=4")
+
+		if err := DeleteByPrefix(s, []byte("w-")); err != nil {
+			t.Fatal(err)
+		}
+		checkContents(t, s, "u=3", "v-1=4")
+	})
+}
+
+func TestCopy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		put(t, s, map[string]string{"a": "1", "b": "", "c-1": "3"})
+
+		dst := NewMemory()
+		put(t, dst, map[string]string{"a": "old", "z": "26"})
+
+		count, err := Copy(dst, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Fatalf("copied %d keys, expected 3", count)
+		}
+		checkContents(t, dst, "a=1", "b=", "c-1=3", "z=26")
+	})
+}
@@ -0,0 +1,113 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"go-blockchain/errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted wallet files start with encryptedMagic followed by the salt used to
+// derive the key from the passphrase, the nonce and the AES-GCM sealed wallets:
+//
+//	magic (8 bytes) | salt (16 bytes) | nonce (12 bytes) | ciphertext
+//
+// The key is derived with scrypt so that guessing passphrases is expensive
+var encryptedMagic = []byte("GBWALLT1")
+
+const (
+	saltLength = 16
+	keyLength  = 32 // AES-256
+
+	// scrypt cost parameters
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// isEncrypted checks if the content of a wallet file is encrypted
+func isEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, encryptedMagic)
+}
+
+// deriveKey derives the AES key from the passphrase and the salt
+func deriveKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, keyLength)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals plaintext with a key derived from the passphrase and a fresh salt
+func encrypt(plaintext, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	content := append(append([]byte{}, encryptedMagic...), salt...)
+	content = append(content, nonce...)
+	// the header is authenticated too, so it cannot be tampered with
+	return gcm.Seal(content, nonce, plaintext, content), nil
+}
+
+// decrypt opens content sealed by encrypt
+func decrypt(content, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.NewPassphraseRequiredError()
+	}
+
+	headerLength := len(encryptedMagic) + saltLength
+	if len(content) < headerLength {
+		return nil, errors.NewWrongPassphraseError()
+	}
+	salt := content[len(encryptedMagic):headerLength]
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) < headerLength+gcm.NonceSize() {
+		return nil, errors.NewWrongPassphraseError()
+	}
+	header := content[:headerLength+gcm.NonceSize()]
+	nonce := content[headerLength:len(header)]
+
+	plaintext, err := gcm.Open(nil, nonce, content[len(header):], header)
+	if err != nil {
+		// GCM cannot tell a wrong key from a corrupted file
+		return nil, errors.NewWrongPassphraseError()
+	}
+
+	return plaintext, nil
+}
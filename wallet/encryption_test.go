@@ -0,0 +1,120 @@
+package wallet
+
+import (
+	"bytes"
+	"go-blockchain/errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	plaintext := []byte("the wallets")
+	passphrase := []byte("correct horse battery staple")
+
+	content, err := encrypt(plaintext, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(content) || bytes.Contains(content, plaintext) {
+		t.Fatalf("the content %x is not encrypted", content)
+	}
+
+	decrypted, err := decrypt(content, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("decrypted %q, expected %q", decrypted, plaintext)
+	}
+
+	// a fresh salt and nonce each time
+	again, err := encrypt(plaintext, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, content) {
+		t.Fatal("the same plaintext was encrypted twice to the same content")
+	}
+}
+
+func TestDecryptWithWrongPassphrase(t *testing.T) {
+	content, err := encrypt([]byte("the wallets"), []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decrypt(content, []byte("another passphrase")); !errors.Is(err, errors.ErrWrongPassphrase) {
+		t.Fatalf("decrypting with a wrong passphrase returned %v, expected ErrWrongPassphrase", err)
+	}
+	if _, err := decrypt(content, nil); !errors.Is(err, errors.ErrPassphraseRequired) {
+		t.Fatalf("decrypting without passphrase returned %v, expected ErrPassphraseRequired", err)
+	}
+
+	// the header is authenticated
+	tampered := append([]byte{}, content...)
+	tampered[len(encryptedMagic)] ^= 1
+	if _, err := decrypt(tampered, []byte("passphrase")); !errors.Is(err, errors.ErrWrongPassphrase) {
+		t.Fatalf("decrypting a tampered file returned %v, expected ErrWrongPassphrase", err)
+	}
+	if _, err := decrypt(content[:len(encryptedMagic)+4], []byte("passphrase")); !errors.Is(err, errors.ErrWrongPassphrase) {
+		t.Fatalf("decrypting a truncated file returned %v, expected ErrWrongPassphrase", err)
+	}
+}
+
+func TestSaveFileEncrypted(t *testing.T) {
+	walletFile := filepath.Join(t.TempDir(), "wallets", "wallet.data")
+	passphrase := []byte("passphrase")
+
+	wallets := &Wallets{Wallets: make(map[string]*Wallet)}
+	wallets.SetPassphrase(passphrase)
+	if err := wallets.SetMnemonic(testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.SaveFile(walletFile); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("the wallet file has the mode %o, expected 600", mode)
+	}
+	if !IsEncrypted(walletFile) {
+		t.Fatal("the wallet file is not encrypted")
+	}
+
+	if _, err := CreateWallets(walletFile, []byte("another passphrase")); !errors.Is(err, errors.ErrWrongPassphrase) {
+		t.Fatalf("loading with a wrong passphrase returned %v, expected ErrWrongPassphrase", err)
+	}
+	if _, err := CreateWallets(walletFile, nil); !errors.Is(err, errors.ErrPassphraseRequired) {
+		t.Fatalf("loading without passphrase returned %v, expected ErrPassphraseRequired", err)
+	}
+
+	loaded, err := CreateWallets(walletFile, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.GetAllAddresses(), []string{address}) || !bytes.Equal(loaded.Seed, wallets.Seed) || loaded.NextIndex != 1 {
+		t.Fatalf("loaded the addresses %v, expected %s", loaded.GetAllAddresses(), address)
+	}
+
+	// without passphrase, the file is saved in the clear
+	loaded.SetPassphrase(nil)
+	if err := loaded.SaveFile(walletFile); err != nil {
+		t.Fatal(err)
+	}
+	if IsEncrypted(walletFile) {
+		t.Fatal("the wallet file saved without passphrase is encrypted")
+	}
+	if _, err := CreateWallets(walletFile, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,162 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"go-blockchain/errors"
+	"math/big"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Hierarchical deterministic wallets
+
+// Every key of an HD wallet is derived from a single seed, so backing up the
+// seed backs up every address the wallet will ever create. The seed comes from
+// a BIP39 mnemonic (the recovery phrase) and the keys are derived with SLIP-10,
+// the variant of BIP32 for the P256 curve used by the wallets. Receiving keys
+// follow the BIP44 path m/44'/CoinType'/0'/0/index
+
+const (
+	// hardened is added to an index to derive a hardened child key
+	hardened = 0x80000000
+
+	purpose = 44
+	// CoinType is the BIP44 coin type of the chain. It has no registered
+	// coin type, so it uses the one of test networks
+	CoinType = 1
+
+	// mnemonicEntropy is the number of bits of entropy of new mnemonics (12 words)
+	mnemonicEntropy = 128
+
+	// GapLimit is the number of unused addresses in a row after which Restore stops looking
+	GapLimit = 20
+)
+
+// the HMAC key of the master key in SLIP-10 for the P256 curve
+var masterKeySeed = []byte("Nist256p1 seed")
+
+// extendedKey is a private key with the chain code deriving its children
+type extendedKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+// NewMnemonic generates a new random recovery phrase
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropy)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// MnemonicToSeed checks the recovery phrase and returns the seed of its wallets
+func MnemonicToSeed(mnemonic string) ([]byte, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, errors.NewInvalidMnemonicError()
+	}
+
+	return bip39.NewSeed(mnemonic, ""), nil
+}
+
+// newMasterKey derives the master key of the seed
+func newMasterKey(seed []byte) *extendedKey {
+	data := seed
+	for {
+		il, ir := hmacSHA512(masterKeySeed, data)
+		if validPrivateKey(il) {
+			return &extendedKey{key: il, chainCode: ir}
+		}
+		// invalid keys are so unlikely that SLIP-10 simply hashes again
+		data = append(append([]byte{}, il...), ir...)
+	}
+}
+
+// child derives the child key at the index, hardened if index >= hardened
+func (k *extendedKey) child(index uint32) *extendedKey {
+	curve := elliptic.P256()
+	n := curve.Params().N
+
+	var data []byte
+	if index >= hardened {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		x, y := curve.ScalarBaseMult(k.key)
+		data = elliptic.MarshalCompressed(curve, x, y)
+	}
+	data = append(data, indexBytes(index)...)
+
+	for {
+		il, ir := hmacSHA512(k.chainCode, data)
+
+		childKey := new(big.Int).SetBytes(il)
+		if childKey.Cmp(n) < 0 {
+			childKey.Add(childKey, new(big.Int).SetBytes(k.key))
+			childKey.Mod(childKey, n)
+			if childKey.Sign() != 0 {
+				return &extendedKey{key: childKey.FillBytes(make([]byte, 32)), chainCode: ir}
+			}
+		}
+
+		data = append(append([]byte{0x01}, ir...), indexBytes(index)...)
+	}
+}
+
+// derivePath derives the key at the path from the master key
+func (k *extendedKey) derivePath(path ...uint32) *extendedKey {
+	key := k
+	for _, index := range path {
+		key = key.child(index)
+	}
+
+	return key
+}
+
+// wallet returns the wallet of the key
+func (k *extendedKey) wallet() *Wallet {
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(k.key)
+
+	private := ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		D:         new(big.Int).SetBytes(k.key),
+	}
+	public := append(x.FillBytes(make([]byte, 32)), y.FillBytes(make([]byte, 32))...)
+
+	return &Wallet{PrivateKey: private, PublicKey: public}
+}
+
+// DeriveWallet derives the receiving wallet at the index from the seed
+func DeriveWallet(seed []byte, index uint32) *Wallet {
+	master := newMasterKey(seed)
+	key := master.derivePath(purpose+hardened, CoinType+hardened, 0+hardened, 0, index)
+
+	return key.wallet()
+}
+
+// validPrivateKey checks that the key is in [1, n-1]
+func validPrivateKey(key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+
+	return k.Sign() > 0 && k.Cmp(elliptic.P256().Params().N) < 0
+}
+
+func hmacSHA512(key, data []byte) ([]byte, []byte) {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	return sum[:32], sum[32:]
+}
+
+func indexBytes(index uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, index)
+
+	return b
+}
@@ -0,0 +1,181 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"go-blockchain/errors"
+	"reflect"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestMnemonicToSeed(t *testing.T) {
+	seed, err := MnemonicToSeed(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc1" +
+		"9a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+	if hex.EncodeToString(seed) != want {
+		t.Fatalf("the seed is %x, expected %s", seed, want)
+	}
+
+	// the last word carries the checksum
+	for _, mnemonic := range []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon",
+		"not a recovery phrase",
+	} {
+		if _, err := MnemonicToSeed(mnemonic); !errors.Is(err, errors.ErrInvalidMnemonic) {
+			t.Errorf("%q returned %v, expected ErrInvalidMnemonic", mnemonic, err)
+		}
+	}
+
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MnemonicToSeed(mnemonic); err != nil {
+		t.Fatalf("the new mnemonic %q is not valid: %v", mnemonic, err)
+	}
+}
+
+// TestSLIP10 derives the keys of the test vector 1 of SLIP-10 for nist256p1
+func TestSLIP10(t *testing.T) {
+	master := newMasterKey(mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f"))
+
+	for _, tc := range []struct {
+		path      []uint32
+		chainCode string
+		key       string
+	}{
+		{nil,
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{[]uint32{0 + hardened},
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{[]uint32{0 + hardened, 1},
+			"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+		{[]uint32{0 + hardened, 1, 2 + hardened},
+			"98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318",
+			"694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7"},
+		{[]uint32{0 + hardened, 1, 2 + hardened, 2},
+			"ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0",
+			"5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa"},
+		{[]uint32{0 + hardened, 1, 2 + hardened, 2, 1000000000},
+			"b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059",
+			"21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119"},
+	} {
+		key := master.derivePath(tc.path...)
+		if hex.EncodeToString(key.chainCode) != tc.chainCode || hex.EncodeToString(key.key) != tc.key {
+			t.Errorf("the key at %v is %x with chain code %x, expected %s with chain code %s",
+				tc.path, key.key, key.chainCode, tc.key, tc.chainCode)
+		}
+	}
+}
+
+func TestAddWalletDerivesDeterministically(t *testing.T) {
+	derive := func() []string {
+		wallets := &Wallets{Wallets: make(map[string]*Wallet)}
+		if err := wallets.SetMnemonic(testMnemonic); err != nil {
+			t.Fatal(err)
+		}
+
+		var addresses []string
+		for i := 0; i < 3; i++ {
+			address, err := wallets.AddWallet()
+			if err != nil {
+				t.Fatal(err)
+			}
+			addresses = append(addresses, address)
+		}
+		if wallets.NextIndex != 3 {
+			t.Fatalf("the next index is %d after 3 wallets", wallets.NextIndex)
+		}
+
+		return addresses
+	}
+
+	first, second := derive(), derive()
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("the same recovery phrase derived %v then %v", first, second)
+	}
+
+	seed, err := MnemonicToSeed(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, address := range first {
+		if derived := string(DeriveWallet(seed, uint32(i)).Address()); derived != address {
+			t.Fatalf("wallet %d has the address %s, expected %s", i, address, derived)
+		}
+	}
+	if first[0] == first[1] || first[1] == first[2] {
+		t.Fatalf("the derived addresses repeat: %v", first)
+	}
+}
+
+func TestRestoreStopsAfterGapLimit(t *testing.T) {
+	seed, err := MnemonicToSeed(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addressAt := func(index uint32) string {
+		return string(DeriveWallet(seed, index).Address())
+	}
+
+	for _, tc := range []struct {
+		name     string
+		used     []uint32
+		restored uint32 // the number of wallets restored, from index 0
+		checked  uint32 // the number of wallets looked up
+	}{
+		{"no used wallet", nil, 1, GapLimit},
+		{"first wallet used", []uint32{0}, 1, 1 + GapLimit},
+		{"gap under the limit", []uint32{3, 3 + GapLimit}, 4 + GapLimit, 4 + 2*GapLimit},
+		{"gap of the limit", []uint32{3, 4 + GapLimit}, 4, 4 + GapLimit},
+	} {
+		used := make(map[string]bool)
+		for _, index := range tc.used {
+			used[hex.EncodeToString(PublicKeyHash(DeriveWallet(seed, index).PublicKey))] = true
+		}
+		var checked uint32
+		isUsed := func(pubKeyHash []byte) bool {
+			checked++
+			return used[hex.EncodeToString(pubKeyHash)]
+		}
+
+		wallets := &Wallets{Wallets: make(map[string]*Wallet)}
+		addresses, err := wallets.Restore(testMnemonic, isUsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want []string
+		for index := uint32(0); index < tc.restored; index++ {
+			want = append(want, addressAt(index))
+		}
+		if !reflect.DeepEqual(addresses, want) {
+			t.Errorf("%s: restored %d wallets, expected %d", tc.name, len(addresses), tc.restored)
+		}
+		if wallets.NextIndex != tc.restored || len(wallets.Wallets) != int(tc.restored) {
+			t.Errorf("%s: the next index is %d with %d wallets, expected %d", tc.name, wallets.NextIndex, len(wallets.Wallets), tc.restored)
+		}
+		if checked != tc.checked {
+			t.Errorf("%s: looked up %d wallets, expected %d", tc.name, checked, tc.checked)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"fmt"
+	"go-blockchain/errors"
+	"go-blockchain/script"
+	"math/big"
+	"sort"
+)
+
+// MaxMultiSigKeys is the number of public keys of the biggest multisig address.
+// The number of keys and of signatures are each pushed by a single opcode
+const MaxMultiSigKeys = 16
+
+// NewMultiSig returns the redeem script of the multisig address requiring
+// required signatures of the public keys, and the address. The order of the
+// keys matters: the same keys in another order make another address.
+// It fails with ErrInvalidMultiSig if the keys cannot make a multisig address
+func NewMultiSig(required int, pubKeys [][]byte) (script.Script, string, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxMultiSigKeys {
+		return nil, "", errors.NewInvalidMultiSigError("a multisig address has from 1 to %d public keys, not %d", MaxMultiSigKeys, len(pubKeys))
+	}
+	if required < 1 || required > len(pubKeys) {
+		return nil, "", errors.NewInvalidMultiSigError("%d signatures of %d public keys cannot be required", required, len(pubKeys))
+	}
+
+	for i, pubKey := range pubKeys {
+		if !isPublicKey(pubKey) {
+			return nil, "", errors.NewInvalidMultiSigError("%x is not a public key", pubKey)
+		}
+		for _, other := range pubKeys[:i] {
+			if bytes.Equal(pubKey, other) {
+				return nil, "", errors.NewInvalidMultiSigError("the public key %x is given twice", pubKey)
+			}
+		}
+	}
+
+	redeemScript := script.MultiSig(required, pubKeys)
+
+	return redeemScript, MultiSigAddress(redeemScript), nil
+}
+
+// MultiSigAddress returns the address paying to the redeem script
+func MultiSigAddress(redeemScript script.Script) string {
+	return string(ScriptHashToAddress(script.Hash160(redeemScript)))
+}
+
+// isPublicKey checks that the key is a point of the curve of the wallets, X followed by Y
+func isPublicKey(pubKey []byte) bool {
+	if len(pubKey) != 64 {
+		return false
+	}
+	x := new(big.Int).SetBytes(pubKey[:32])
+	y := new(big.Int).SetBytes(pubKey[32:])
+
+	return elliptic.P256().IsOnCurve(x, y)
+}
+
+// AddMultiSig adds the multisig address requiring required signatures of the
+// public keys to the wallets and returns it, see NewMultiSig.
+// The wallets keep its redeem script to spend its outputs
+func (ws *Wallets) AddMultiSig(required int, pubKeys [][]byte) (string, error) {
+	redeemScript, address, err := NewMultiSig(required, pubKeys)
+	if err != nil {
+		return "", err
+	}
+
+	if ws.MultiSigs == nil {
+		ws.MultiSigs = make(map[string]script.Script)
+	}
+	ws.MultiSigs[address] = redeemScript
+
+	return address, nil
+}
+
+// GetMultiSig returns the redeem script of the multisig address.
+// It fails with ErrWalletNotFound if the wallets do not have the address
+func (ws Wallets) GetMultiSig(address string) (script.Script, error) {
+	redeemScript, ok := ws.MultiSigs[address]
+	if !ok {
+		return nil, errors.NewWalletNotFoundError(address)
+	}
+
+	return redeemScript, nil
+}
+
+// GetMultiSigAddresses returns the multisig addresses of the wallets, sorted
+func (ws *Wallets) GetMultiSigAddresses() []string {
+	var addresses []string
+	for address := range ws.MultiSigs {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// DescribeMultiSig describes the multisig address of the redeem script, e.g. "2 of 3"
+func DescribeMultiSig(redeemScript script.Script) string {
+	required, pubKeys, ok := script.ExtractMultiSig(redeemScript)
+	if !ok {
+		return "not a multisig"
+	}
+
+	return fmt.Sprintf("%d of %d", required, len(pubKeys))
+}
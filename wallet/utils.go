@@ -1,8 +1,6 @@
 package wallet
 
 import (
-	"go-blockchain/errors"
-
 	"github.com/mr-tron/base58"
 )
 
@@ -15,9 +13,6 @@ func Base58Encode(input []byte) []byte {
 }
 
 // Base58Decode decodes the input
-func Base58Decode(input []byte) []byte {
-	decode, err := base58.Decode(string(input))
-	errors.HandleErr(err)
-
-	return decode
+func Base58Decode(input []byte) ([]byte, error) {
+	return base58.Decode(string(input))
 }
@@ -6,7 +6,11 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
+	"go-blockchain/config"
 	"go-blockchain/errors"
+	"go-blockchain/script"
+	"math/big"
 
 	"golang.org/x/crypto/ripemd160"
 )
@@ -14,7 +18,6 @@ import (
 const (
 	//ChecksumLength is the length of the checksum
 	ChecksumLength = 4
-	version        = byte(0x00)
 )
 
 // Wallet is a wallet
@@ -23,49 +26,171 @@ type Wallet struct {
 	PublicKey  []byte
 }
 
-// ValidateAddress compares the actual checksum to the expected checksum to validate the address
+// walletData is what is stored of a wallet, the private key being its scalar.
+// ecdsa.PrivateKey cannot be gob encoded directly because of its curve
+type walletData struct {
+	D         []byte
+	PublicKey []byte
+}
+
+// GobEncode encodes the wallet for the wallet file
+func (w Wallet) GobEncode() ([]byte, error) {
+	var content bytes.Buffer
+
+	data := walletData{D: w.PrivateKey.D.Bytes(), PublicKey: w.PublicKey}
+	err := gob.NewEncoder(&content).Encode(data)
+
+	return content.Bytes(), err
+}
+
+// GobDecode decodes a wallet encoded by GobEncode, rebuilding its key pair on the P256 curve
+func (w *Wallet) GobDecode(content []byte) error {
+	var data walletData
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		return err
+	}
+
+	curve := elliptic.P256()
+	x, y := curve.ScalarBaseMult(data.D)
+	w.PrivateKey = ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		D:         new(big.Int).SetBytes(data.D),
+	}
+	w.PublicKey = data.PublicKey
+
+	return nil
+}
+
+// ValidateAddress compares the actual checksum to the expected checksum to validate the address.
+// Addresses of other networks are not valid
 func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-ChecksumLength:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-ChecksumLength]
-	expectedChecksum := Checksum(append([]byte{version}, pubKeyHash...))
-	return bytes.Compare(actualChecksum, expectedChecksum) == 0
+	return CheckAddress(address) == nil
+}
+
+// CheckAddress checks the address, which can pay to a key or to a script. It fails
+// with ErrInvalidAddress if its checksum is wrong and with ErrWrongNetwork if it
+// is an address of another network
+func CheckAddress(address string) error {
+	_, _, err := decodeAddress(address)
+
+	return err
+}
+
+// decodeAddress returns the version byte and the hash of the address.
+// It fails like CheckAddress if the address is not valid
+func decodeAddress(address string) (byte, []byte, error) {
+	decoded, err := Base58Decode([]byte(address))
+	if err != nil || len(decoded) <= 1+ChecksumLength {
+		return 0, nil, errors.NewInvalidAddressError(address)
+	}
+
+	actualChecksum := decoded[len(decoded)-ChecksumLength:]
+	expectedChecksum := Checksum(decoded[:len(decoded)-ChecksumLength])
+	if !bytes.Equal(actualChecksum, expectedChecksum) {
+		return 0, nil, errors.NewInvalidAddressError(address)
+	}
+
+	version := decoded[0]
+	if version != config.Params().AddressVersion && version != config.Params().ScriptAddressVersion {
+		return 0, nil, errors.NewWrongNetworkAddressError(address, config.Params().Name)
+	}
+
+	return version, decoded[1 : len(decoded)-ChecksumLength], nil
+}
+
+// AddressToPubKeyHash returns the public key hash of the address.
+// It fails like CheckAddress if the address is not valid and with
+// ErrInvalidAddress if it is the address of a script
+func AddressToPubKeyHash(address string) ([]byte, error) {
+	version, hash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if version != config.Params().AddressVersion {
+		return nil, errors.NewScriptAddressError(address)
+	}
+
+	return hash, nil
+}
+
+// AddressToScript returns the locking script of the outputs sent to the address.
+// It fails like CheckAddress if the address is not valid
+func AddressToScript(address string) (script.Script, error) {
+	version, hash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == config.Params().ScriptAddressVersion {
+		return script.PayToScriptHash(hash), nil
+	}
+
+	return script.PayToPubKeyHash(hash), nil
+}
+
+// ScriptToAddress returns the address an output locked by the script was sent to,
+// if the script is a standard script paying to a key or to a script
+func ScriptToAddress(s script.Script) (string, bool) {
+	if pubKeyHash, ok := script.ExtractPubKeyHash(s); ok {
+		return string(PubKeyHashToAddress(pubKeyHash)), true
+	}
+	if scriptHash, ok := script.ExtractScriptHash(s); ok {
+		return string(ScriptHashToAddress(scriptHash)), true
+	}
+
+	return "", false
 }
 
 // Address generates an address for a wallet
 func (w Wallet) Address() []byte {
-	pubHash := PublicKeyHash(w.PublicKey)
-	versionedHash := append([]byte{version}, pubHash...)
+	return PubKeyHashToAddress(PublicKeyHash(w.PublicKey))
+}
+
+// PubKeyHashToAddress returns the address of a public key hash on the network the process runs
+func PubKeyHashToAddress(pubHash []byte) []byte {
+	return encodeAddress(config.Params().AddressVersion, pubHash)
+}
+
+// ScriptHashToAddress returns the address of a script hash on the network the process runs
+func ScriptHashToAddress(scriptHash []byte) []byte {
+	return encodeAddress(config.Params().ScriptAddressVersion, scriptHash)
+}
+
+func encodeAddress(version byte, hash []byte) []byte {
+	versionedHash := append([]byte{version}, hash...)
 	checksum := Checksum(versionedHash)
 	fullHash := append(versionedHash, checksum...)
 	address := Base58Encode(fullHash)
 
-	// fmt.Printf("pub key: %x\n", w.PublicKey)
-	// fmt.Printf("pub hash: %x\n", pubHash)
-	// fmt.Printf("address: %x\n", address)
 	return address
 }
 
 // NewKeyPair generate a pair of of public and private key
 // can generate upto 10 ^ 77 different keys
-func NewKeyPair() (ecdsa.PrivateKey, []byte) {
+func NewKeyPair() (ecdsa.PrivateKey, []byte, error) {
 	curve := elliptic.P256()
 
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
-	errors.HandleErr(err)
+	if err != nil {
+		return ecdsa.PrivateKey{}, nil, err
+	}
 
-	public := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-	return *private, public
+	// the coordinates are padded to the same length so that they can be split apart
+	public := append(private.PublicKey.X.FillBytes(make([]byte, 32)), private.PublicKey.Y.FillBytes(make([]byte, 32))...)
+	return *private, public, nil
 }
 
 // CreateWallet creates a wallet with a new key pair
-func CreateWallet() *Wallet {
-	private, public := NewKeyPair()
+func CreateWallet() (*Wallet, error) {
+	private, public, err := NewKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Wallet{
 		PrivateKey: private,
 		PublicKey:  public,
-	}
+	}, nil
 }
 
 // PublicKeyHash returns the publickeyhash of the p
@@ -73,8 +198,8 @@ func PublicKeyHash(pubKey []byte) []byte {
 	pubHashed := sha256.Sum256(pubKey)
 
 	hasher := ripemd160.New()
-	_, err := hasher.Write(pubHashed[:])
-	errors.HandleErr(err)
+	// writing to a hash never fails
+	hasher.Write(pubHashed[:])
 
 	return hasher.Sum(nil)
 }
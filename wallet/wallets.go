@@ -2,39 +2,106 @@ package wallet
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
 	"fmt"
+	"go-blockchain/errors"
+	"go-blockchain/script"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
 )
 
-const walletFile = "./tmp/wallets.data"
-
-// Wallets is a map from address to wallet
+// Wallets is a map from address to wallet.
+// The wallets of a file with a seed are derived from it, see hd.go
 type Wallets struct {
 	Wallets map[string]*Wallet
+	// Seed derives the wallets, wallet files created before HD wallets have none
+	Seed []byte
+	// NextIndex is the index of the next wallet derived from the seed
+	NextIndex uint32
+	// MultiSigs are the redeem scripts of the multisig addresses, see multisig.go
+	MultiSigs map[string]script.Script
+
+	passphrase []byte // encrypts the wallet file, empty for an unencrypted file
 }
 
-// CreateWallets will populate our wallets
-func CreateWallets() (*Wallets, error) {
-	wallets := Wallets{}
+// CreateWallets will populate our wallets from the wallet file.
+// The passphrase decrypts the wallet file and is kept to encrypt it again on SaveFile
+func CreateWallets(walletFile string, passphrase []byte) (*Wallets, error) {
+	wallets := Wallets{passphrase: passphrase}
 	wallets.Wallets = make(map[string]*Wallet)
 
-	err := wallets.LoadFile()
+	err := wallets.LoadFile(walletFile)
 
 	return &wallets, err
 }
 
-// AddWallet adds a wallet to Wallets
-func (ws *Wallets) AddWallet() string {
-	wallet := CreateWallet()
+// AddWallet adds a wallet to Wallets, derived from the seed if there is one
+func (ws *Wallets) AddWallet() (string, error) {
+	var wallet *Wallet
+	if ws.IsHD() {
+		wallet = DeriveWallet(ws.Seed, ws.NextIndex)
+		ws.NextIndex++
+	} else {
+		var err error
+		if wallet, err = CreateWallet(); err != nil {
+			return "", err
+		}
+	}
 	address := fmt.Sprintf("%s", wallet.Address())
 
 	ws.Wallets[address] = wallet
 
-	return address
+	return address, nil
+}
+
+// IsHD checks if the wallets are derived from a seed
+func (ws *Wallets) IsHD() bool {
+	return len(ws.Seed) > 0
+}
+
+// SetMnemonic derives the next wallets from the seed of the recovery phrase
+func (ws *Wallets) SetMnemonic(mnemonic string) error {
+	seed, err := MnemonicToSeed(mnemonic)
+	if err != nil {
+		return err
+	}
+
+	ws.Seed = seed
+	ws.NextIndex = 0
+
+	return nil
+}
+
+// Restore rediscovers the wallets of the recovery phrase. isUsed tells if a
+// public key hash received an output, and wallets are derived until GapLimit
+// wallets in a row are unused. The first wallet is always restored.
+// It returns the addresses of the restored wallets
+func (ws *Wallets) Restore(mnemonic string, isUsed func(pubKeyHash []byte) bool) ([]string, error) {
+	if err := ws.SetMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	var lastUsed uint32
+	for index, unused := uint32(0), 0; unused < GapLimit; index++ {
+		if isUsed(PublicKeyHash(DeriveWallet(ws.Seed, index).PublicKey)) {
+			lastUsed = index
+			unused = 0
+		} else {
+			unused++
+		}
+	}
+
+	var addresses []string
+	for ws.NextIndex <= lastUsed {
+		address, err := ws.AddWallet()
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+
+	return addresses, nil
 }
 
 // GetAllAddresses gets all the address in the wallets structure
@@ -48,13 +115,41 @@ func (ws *Wallets) GetAllAddresses() []string {
 	return addresses
 }
 
-// GetWallet gets the wallet with the given the address
-func (ws Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+// GetWallet gets the wallet with the given the address.
+// It fails with ErrWalletNotFound if the wallets do not have the address
+func (ws Wallets) GetWallet(address string) (Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return Wallet{}, errors.NewWalletNotFoundError(address)
+	}
+
+	return *wallet, nil
+}
+
+// SetPassphrase sets the passphrase SaveFile encrypts the wallets with.
+// An empty passphrase stores the wallets unencrypted
+func (ws *Wallets) SetPassphrase(passphrase []byte) {
+	ws.passphrase = passphrase
+}
+
+// IsEncrypted checks if the wallet file is encrypted
+func IsEncrypted(walletFile string) bool {
+	content, err := ioutil.ReadFile(walletFile)
+	if err != nil {
+		return false
+	}
+
+	return isEncrypted(content)
+}
+
+// WalletFileExists checks if the wallet file already exists
+func WalletFileExists(walletFile string) bool {
+	_, err := os.Stat(walletFile)
+	return !os.IsNotExist(err)
 }
 
-// LoadFile loads all the wallets from the file
-func (ws *Wallets) LoadFile() error {
+// LoadFile loads all the wallets from the file, decrypting it with the passphrase if it is encrypted
+func (ws *Wallets) LoadFile(walletFile string) error {
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
 	}
@@ -66,7 +161,13 @@ func (ws *Wallets) LoadFile() error {
 		return err
 	}
 
-	gob.Register(elliptic.P256())
+	if isEncrypted(fileContent) {
+		fileContent, err = decrypt(fileContent, ws.passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err != nil {
@@ -74,24 +175,73 @@ func (ws *Wallets) LoadFile() error {
 	}
 
 	ws.Wallets = wallets.Wallets
+	ws.Seed = wallets.Seed
+	ws.NextIndex = wallets.NextIndex
+	ws.MultiSigs = wallets.MultiSigs
 
 	return nil
 }
 
-// SaveFile saves the wallets to the file
-func (ws *Wallets) SaveFile() {
+// SaveFile saves the wallets to the file, encrypted if the wallets have a passphrase.
+// The file is only readable by its owner
+func (ws *Wallets) SaveFile(walletFile string) error {
 	var content bytes.Buffer
 
-	gob.Register(elliptic.P256())
-
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(ws)
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+
+	data := content.Bytes()
+	if len(ws.passphrase) > 0 {
+		data, err = encrypt(data, ws.passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(walletFile), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(walletFile, data)
+}
+
+// writeFileAtomic replaces the file with data, readable by its owner only. The
+// data is written to a temporary file of the same directory, flushed to the disk
+// and renamed over the file, so that a crash leaves either the old or the new file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
 	}
+	// once renamed, the temporary file is gone and Remove fails harmlessly
+	defer os.Remove(tmp.Name())
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// TempFile creates the file readable by its owner only
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// the rename itself is only durable once the directory is flushed
+	dir, err := os.Open(filepath.Dir(path))
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
+	defer dir.Close()
+
+	return dir.Sync()
 }